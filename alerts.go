@@ -0,0 +1,371 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Alert rule metrics. GPU metrics are evaluated per GPU on every successful
+// poll; alertMetricHostStale is evaluated per connection on every attempt.
+const (
+	alertMetricTemp           = "temp"
+	alertMetricUtil           = "util"
+	alertMetricMemUsed        = "memUsed"
+	alertMetricMemFree        = "memFree"
+	alertMetricMemUsedPercent = "memUsedPercent"
+	alertMetricPowerDraw      = "powerDraw"
+	alertMetricFanSpeed       = "fanSpeed"
+	alertMetricHostStale      = "hostStale"
+)
+
+const alertHistoryLimit = 200
+
+// AlertRule is a user-defined threshold on one metric.
+type AlertRule struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Enabled bool   `json:"enabled"`
+	// ConnectionID scopes the rule to one connection; empty matches all.
+	ConnectionID string  `json:"connectionId"`
+	Metric       string  `json:"metric"`
+	Op           string  `json:"op"`
+	Threshold    float64 `json:"threshold"`
+	// ForSec is how long the condition must hold before the alert fires.
+	ForSec int `json:"forSec"`
+	// Hysteresis is how far the value must move back past the threshold
+	// before a firing alert resolves.
+	Hysteresis float64 `json:"hysteresis"`
+	// CooldownSec is the minimum time between two firings of the same alert.
+	CooldownSec int `json:"cooldownSec"`
+}
+
+// AlertEvent records an alert firing or resolving.
+type AlertEvent struct {
+	RuleID       string  `json:"ruleId"`
+	RuleName     string  `json:"ruleName"`
+	ConnectionID string  `json:"connectionId"`
+	Target       string  `json:"target"`
+	GPUIndex     int     `json:"gpuIndex"`
+	Metric       string  `json:"metric"`
+	Value        float64 `json:"value"`
+	Threshold    float64 `json:"threshold"`
+	State        string  `json:"state"`
+	Timestamp    int64   `json:"timestamp"`
+	Message      string  `json:"message"`
+}
+
+func defaultAlertRules() []AlertRule {
+	return []AlertRule{
+		{ID: "gpu_hot", Name: "GPU overheating", Enabled: true, Metric: alertMetricTemp, Op: ">", Threshold: 83, ForSec: 30, Hysteresis: 3, CooldownSec: 300},
+		{ID: "vram_full", Name: "VRAM almost full", Enabled: true, Metric: alertMetricMemFree, Op: "<", Threshold: 1024, ForSec: 10, Hysteresis: 512, CooldownSec: 300},
+		{ID: "gpu_idle", Name: "GPU idle", Enabled: false, Metric: alertMetricUtil, Op: "==", Threshold: 0, ForSec: 600, CooldownSec: 3600},
+		{ID: "host_stale", Name: "Host not responding", Enabled: true, Metric: alertMetricHostStale, Op: ">=", Threshold: 120, CooldownSec: 600},
+	}
+}
+
+func validateAlertRule(r AlertRule) error {
+	if r.ID == "" {
+		return fmt.Errorf("alert rule id is required")
+	}
+	switch r.Metric {
+	case alertMetricTemp, alertMetricUtil, alertMetricMemUsed, alertMetricMemFree,
+		alertMetricMemUsedPercent, alertMetricPowerDraw, alertMetricFanSpeed, alertMetricHostStale:
+	default:
+		return fmt.Errorf("alert rule %q: unknown metric %q", r.ID, r.Metric)
+	}
+	switch r.Op {
+	case ">", ">=", "<", "<=", "==":
+	default:
+		return fmt.Errorf("alert rule %q: unknown operator %q", r.ID, r.Op)
+	}
+	if r.ForSec < 0 || r.CooldownSec < 0 || r.Hysteresis < 0 {
+		return fmt.Errorf("alert rule %q: durations and hysteresis must not be negative", r.ID)
+	}
+	return nil
+}
+
+// alertState tracks one rule against one connection/GPU pair.
+type alertState struct {
+	pendingSince time.Time
+	firing       bool
+	lastFired    time.Time
+}
+
+// alertEngine evaluates rules against poll samples. It is driven entirely by
+// the timestamps passed in, so tests can feed synthetic sample streams.
+type alertEngine struct {
+	mu      sync.Mutex
+	rules   []AlertRule
+	states  map[string]*alertState
+	history []AlertEvent
+}
+
+func newAlertEngine(rules []AlertRule) *alertEngine {
+	return &alertEngine{rules: rules, states: map[string]*alertState{}}
+}
+
+func (e *alertEngine) setRules(rules []AlertRule) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.rules = rules
+	// Drop state of rules that no longer exist so re-adding starts fresh.
+	valid := map[string]bool{}
+	for _, r := range rules {
+		valid[r.ID] = true
+	}
+	for key := range e.states {
+		ruleID, _, _ := strings.Cut(key, "\x00")
+		if !valid[ruleID] {
+			delete(e.states, key)
+		}
+	}
+}
+
+func alertKey(ruleID, connectionID string, gpuIndex int) string {
+	return ruleID + "\x00" + connectionID + "\x00" + strconv.Itoa(gpuIndex)
+}
+
+// forget discards state for a connection that is no longer watched.
+func (e *alertEngine) forget(connectionID string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for key := range e.states {
+		_, rest, _ := strings.Cut(key, "\x00")
+		if strings.HasPrefix(rest, connectionID+"\x00") {
+			delete(e.states, key)
+		}
+	}
+}
+
+// evaluate feeds one poll attempt into the engine. gpus is nil when the poll
+// failed, in which case only host-level rules are evaluated.
+func (e *alertEngine) evaluate(connectionID string, meta ConnectionMeta, gpus []GPU, now time.Time) []AlertEvent {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	var events []AlertEvent
+	for _, rule := range e.rules {
+		if !rule.Enabled || (rule.ConnectionID != "" && rule.ConnectionID != connectionID) {
+			continue
+		}
+		if rule.Metric == alertMetricHostStale {
+			value, ok := hostStaleSeconds(meta, now)
+			if ev, fired := e.step(rule, connectionID, meta.ActiveTarget, -1, value, ok, now); fired {
+				events = append(events, ev)
+			}
+			continue
+		}
+		for _, g := range gpus {
+			value, ok := gpuMetricValue(rule.Metric, g)
+			if ev, fired := e.step(rule, connectionID, meta.ActiveTarget, g.Index, value, ok, now); fired {
+				events = append(events, ev)
+			}
+		}
+	}
+
+	e.history = append(e.history, events...)
+	if over := len(e.history) - alertHistoryLimit; over > 0 {
+		e.history = append([]AlertEvent{}, e.history[over:]...)
+	}
+	return events
+}
+
+func (e *alertEngine) step(rule AlertRule, connectionID, target string, gpuIndex int, value float64, ok bool, now time.Time) (AlertEvent, bool) {
+	key := alertKey(rule.ID, connectionID, gpuIndex)
+	st := e.states[key]
+	if st == nil {
+		st = &alertState{}
+		e.states[key] = st
+	}
+	if !ok {
+		// Metric unsupported on this GPU; never let it hold an alert open.
+		st.pendingSince = time.Time{}
+		return AlertEvent{}, false
+	}
+
+	event := func(state string) AlertEvent {
+		return AlertEvent{
+			RuleID:       rule.ID,
+			RuleName:     rule.Name,
+			ConnectionID: connectionID,
+			Target:       target,
+			GPUIndex:     gpuIndex,
+			Metric:       rule.Metric,
+			Value:        value,
+			Threshold:    rule.Threshold,
+			State:        state,
+			Timestamp:    now.Unix(),
+			Message:      alertMessage(rule, target, gpuIndex, value, state),
+		}
+	}
+
+	if compareAlert(rule.Op, value, rule.Threshold) {
+		if st.pendingSince.IsZero() {
+			st.pendingSince = now
+		}
+		if st.firing {
+			return AlertEvent{}, false
+		}
+		if now.Sub(st.pendingSince) < time.Duration(rule.ForSec)*time.Second {
+			return AlertEvent{}, false
+		}
+		if !st.lastFired.IsZero() && now.Sub(st.lastFired) < time.Duration(rule.CooldownSec)*time.Second {
+			return AlertEvent{}, false
+		}
+		st.firing = true
+		st.lastFired = now
+		return event("fired"), true
+	}
+
+	st.pendingSince = time.Time{}
+	if st.firing && clearedAlert(rule, value) {
+		st.firing = false
+		return event("resolved"), true
+	}
+	return AlertEvent{}, false
+}
+
+func compareAlert(op string, value, threshold float64) bool {
+	switch op {
+	case ">":
+		return value > threshold
+	case ">=":
+		return value >= threshold
+	case "<":
+		return value < threshold
+	case "<=":
+		return value <= threshold
+	case "==":
+		return value == threshold
+	}
+	return false
+}
+
+// clearedAlert reports whether value has moved far enough past the threshold
+// (by the rule's hysteresis) for a firing alert to resolve.
+func clearedAlert(rule AlertRule, value float64) bool {
+	switch rule.Op {
+	case ">", ">=":
+		return value <= rule.Threshold-rule.Hysteresis
+	case "<", "<=":
+		return value >= rule.Threshold+rule.Hysteresis
+	case "==":
+		return math.Abs(value-rule.Threshold) > rule.Hysteresis
+	}
+	return true
+}
+
+func gpuMetricValue(metric string, g GPU) (float64, bool) {
+	var v int
+	switch metric {
+	case alertMetricTemp:
+		v = g.Temp
+	case alertMetricUtil:
+		v = g.Util
+	case alertMetricMemUsed:
+		v = g.MemUsed
+	case alertMetricMemFree:
+		if g.MemTotal <= 0 || g.MemUsed < 0 {
+			return 0, false
+		}
+		v = g.MemTotal - g.MemUsed
+	case alertMetricMemUsedPercent:
+		if g.MemTotal <= 0 || g.MemUsed < 0 {
+			return 0, false
+		}
+		return float64(g.MemUsed) * 100 / float64(g.MemTotal), true
+	case alertMetricPowerDraw:
+		v = g.PowerDraw
+	case alertMetricFanSpeed:
+		v = g.FanSpeed
+	default:
+		return 0, false
+	}
+	if v < 0 {
+		return 0, false
+	}
+	return float64(v), true
+}
+
+// hostStaleSeconds is the time since the last successful poll. Hosts that
+// never answered are covered by the connection error state instead.
+func hostStaleSeconds(meta ConnectionMeta, now time.Time) (float64, bool) {
+	if meta.LastSuccessTs <= 0 {
+		return 0, false
+	}
+	return now.Sub(time.Unix(meta.LastSuccessTs, 0)).Seconds(), true
+}
+
+func alertMessage(rule AlertRule, target string, gpuIndex int, value float64, state string) string {
+	where := target
+	if gpuIndex >= 0 {
+		where = fmt.Sprintf("%s GPU %d", target, gpuIndex)
+	}
+	if state == "resolved" {
+		return fmt.Sprintf("%s resolved on %s (%s now %s)", rule.Name, where, rule.Metric, formatAlertValue(value))
+	}
+	return fmt.Sprintf("%s on %s: %s %s %s %s", rule.Name, where, rule.Metric, formatAlertValue(value), rule.Op, formatAlertValue(rule.Threshold))
+}
+
+func formatAlertValue(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+func (e *alertEngine) historyCopy() []AlertEvent {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	out := make([]AlertEvent, len(e.history))
+	copy(out, e.history)
+	return out
+}
+
+// GetAlertRules returns the configured alert rules.
+func (a *App) GetAlertRules() []AlertRule {
+	return a.alertRules()
+}
+
+func (a *App) alertRules() []AlertRule {
+	rules := a.store.snapshot().AlertRules
+	if rules == nil {
+		return defaultAlertRules()
+	}
+	return rules
+}
+
+// SetAlertRules validates, applies and persists the alert rules.
+func (a *App) SetAlertRules(rules []AlertRule) error {
+	seen := map[string]bool{}
+	for _, r := range rules {
+		if err := validateAlertRule(r); err != nil {
+			return err
+		}
+		if seen[r.ID] {
+			return fmt.Errorf("duplicate alert rule id %q", r.ID)
+		}
+		seen[r.ID] = true
+	}
+	if rules == nil {
+		rules = []AlertRule{}
+	}
+	a.alerts.setRules(rules)
+	return a.store.update(func(cfg *appConfig) {
+		cfg.AlertRules = rules
+	})
+}
+
+// GetAlertHistory returns recent alert events, oldest first.
+func (a *App) GetAlertHistory() []AlertEvent {
+	return a.alerts.historyCopy()
+}
+
+func (a *App) evaluateAlerts(id string, meta ConnectionMeta, gpus []GPU, now time.Time) {
+	for _, ev := range a.alerts.evaluate(id, meta, gpus, now) {
+		a.emit("alert:"+ev.State, ev)
+		a.deliverNotifications(a.notifications.alert(ev, now))
+		a.webhooks.alert(ev, now)
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// feed runs a synthetic stream of GPU temperatures through the engine, one
+// sample per second, and returns the states of emitted events.
+func feed(e *alertEngine, start time.Time, temps []int) []string {
+	var states []string
+	for i, temp := range temps {
+		now := start.Add(time.Duration(i) * time.Second)
+		meta := ConnectionMeta{Status: "live", ActiveTarget: "box", LastSuccessTs: now.Unix()}
+		for _, ev := range e.evaluate("conn", meta, []GPU{{Index: 0, Temp: temp, MemTotal: -1}}, now) {
+			states = append(states, ev.State)
+		}
+	}
+	return states
+}
+
+func TestAlertRequiresSustainedCondition(t *testing.T) {
+	e := newAlertEngine([]AlertRule{{ID: "hot", Name: "Hot", Enabled: true, Metric: alertMetricTemp, Op: ">", Threshold: 83, ForSec: 3}})
+	start := time.Unix(1700000000, 0)
+
+	// A two-second spike never fires.
+	if got := feed(e, start, []int{85, 86, 70}); len(got) != 0 {
+		t.Fatalf("expected no events for short spike, got %v", got)
+	}
+	// Four seconds above threshold fires exactly once.
+	got := feed(e, start.Add(10*time.Second), []int{85, 85, 85, 85, 85})
+	if len(got) != 1 || got[0] != "fired" {
+		t.Fatalf("expected a single fired event, got %v", got)
+	}
+}
+
+func TestAlertHysteresis(t *testing.T) {
+	e := newAlertEngine([]AlertRule{{ID: "hot", Name: "Hot", Enabled: true, Metric: alertMetricTemp, Op: ">", Threshold: 83, Hysteresis: 3}})
+	start := time.Unix(1700000000, 0)
+
+	// 82 and 81 are below the threshold but inside the hysteresis band.
+	got := feed(e, start, []int{84, 82, 81, 84, 80})
+	if len(got) != 2 || got[0] != "fired" || got[1] != "resolved" {
+		t.Fatalf("expected fired then resolved only after leaving the band, got %v", got)
+	}
+	history := e.historyCopy()
+	if len(history) != 2 || history[1].Value != 80 {
+		t.Fatalf("unexpected history: %+v", history)
+	}
+}
+
+func TestAlertCooldown(t *testing.T) {
+	e := newAlertEngine([]AlertRule{{ID: "hot", Name: "Hot", Enabled: true, Metric: alertMetricTemp, Op: ">", Threshold: 83, CooldownSec: 5}})
+	start := time.Unix(1700000000, 0)
+
+	// Re-crossing inside the cooldown is suppressed until it expires.
+	got := feed(e, start, []int{90, 70, 90, 90, 90, 90, 90})
+	if len(got) != 3 || got[0] != "fired" || got[1] != "resolved" || got[2] != "fired" {
+		t.Fatalf("expected fired, resolved, fired after cooldown, got %v", got)
+	}
+}
+
+func TestAlertHostStale(t *testing.T) {
+	e := newAlertEngine([]AlertRule{{ID: "stale", Name: "Stale", Enabled: true, Metric: alertMetricHostStale, Op: ">=", Threshold: 120}})
+	lastSuccess := time.Unix(1700000000, 0)
+	meta := ConnectionMeta{Status: "stale", ActiveTarget: "box", LastSuccessTs: lastSuccess.Unix()}
+
+	if evs := e.evaluate("conn", meta, nil, lastSuccess.Add(60*time.Second)); len(evs) != 0 {
+		t.Fatalf("expected no event after 60s, got %+v", evs)
+	}
+	evs := e.evaluate("conn", meta, nil, lastSuccess.Add(121*time.Second))
+	if len(evs) != 1 || evs[0].State != "fired" || evs[0].GPUIndex != -1 {
+		t.Fatalf("expected host-level fired event, got %+v", evs)
+	}
+
+	meta.Status = "live"
+	meta.LastSuccessTs = lastSuccess.Add(130 * time.Second).Unix()
+	evs = e.evaluate("conn", meta, []GPU{}, lastSuccess.Add(130*time.Second))
+	if len(evs) != 1 || evs[0].State != "resolved" {
+		t.Fatalf("expected resolved event, got %+v", evs)
+	}
+}
+
+func TestAlertSkipsUnsupportedMetrics(t *testing.T) {
+	e := newAlertEngine([]AlertRule{{ID: "vram", Name: "VRAM", Enabled: true, Metric: alertMetricMemFree, Op: "<", Threshold: 1024}})
+	now := time.Unix(1700000000, 0)
+	meta := ConnectionMeta{Status: "live", ActiveTarget: "box"}
+	if evs := e.evaluate("conn", meta, []GPU{{Index: 0, MemUsed: -1, MemTotal: -1}}, now); len(evs) != 0 {
+		t.Fatalf("unsupported memory readings must not fire, got %+v", evs)
+	}
+	evs := e.evaluate("conn", meta, []GPU{{Index: 0, MemUsed: 24000, MemTotal: 24576}}, now)
+	if len(evs) != 1 || evs[0].Value != 576 {
+		t.Fatalf("expected memFree alert with value 576, got %+v", evs)
+	}
+}
+
+func TestSetAlertRulesValidates(t *testing.T) {
+	a, _ := newTestApp(nil)
+	if err := a.SetAlertRules([]AlertRule{{ID: "x", Metric: "bogus", Op: ">"}}); err == nil {
+		t.Fatal("expected unknown metric to be rejected")
+	}
+	if err := a.SetAlertRules([]AlertRule{{ID: "x", Metric: alertMetricTemp, Op: ">"}, {ID: "x", Metric: alertMetricUtil, Op: "<"}}); err == nil {
+		t.Fatal("expected duplicate ids to be rejected")
+	}
+	if len(a.GetAlertRules()) != len(defaultAlertRules()) {
+		t.Fatal("expected defaults before rules are configured")
+	}
+	if err := a.SetAlertRules([]AlertRule{}); err != nil {
+		t.Fatalf("SetAlertRules returned error: %v", err)
+	}
+	if len(a.GetAlertRules()) != 0 {
+		t.Fatal("expected an explicitly empty rule set to stick")
+	}
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"io"
 	"net/http"
 	"os/exec"
@@ -24,18 +25,24 @@ type ConnectionTestResult struct {
 	Success  bool   `json:"success"`
 	Code     string `json:"code"`
 	Message  string `json:"message"`
+	Hint     string `json:"hint"`
 	GPUCount int    `json:"gpuCount"`
 }
 
 type ConnectionMeta struct {
+	ConnectionID        string `json:"connectionId"`
 	Status              string `json:"status"`
 	LastSuccessTs       int64  `json:"lastSuccessTs"`
 	ConsecutiveFailures int    `json:"consecutiveFailures"`
 	NextRetryInSec      int    `json:"nextRetryInSec"`
 	ErrorCode           string `json:"errorCode"`
 	ErrorMessage        string `json:"errorMessage"`
-	ActiveTarget        string `json:"activeTarget"`
-	ActivePort          int    `json:"activePort"`
+	ErrorHint           string `json:"errorHint"`
+	// PollState is "fast", "idle" (adaptive polling backed off), "backoff"
+	// (retrying after failures) or "paused" (system sleep or low battery).
+	PollState    string `json:"pollState"`
+	ActiveTarget string `json:"activeTarget"`
+	ActivePort   int    `json:"activePort"`
 }
 
 type WindowMode string
@@ -58,37 +65,97 @@ var retrySchedule = []time.Duration{
 	30 * time.Second,
 }
 
+const nonRetryableDelay = 2 * time.Minute
+
 type App struct {
 	ctx context.Context
 
 	mu sync.Mutex
 
-	connectionTarget string
-	connectionPort   int
+	workers  map[string]*connectionWorker
+	workerWG sync.WaitGroup // running worker goroutines, stopped or not
+	store    *configStore
+	metrics  *metricsExporter
+	alerts   *alertEngine
+	history  *historyStore
+	recorder *recorder
+
+	notifications *notificationEngine
+	notifier      notifier
+	webhooks      *webhookDispatcher
 
 	windowMode WindowMode
 	visible    bool
+	power      powerState
+
+	// trayID is the connection the tray shows; trayStatus and trayGPUs are
+	// what it last drew, kept to redraw on display mode changes.
+	trayID     string
+	trayStatus string
+	trayGPUs   []GPU
+
+	stopCh chan struct{}
+	clock  clock
 
-	stopCh    chan struct{}
-	pollNowCh chan struct{}
+	// emit and the collectors are swapped out in tests. query reads just
+	// the GPUs; poll is the full per-tick probe.
+	emit  func(event string, data ...interface{})
+	query func(target string, port int) ([]GPU, error)
+	poll  func(target string, port int, req probeRequest) (probeSnapshot, error)
 }
 
 func NewApp() *App {
-	return &App{
+	configPath, _ := defaultConfigPath()
+	a := &App{
+		workers:    map[string]*connectionWorker{},
+		store:      newConfigStore(configPath),
 		windowMode: windowModeMini,
 		stopCh:     make(chan struct{}),
-		pollNowCh:  make(chan struct{}, 1),
+		clock:      realClock{},
+		power:      powerState{batteryPercent: -1},
+		query:      queryHostGPUs,
+		poll:       pollHost,
 	}
+	a.emit = func(event string, data ...interface{}) {
+		if a.ctx != nil {
+			runtime.EventsEmit(a.ctx, event, data...)
+		}
+	}
+	a.metrics = newMetricsExporter(a.GetConnectionSnapshots)
+	a.alerts = newAlertEngine(defaultAlertRules())
+	a.history = newHistoryStore(defaultHistoryTiers)
+	a.recorder = newRecorder(defaultRecorderDir(), time.Now)
+	a.notifications = newNotificationEngine(defaultNotificationConfig())
+	a.notifier = newPlatformNotifier()
+	a.webhooks = newWebhookDispatcher()
+	return a
 }
 
 func (a *App) startup(ctx context.Context) {
 	a.ctx = ctx
+	if err := a.store.load(); err != nil {
+		println("config:", err.Error())
+	}
+	a.alerts.setRules(a.alertRules())
+	applySSHTransport(a.store.snapshot())
+	a.recorder.configure(a.store.snapshot().Recorder)
+	a.notifications.configure(a.notificationConfig())
+	a.webhooks.setHooks(a.store.snapshot().Webhooks)
 	go trayRun(a)
-	go a.pollLoop()
+	a.watchPower()
+	a.watchProfiles()
+	a.startMetricsExporter()
+	a.emit("gpu:conn_meta", ConnectionMeta{ConnectionID: defaultConnectionID, Status: "idle"}, defaultConnectionID)
 }
 
 func (a *App) shutdown(ctx context.Context) {
 	close(a.stopCh)
+	a.stopAllWorkers()
+	a.metrics.stop()
+	if err := a.recorder.flush(); err != nil {
+		println("recorder:", err.Error())
+	}
+	closeSSHTransport()
 }
 
 // GetVersion returns the embedded application version.
@@ -205,32 +272,34 @@ func parseLegacyHost(raw string) (string, int) {
 }
 
 func (a *App) wakePollLoop() {
-	select {
-	case a.pollNowCh <- struct{}{}:
-	default:
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, w := range a.workers {
+		w.wake()
 	}
 }
 
-// SetConnection updates the active SSH target and optional port.
+// SetConnection updates the default SSH target and optional port.
 func (a *App) SetConnection(target string, port int) {
 	target = strings.TrimSpace(target)
 	if target == "" {
-		port = 0
+		a.UnwatchConnection(defaultConnectionID)
+		return
 	}
-	a.mu.Lock()
-	a.connectionTarget = target
-	a.connectionPort = port
-	a.mu.Unlock()
-	a.wakePollLoop()
+	a.WatchConnection(defaultConnectionID, target, port)
 }
 
-// RetryConnection triggers an immediate poll attempt.
+// RetryConnection triggers an immediate poll attempt on every connection.
 func (a *App) RetryConnection() {
 	a.wakePollLoop()
 }
 
 // TestConnection runs a preflight query and returns actionable status.
 func (a *App) TestConnection(target string, port int) ConnectionTestResult {
+	return testConnection(a.query, target, port)
+}
+
+func testConnection(query func(target string, port int) ([]GPU, error), target string, port int) ConnectionTestResult {
 	target = strings.TrimSpace(target)
 	if target == "" {
 		return ConnectionTestResult{
@@ -239,10 +308,10 @@ func (a *App) TestConnection(target string, port int) ConnectionTestResult {
 			Message: "Host is required",
 		}
 	}
-	gpus, err := queryGPUs(target, port)
+	gpus, err := query(target, port)
 	if err != nil {
-		code, msg := classifyConnectionError(err)
-		return ConnectionTestResult{Success: false, Code: code, Message: msg}
+		e := classifyError(err)
+		return ConnectionTestResult{Success: false, Code: e.Code, Message: e.Message, Hint: e.Hint}
 	}
 	return ConnectionTestResult{
 		Success:  true,
@@ -252,6 +321,40 @@ func (a *App) TestConnection(target string, port int) ConnectionTestResult {
 	}
 }
 
+// GetSSHTransport returns the configured SSH transport: "exec" (system ssh)
+// or "native" (built-in client).
+func (a *App) GetSSHTransport() string {
+	if name := a.store.snapshot().SSHTransport; name != "" {
+		return name
+	}
+	return transportExec
+}
+
+// SetSSHTransport switches the SSH transport used by all connections and
+// persists the choice.
+func (a *App) SetSSHTransport(name string) error {
+	t, err := newSSHTransport(strings.TrimSpace(name))
+	if err != nil {
+		return err
+	}
+	setSSHTransport(t)
+	a.wakePollLoop()
+	return a.store.update(func(cfg *appConfig) {
+		cfg.SSHTransport = strings.TrimSpace(name)
+	})
+}
+
+// applySSHTransport activates the transport stored in cfg, falling back to
+// exec for unknown names.
+func applySSHTransport(cfg appConfig) {
+	t, err := newSSHTransport(cfg.SSHTransport)
+	if err != nil {
+		println("config:", err.Error())
+		return
+	}
+	setSSHTransport(t)
+}
+
 // ListSSHConfigConnections discovers candidate aliases from local ssh config.
 func (a *App) ListSSHConfigConnections() []SSHConfigConnection {
 	connections, err := discoverSSHConfigConnections()
@@ -294,14 +397,95 @@ func (a *App) HandleTrayClick() {
 	a.showMiniWindow()
 }
 
-// UpdateTrayTitle updates the menu bar status item title.
-func (a *App) UpdateTrayTitle(title string) {
-	setTrayTitle(title)
+// GetDisplayMode returns the menu bar display mode.
+func (a *App) GetDisplayMode() string {
+	return displayMode(a.store.snapshot())
+}
+
+// SetDisplayMode switches the menu bar display mode (minimal, compact,
+// standard, spark, multi or graphic), persists it and redraws the tray.
+func (a *App) SetDisplayMode(mode string) error {
+	mode = strings.TrimSpace(mode)
+	if _, ok := trayLayouts[mode]; !ok {
+		return fmt.Errorf("unknown display mode %q", mode)
+	}
+	err := a.store.update(func(cfg *appConfig) {
+		cfg.DisplayMode = mode
+	})
+
+	a.mu.Lock()
+	id, status, gpus := a.trayID, a.trayStatus, a.trayGPUs
+	a.mu.Unlock()
+	if status != "" {
+		showTray(mode, status, gpus, a.trayHistory(id, mode, gpus))
+	}
+	return err
+}
+
+func displayMode(cfg appConfig) string {
+	if _, ok := trayLayouts[cfg.DisplayMode]; ok {
+		return cfg.DisplayMode
+	}
+	return defaultTrayMode
+}
+
+// updateTray redraws the tray for a connection's new status. The tray shows
+// the active profile, or the legacy default connection when none is active;
+// the connection it showed last still gets to clear it when it stops.
+func (a *App) updateTray(id string, status string, gpus []GPU) {
+	cfg := a.store.snapshot()
+	shown := trayConnectionID(cfg)
+
+	a.mu.Lock()
+	if id != shown && id != a.trayID {
+		a.mu.Unlock()
+		return
+	}
+	a.trayID, a.trayStatus, a.trayGPUs = id, status, gpus
+	a.mu.Unlock()
+
+	mode := displayMode(cfg)
+	showTray(mode, status, gpus, a.trayHistory(id, mode, gpus))
 }
 
-// UpdateTrayData renders GPU metrics graphically in the menu bar (two-line stacked layout).
-func (a *App) UpdateTrayData(temp, util, memUsed, memTotal int, status string) {
-	setTrayGPUStatus(temp, util, memUsed, memTotal, status)
+// trayConnectionID is the connection the tray shows.
+func trayConnectionID(cfg appConfig) string {
+	if cfg.ActiveProfileID != "" {
+		return cfg.ActiveProfileID
+	}
+	return defaultConnectionID
+}
+
+// showActiveInTray redraws the tray from the latest data of the connection
+// it shows, right after the active profile changed.
+func (a *App) showActiveInTray() {
+	id := trayConnectionID(a.store.snapshot())
+	a.mu.Lock()
+	w := a.workers[id]
+	a.mu.Unlock()
+	if w == nil {
+		a.updateTray(id, "idle", nil)
+		return
+	}
+	snap := w.snapshot()
+	a.updateTray(id, snap.Meta.Status, snap.GPUs)
+}
+
+// trayHistory returns the recent readings of the first GPU for mode's
+// sparkline, or nil when the mode draws none.
+func (a *App) trayHistory(id string, mode string, gpus []GPU) []float64 {
+	l := trayModeLayout(mode)
+	if l.sparkline == "" || len(gpus) == 0 {
+		return nil
+	}
+	points := a.history.recent(id, gpus[0].Index, l.sparkPoints)
+	values := make([]float64, 0, len(points))
+	for _, p := range points {
+		if v := sparkValue(p, l.sparkline); v >= 0 {
+			values = append(values, v)
+		}
+	}
+	return values
 }
 
 // Quit exits the application.
@@ -331,6 +515,7 @@ func (a *App) showMiniWindow() {
 	a.visible = true
 	a.windowMode = windowModeMini
 	a.mu.Unlock()
+	a.rescheduleWorkers()
 	runtime.EventsEmit(a.ctx, "window:mode", string(windowModeMini))
 }
 
@@ -344,6 +529,7 @@ func (a *App) showMainWindow() {
 	a.visible = true
 	a.windowMode = windowModeMain
 	a.mu.Unlock()
+	a.rescheduleWorkers()
 	runtime.EventsEmit(a.ctx, "window:mode", string(windowModeMain))
 }
 
@@ -352,165 +538,23 @@ func (a *App) hideWindow() {
 	a.mu.Lock()
 	a.visible = false
 	a.mu.Unlock()
+	a.rescheduleWorkers()
 }
 
-func retryDelay(failureCount int) time.Duration {
+// retryDelay is how long to wait after failureCount consecutive failures.
+// Errors retrying cannot fix, such as a rejected key, wait
+// nonRetryableDelay instead of hammering the host; RetryConnection still
+// polls at once.
+func retryDelay(failureCount int, retryable bool) time.Duration {
 	if failureCount <= 0 {
 		return 0
 	}
+	if !retryable {
+		return nonRetryableDelay
+	}
 	idx := failureCount - 1
 	if idx >= len(retrySchedule) {
 		idx = len(retrySchedule) - 1
 	}
 	return retrySchedule[idx]
 }
-
-func classifyConnectionError(err error) (code string, msg string) {
-	raw := strings.TrimSpace(err.Error())
-	lower := strings.ToLower(raw)
-	switch {
-	case strings.Contains(lower, "permission denied"):
-		return "auth_failed", "SSH auth failed. Check key-based access."
-	case strings.Contains(lower, "host key verification failed"):
-		return "host_key", "SSH host key not trusted. Connect once in terminal to confirm host."
-	case strings.Contains(lower, "could not resolve hostname"):
-		return "dns", "Host name could not be resolved. Check host alias and DNS."
-	case strings.Contains(lower, "connection refused"):
-		return "refused", "Connection refused by host. Check SSH service and port."
-	case strings.Contains(lower, "timed out") || strings.Contains(lower, "operation timed out"):
-		return "timeout", "Host unreachable. Check network or VPN and try again."
-	case strings.Contains(lower, "nvidia-smi") && (strings.Contains(lower, "not found") || strings.Contains(lower, "command not found")):
-		return "nvidia_smi_missing", "nvidia-smi not found on remote host."
-	default:
-		if raw == "" {
-			raw = "Connection failed"
-		}
-		return "unknown", raw
-	}
-}
-
-func (a *App) emitConnMeta(status string, lastSuccess time.Time, failures int, nextRetryAt time.Time, errCode string, errMsg string, target string, port int, now time.Time) {
-	meta := ConnectionMeta{
-		Status:              status,
-		ConsecutiveFailures: failures,
-		ErrorCode:           errCode,
-		ErrorMessage:        errMsg,
-		ActiveTarget:        target,
-		ActivePort:          port,
-	}
-	if !lastSuccess.IsZero() {
-		meta.LastSuccessTs = lastSuccess.Unix()
-	}
-	if !nextRetryAt.IsZero() && nextRetryAt.After(now) {
-		remaining := int(nextRetryAt.Sub(now).Seconds())
-		if remaining <= 0 {
-			remaining = 1
-		}
-		meta.NextRetryInSec = remaining
-	}
-	runtime.EventsEmit(a.ctx, "gpu:conn_meta", meta)
-}
-
-func (a *App) pollLoop() {
-	ticker := time.NewTicker(1 * time.Second)
-	defer ticker.Stop()
-
-	currentTarget := ""
-	currentPort := 0
-	status := "idle"
-	var lastSuccess time.Time
-	var nextRetryAt time.Time
-	consecutiveFailures := 0
-	lastErrCode := ""
-	lastErrMsg := ""
-
-	emitIdle := func(now time.Time) {
-		a.emitConnMeta("idle", time.Time{}, 0, time.Time{}, "", "", "", 0, now)
-	}
-
-	emitIdle(time.Now())
-
-	for {
-		forcePoll := false
-		now := time.Now()
-
-		select {
-		case <-a.stopCh:
-			return
-		case <-ticker.C:
-		case <-a.pollNowCh:
-			forcePoll = true
-		}
-
-		now = time.Now()
-		a.mu.Lock()
-		target := a.connectionTarget
-		port := a.connectionPort
-		a.mu.Unlock()
-
-		if target == "" {
-			status = "idle"
-			currentTarget = ""
-			currentPort = 0
-			lastSuccess = time.Time{}
-			nextRetryAt = time.Time{}
-			consecutiveFailures = 0
-			lastErrCode = ""
-			lastErrMsg = ""
-			emitIdle(now)
-			continue
-		}
-
-		if target != currentTarget || port != currentPort {
-			currentTarget = target
-			currentPort = port
-			status = "connecting"
-			lastSuccess = time.Time{}
-			nextRetryAt = time.Time{}
-			consecutiveFailures = 0
-			lastErrCode = ""
-			lastErrMsg = ""
-			forcePoll = true
-			a.emitConnMeta(status, lastSuccess, consecutiveFailures, nextRetryAt, lastErrCode, lastErrMsg, target, port, now)
-		}
-
-		if !forcePoll && !nextRetryAt.IsZero() && now.Before(nextRetryAt) {
-			a.emitConnMeta(status, lastSuccess, consecutiveFailures, nextRetryAt, lastErrCode, lastErrMsg, target, port, now)
-			continue
-		}
-
-		if lastSuccess.IsZero() {
-			status = "connecting"
-			a.emitConnMeta(status, lastSuccess, consecutiveFailures, nextRetryAt, lastErrCode, lastErrMsg, target, port, now)
-		}
-
-		gpus, err := queryGPUs(target, port)
-		if err == nil {
-			runtime.EventsEmit(a.ctx, "gpu:data", gpus)
-			lastSuccess = now
-			nextRetryAt = time.Time{}
-			consecutiveFailures = 0
-			lastErrCode = ""
-			lastErrMsg = ""
-			status = "live"
-			a.emitConnMeta(status, lastSuccess, consecutiveFailures, nextRetryAt, lastErrCode, lastErrMsg, target, port, now)
-			continue
-		}
-
-		consecutiveFailures++
-		lastErrCode, lastErrMsg = classifyConnectionError(err)
-		runtime.EventsEmit(a.ctx, "gpu:error", lastErrMsg)
-		nextRetryAt = now.Add(retryDelay(consecutiveFailures))
-
-		if !lastSuccess.IsZero() {
-			status = "stale"
-			if consecutiveFailures >= 6 {
-				status = "error"
-			}
-		} else {
-			status = "error"
-		}
-
-		a.emitConnMeta(status, lastSuccess, consecutiveFailures, nextRetryAt, lastErrCode, lastErrMsg, target, port, now)
-	}
-}
@@ -0,0 +1,390 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+)
+
+const cliUsage = `Usage: nvsmibar <command> [flags]
+
+Commands:
+  watch [-p port] [-i interval] <host>   Refresh GPU stats until interrupted
+  once  [-p port] [--json] <host>        Print GPU stats once
+  hosts [--json]                         List aliases from ~/.ssh/config
+  test  [-p port] <host>                 Check that a host can be monitored
+  free  [-n count] [--min-free 20G] [--max-util pct] [--json]
+                                         Find saved hosts with free GPUs
+
+Hosts may be ssh_config aliases, user@host, or host:port.
+Running without a command starts the menu bar app.
+`
+
+var cliCommands = map[string]bool{
+	"watch": true,
+	"once":  true,
+	"hosts": true,
+	"test":  true,
+	"free":  true,
+	"help":  true,
+}
+
+// isCLICommand reports whether arg selects headless CLI mode. Anything else
+// (including macOS launch arguments such as -psn_*) starts the GUI.
+func isCLICommand(arg string) bool {
+	return cliCommands[arg] || arg == "-h" || arg == "--help"
+}
+
+// cli runs the headless subcommands on top of the same collector as the GUI.
+type cli struct {
+	stdout   io.Writer
+	stderr   io.Writer
+	query    func(target string, port int) ([]GPU, error)
+	poll     func(target string, port int, req probeRequest) (probeSnapshot, error)
+	discover func() ([]SSHConfigConnection, error)
+	profiles func() []ConnectionProfile
+}
+
+func runCLI(args []string) int {
+	c := &cli{
+		stdout:   os.Stdout,
+		stderr:   os.Stderr,
+		query:    queryHostGPUs,
+		poll:     pollHost,
+		discover: discoverSSHConfigConnections,
+		profiles: func() []ConnectionProfile { return nil },
+	}
+	if path, err := defaultConfigPath(); err == nil {
+		store := newConfigStore(path)
+		if err := store.load(); err == nil {
+			applySSHTransport(store.snapshot())
+			c.profiles = func() []ConnectionProfile { return store.snapshot().Profiles }
+		}
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	defer closeSSHTransport()
+	return c.run(ctx, args)
+}
+
+func (c *cli) run(ctx context.Context, args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(c.stderr, cliUsage)
+		return 2
+	}
+	switch args[0] {
+	case "watch":
+		return c.watch(ctx, args[1:])
+	case "once":
+		return c.once(args[1:])
+	case "hosts":
+		return c.hosts(args[1:])
+	case "test":
+		return c.test(args[1:])
+	case "free":
+		return c.free(args[1:])
+	case "help", "-h", "--help":
+		fmt.Fprint(c.stdout, cliUsage)
+		return 0
+	default:
+		fmt.Fprintf(c.stderr, "unknown command %q\n\n%s", args[0], cliUsage)
+		return 2
+	}
+}
+
+func (c *cli) newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(c.stderr)
+	fs.Usage = func() { fmt.Fprint(c.stderr, cliUsage) }
+	return fs
+}
+
+// parseInterspersed parses flags that may appear before or after positional
+// arguments, e.g. "once gpu-box --json".
+func parseInterspersed(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// hostArg resolves the single host argument. An explicit -p wins over a
+// host:port suffix; with neither, ssh picks the port (e.g. from ssh_config).
+func (c *cli) hostArg(positional []string, port int) (string, int, bool) {
+	if len(positional) != 1 || strings.TrimSpace(positional[0]) == "" {
+		fmt.Fprint(c.stderr, "expected exactly one host\n\n"+cliUsage)
+		return "", 0, false
+	}
+	raw := strings.TrimSpace(positional[0])
+	if idx := strings.LastIndex(raw, ":"); idx > 0 && idx < len(raw)-1 {
+		if p, err := strconv.Atoi(raw[idx+1:]); err == nil {
+			raw = raw[:idx]
+			if port == 0 {
+				port = p
+			}
+		}
+	}
+	return raw, port, true
+}
+
+func (c *cli) once(args []string) int {
+	fs := c.newFlagSet("once")
+	port := fs.Int("p", 0, "SSH port")
+	asJSON := fs.Bool("json", false, "print JSON")
+	positional, err := parseInterspersed(fs, args)
+	if err != nil {
+		return 2
+	}
+	target, p, ok := c.hostArg(positional, *port)
+	if !ok {
+		return 2
+	}
+
+	gpus, err := c.query(target, p)
+	if err != nil {
+		_, msg := classifyConnectionError(err)
+		fmt.Fprintln(c.stderr, msg)
+		return 1
+	}
+	if *asJSON {
+		return c.printJSON(gpus)
+	}
+	printGPUTable(c.stdout, gpus)
+	return 0
+}
+
+func (c *cli) watch(ctx context.Context, args []string) int {
+	fs := c.newFlagSet("watch")
+	port := fs.Int("p", 0, "SSH port")
+	interval := fs.Duration("i", time.Second, "refresh interval")
+	positional, err := parseInterspersed(fs, args)
+	if err != nil {
+		return 2
+	}
+	target, p, ok := c.hostArg(positional, *port)
+	if !ok {
+		return 2
+	}
+	if *interval <= 0 {
+		*interval = time.Second
+	}
+
+	clearScreen := isTerminal(c.stdout)
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+	for {
+		gpus, err := c.query(target, p)
+		if clearScreen {
+			fmt.Fprint(c.stdout, "\033[H\033[2J")
+		}
+		fmt.Fprintf(c.stdout, "%s  %s\n\n", target, time.Now().Format("15:04:05"))
+		if err != nil {
+			_, msg := classifyConnectionError(err)
+			fmt.Fprintln(c.stdout, msg)
+		} else {
+			printGPUTable(c.stdout, gpus)
+		}
+
+		select {
+		case <-ctx.Done():
+			return 0
+		case <-ticker.C:
+		}
+	}
+}
+
+func (c *cli) hosts(args []string) int {
+	fs := c.newFlagSet("hosts")
+	asJSON := fs.Bool("json", false, "print JSON")
+	if _, err := parseInterspersed(fs, args); err != nil {
+		return 2
+	}
+
+	connections, err := c.discover()
+	if err != nil {
+		fmt.Fprintln(c.stderr, "read ssh config:", err)
+		return 1
+	}
+	if *asJSON {
+		return c.printJSON(connections)
+	}
+	tw := tabwriter.NewWriter(c.stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ALIAS\tHOST\tPORT\tPROXYJUMP")
+	for _, conn := range connections {
+		host := conn.HostName
+		if conn.User != "" {
+			host = conn.User + "@" + host
+		}
+		port, jump := "-", "-"
+		if conn.Port > 0 {
+			port = strconv.Itoa(conn.Port)
+		}
+		if conn.ProxyJump != "" {
+			jump = conn.ProxyJump
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", conn.Name, host, port, jump)
+	}
+	tw.Flush()
+	return 0
+}
+
+func (c *cli) test(args []string) int {
+	fs := c.newFlagSet("test")
+	port := fs.Int("p", 0, "SSH port")
+	positional, err := parseInterspersed(fs, args)
+	if err != nil {
+		return 2
+	}
+	target, p, ok := c.hostArg(positional, *port)
+	if !ok {
+		return 2
+	}
+
+	result := testConnection(c.query, target, p)
+	if !result.Success {
+		fmt.Fprintf(c.stdout, "FAIL [%s] %s\n", result.Code, result.Message)
+		if result.Hint != "" {
+			fmt.Fprintf(c.stdout, "     %s\n", result.Hint)
+		}
+		return 1
+	}
+	fmt.Fprintf(c.stdout, "OK   %s (%d GPU", result.Message, result.GPUCount)
+	if result.GPUCount != 1 {
+		fmt.Fprint(c.stdout, "s")
+	}
+	fmt.Fprintln(c.stdout, ")")
+	return 0
+}
+
+func (c *cli) free(args []string) int {
+	fs := c.newFlagSet("free")
+	count := fs.Int("n", 1, "number of GPUs needed on one host")
+	minFree := fs.String("min-free", "0", "free memory per GPU (e.g. 20G, 512M)")
+	maxUtil := fs.Int("max-util", 10, "maximum utilization percent")
+	asJSON := fs.Bool("json", false, "print JSON")
+	if _, err := parseInterspersed(fs, args); err != nil {
+		return 2
+	}
+	minFreeMiB, err := parseMiB(*minFree)
+	if err != nil {
+		fmt.Fprintln(c.stderr, err)
+		return 2
+	}
+	profiles := c.profiles()
+	if len(profiles) == 0 {
+		fmt.Fprintln(c.stderr, "no saved hosts; add one in the app first")
+		return 1
+	}
+
+	fetch := func(p ConnectionProfile) ([]GPU, bool, error) {
+		gpus, err := pollProfileGPUs(c.poll, p)
+		return gpus, false, err
+	}
+	result := findFreeGPUs(profiles, fetch, minFreeMiB, *maxUtil, *count)
+	if *asJSON {
+		if code := c.printJSON(result); code != 0 {
+			return code
+		}
+	} else {
+		for _, u := range result.Unreachable {
+			fmt.Fprintf(c.stderr, "%s: %s\n", u.Name, u.Message)
+		}
+		if len(result.Candidates) > 0 {
+			tw := tabwriter.NewWriter(c.stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(tw, "HOST\tGPUS\tFREE\tUTIL\tCUDA_VISIBLE_DEVICES")
+			for _, cand := range result.Candidates {
+				var free, util []string
+				for _, g := range cand.GPUs {
+					free = append(free, fmt.Sprintf("%.1fG", float64(g.FreeMiB)/1024))
+					util = append(util, strconv.Itoa(g.Util)+"%")
+				}
+				fmt.Fprintf(tw, "%s\t%d\t%s\t%s\t%s\n", cand.Name, len(cand.GPUs), strings.Join(free, ","), strings.Join(util, ","), cand.CUDAVisibleDevices)
+			}
+			tw.Flush()
+			best := result.Candidates[0]
+			fmt.Fprintf(c.stdout, "\nssh %s  then: export %s\n", best.Target, best.Env)
+		}
+	}
+	if len(result.Candidates) == 0 {
+		if !*asJSON {
+			fmt.Fprintf(c.stdout, "no host has %d free GPU(s) matching\n", *count)
+		}
+		return 1
+	}
+	return 0
+}
+
+func (c *cli) printJSON(v interface{}) int {
+	enc := json.NewEncoder(c.stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		fmt.Fprintln(c.stderr, err)
+		return 1
+	}
+	return 0
+}
+
+func printGPUTable(w io.Writer, gpus []GPU) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "GPU\tNAME\tUTIL\tTEMP\tMEMORY\tPOWER\tFAN")
+	for _, g := range gpus {
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s/%s MiB\t%s/%s W\t%s\n",
+			g.Index,
+			strings.TrimPrefix(g.Name, "NVIDIA "),
+			cliValue(g.Util, "%"),
+			cliValue(g.Temp, "°C"),
+			cliValue(g.MemUsed, ""),
+			cliValue(g.MemTotal, ""),
+			cliValue(g.PowerDraw, ""),
+			cliValue(g.PowerLimit, ""),
+			cliValue(g.FanSpeed, "%"),
+		)
+	}
+	tw.Flush()
+
+	for _, g := range gpus {
+		for _, p := range g.Processes {
+			name := p.Command
+			if name == "" {
+				name = p.ProcessName
+			}
+			fmt.Fprintf(w, "  gpu%d  pid %-8d %-10s %6s MiB  %s\n", g.Index, p.PID, p.User, cliValue(p.UsedMemory, ""), name)
+		}
+	}
+}
+
+func cliValue(v int, suffix string) string {
+	if v < 0 {
+		return "--"
+	}
+	return strconv.Itoa(v) + suffix
+}
+
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func newTestCLI(query func(target string, port int) ([]GPU, error)) (*cli, *bytes.Buffer, *bytes.Buffer) {
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	return &cli{
+		stdout: stdout,
+		stderr: stderr,
+		query:  query,
+		poll: func(target string, port int, req probeRequest) (probeSnapshot, error) {
+			gpus, err := query(target, port)
+			return probeSnapshot{GPUs: gpus}, err
+		},
+		discover: func() ([]SSHConfigConnection, error) {
+			return []SSHConfigConnection{{Name: "box", Target: "box", Port: 2222, Source: "ssh_config", HostName: "box.lan", User: "alice"}}, nil
+		},
+		profiles: func() []ConnectionProfile {
+			return []ConnectionProfile{{ID: "p1", Name: "box", Target: "box", Port: 22}, {ID: "p2", Name: "big", Target: "big", Port: 22, Collector: collectorXML}}
+		},
+	}, stdout, stderr
+}
+
+func TestCLIOnceJSONAcceptsTrailingFlags(t *testing.T) {
+	var gotTarget string
+	var gotPort int
+	c, stdout, _ := newTestCLI(func(target string, port int) ([]GPU, error) {
+		gotTarget, gotPort = target, port
+		return []GPU{{Index: 0, Name: "NVIDIA A100", Util: 42}}, nil
+	})
+
+	if code := c.run(context.Background(), []string{"once", "gpu-box:2200", "--json"}); code != 0 {
+		t.Fatalf("expected exit 0, got %d", code)
+	}
+	if gotTarget != "gpu-box" || gotPort != 2200 {
+		t.Fatalf("unexpected target %q port %d", gotTarget, gotPort)
+	}
+	var gpus []GPU
+	if err := json.Unmarshal(stdout.Bytes(), &gpus); err != nil {
+		t.Fatalf("output is not JSON: %v\n%s", err, stdout)
+	}
+	if len(gpus) != 1 || gpus[0].Util != 42 {
+		t.Fatalf("unexpected gpus: %+v", gpus)
+	}
+}
+
+func TestCLIOnceTable(t *testing.T) {
+	c, stdout, _ := newTestCLI(func(target string, port int) ([]GPU, error) {
+		return []GPU{{Index: 1, Name: "NVIDIA T4", Util: 5, Temp: 40, MemUsed: 100, MemTotal: 15360, PowerDraw: -1, PowerLimit: 70, FanSpeed: -1}}, nil
+	})
+	if code := c.run(context.Background(), []string{"once", "-p", "22", "box"}); code != 0 {
+		t.Fatalf("expected exit 0, got %d", code)
+	}
+	out := stdout.String()
+	for _, want := range []string{"GPU", "T4", "5%", "40°C", "100/15360 MiB", "--/70 W"} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("expected %q in output:\n%s", want, out)
+		}
+	}
+}
+
+func TestCLITestReportsClassifiedFailure(t *testing.T) {
+	c, stdout, _ := newTestCLI(func(target string, port int) ([]GPU, error) {
+		return nil, sshFailure("Permission denied (publickey).")
+	})
+	if code := c.run(context.Background(), []string{"test", "box"}); code != 1 {
+		t.Fatalf("expected exit 1, got %d", code)
+	}
+	if !strings.Contains(stdout.String(), "[auth_failed]") || !strings.Contains(stdout.String(), "ssh-agent") {
+		t.Fatalf("unexpected output: %s", stdout)
+	}
+}
+
+func TestCLIHosts(t *testing.T) {
+	c, stdout, _ := newTestCLI(nil)
+	if code := c.run(context.Background(), []string{"hosts"}); code != 0 {
+		t.Fatalf("expected exit 0, got %d", code)
+	}
+	if !strings.Contains(stdout.String(), "alice@box.lan") || !strings.Contains(stdout.String(), "2222") {
+		t.Fatalf("unexpected output: %s", stdout)
+	}
+}
+
+func TestCLIWatchStopsOnCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	calls := 0
+	c, stdout, _ := newTestCLI(func(target string, port int) ([]GPU, error) {
+		calls++
+		cancel()
+		return []GPU{{Index: 0, Name: "GPU"}}, nil
+	})
+	if code := c.run(ctx, []string{"watch", "-i", "10ms", "box"}); code != 0 {
+		t.Fatalf("expected exit 0, got %d", code)
+	}
+	if calls != 1 || !strings.Contains(stdout.String(), "box") {
+		t.Fatalf("unexpected watch run: calls=%d output=%s", calls, stdout)
+	}
+}
+
+func TestCLIRejectsMissingHost(t *testing.T) {
+	c, _, stderr := newTestCLI(nil)
+	if code := c.run(context.Background(), []string{"once"}); code != 2 {
+		t.Fatalf("expected exit 2, got %d", code)
+	}
+	if !strings.Contains(stderr.String(), "expected exactly one host") {
+		t.Fatalf("unexpected stderr: %s", stderr)
+	}
+}
+
+func TestCLIFree(t *testing.T) {
+	c, stdout, stderr := newTestCLI(func(target string, port int) ([]GPU, error) {
+		if target == "box" {
+			return nil, sshFailure("ssh: connect to host box port 22: Connection refused")
+		}
+		return []GPU{
+			{Index: 0, Util: 100, MemUsed: 80000, MemTotal: 81920},
+			{Index: 1, Util: 0, MemUsed: 0, MemTotal: 81920},
+			{Index: 2, Util: 3, MemUsed: 1024, MemTotal: 81920},
+		}, nil
+	})
+	if code := c.run(context.Background(), []string{"free", "-n", "2", "--min-free", "20G"}); code != 0 {
+		t.Fatalf("expected exit 0, got %d (stderr %s)", code, stderr)
+	}
+	if !strings.Contains(stdout.String(), "CUDA_VISIBLE_DEVICES=1,2") || !strings.Contains(stderr.String(), "box: ") {
+		t.Fatalf("unexpected output:\n%s\nstderr:\n%s", stdout, stderr)
+	}
+
+	stdout.Reset()
+	if code := c.run(context.Background(), []string{"free", "-n", "3"}); code != 1 {
+		t.Fatalf("expected exit 1 when nothing matches, got %d", code)
+	}
+	if code := c.run(context.Background(), []string{"free", "--min-free", "lots"}); code != 2 {
+		t.Fatalf("expected usage error, got %d", code)
+	}
+
+	// Hosts are read with their profile's collector, as in the app.
+	var mu sync.Mutex
+	collectors := map[string]string{}
+	c.poll = func(target string, port int, req probeRequest) (probeSnapshot, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		collectors[target] = req.collector
+		return probeSnapshot{}, nil
+	}
+	c.run(context.Background(), []string{"free"})
+	if collectors["big"] != collectorXML || collectors["box"] != "" {
+		t.Fatalf("unexpected collectors %v", collectors)
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// GPU vendors reported in GPU.Vendor.
+const (
+	vendorNVIDIA = "nvidia"
+	vendorAMD    = "amd"
+	vendorIntel  = "intel"
+)
+
+// gpuCollector reads every GPU on a host with one vendor's tool and
+// normalizes the result into GPU values.
+type gpuCollector interface {
+	vendor() string
+	// plan returns the probe sections that read the GPUs on host, keyed
+	// target:port, and how to parse their results.
+	plan(host string) probePlan
+}
+
+// gpuTools lists the tools probed on first connect, in order of preference.
+// amd-smi replaces rocm-smi on ROCm 6 but both can be installed.
+var gpuTools = []struct {
+	tool      string
+	collector gpuCollector
+}{
+	{"nvidia-smi", nvidiaCollector{}},
+	{"amd-smi", amdSMICollector{}},
+	{"rocm-smi", rocmSMICollector{}},
+	{"xpu-smi", xpuSMICollector{}},
+}
+
+func gpuToolNames() []string {
+	names := make([]string, len(gpuTools))
+	for i, t := range gpuTools {
+		names[i] = t.tool
+	}
+	return names
+}
+
+// detectCommand prints the name of every installed GPU tool, one per line.
+func detectCommand() string {
+	return "for t in " + strings.Join(gpuToolNames(), " ") + `; do command -v "$t" >/dev/null 2>&1 && echo "$t"; done; true`
+}
+
+// pickGPUCollector returns the preferred collector among the tools that
+// detectCommand found.
+func pickGPUCollector(detected string) (gpuCollector, bool) {
+	found := map[string]bool{}
+	for _, line := range strings.Split(detected, "\n") {
+		found[strings.TrimSpace(line)] = true
+	}
+	for _, t := range gpuTools {
+		if found[t.tool] {
+			return t.collector, true
+		}
+	}
+	return nil, false
+}
+
+// gpuCollectorCache remembers the detected collector per host so detection
+// costs one extra round trip on first connect only.
+type gpuCollectorCache struct {
+	mu         sync.Mutex
+	collectors map[string]gpuCollector
+}
+
+var gpuCollectorsCache = &gpuCollectorCache{collectors: map[string]gpuCollector{}}
+
+func (c *gpuCollectorCache) get(key string) gpuCollector {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.collectors[key]
+}
+
+func (c *gpuCollectorCache) set(key string, collector gpuCollector) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if collector == nil {
+		delete(c.collectors, key)
+		return
+	}
+	c.collectors[key] = collector
+}
+
+var errNoGPUTool = errors.New("no GPU tool found on remote host")
+
+// pollHost detects which GPU tool the host has on first use and then reads
+// it, plus whatever else req asks for, with one probe per poll.
+func pollHost(target string, port int, req probeRequest) (probeSnapshot, error) {
+	if strings.TrimSpace(target) == "" {
+		return probeSnapshot{}, fmt.Errorf("empty target")
+	}
+	if req.collector == collectorXML {
+		return probeHost(target, port, nvidiaXMLCollector{}, req.mounts)
+	}
+	key := target + ":" + strconv.Itoa(port)
+	collector := gpuCollectorsCache.get(key)
+	if collector == nil {
+		out, err := runSSHCommand(target, port, detectCommand())
+		if err != nil {
+			return probeSnapshot{}, err
+		}
+		var ok bool
+		if collector, ok = pickGPUCollector(string(out)); !ok {
+			return probeSnapshot{}, fmt.Errorf("%w (looked for %s)", errNoGPUTool, strings.Join(gpuToolNames(), ", "))
+		}
+		gpuCollectorsCache.set(key, collector)
+	}
+	snap, err := probeHost(target, port, collector, req.mounts)
+	if err != nil && classifyError(err).Code == "nvidia_smi_missing" {
+		// The tool went away, e.g. a driver reinstall; detect again next time.
+		gpuCollectorsCache.set(key, nil)
+	}
+	return snap, err
+}
+
+// queryHostGPUs reads just the GPUs of a host, detecting its tool on first
+// use.
+func queryHostGPUs(target string, port int) ([]GPU, error) {
+	snap, err := pollHost(target, port, probeRequest{})
+	return snap.GPUs, err
+}
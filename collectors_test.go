@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestPickGPUCollector(t *testing.T) {
+	cases := []struct {
+		detected string
+		want     string
+	}{
+		{"nvidia-smi\n", vendorNVIDIA},
+		{"rocm-smi\n", vendorAMD},
+		{"amd-smi\nrocm-smi\n", vendorAMD},
+		{"xpu-smi\n", vendorIntel},
+		{"xpu-smi\nnvidia-smi\n", vendorNVIDIA},
+	}
+	for _, tc := range cases {
+		c, ok := pickGPUCollector(tc.detected)
+		if !ok || c.vendor() != tc.want {
+			t.Errorf("%q: got %v, want %s", tc.detected, c, tc.want)
+		}
+	}
+	if c, _ := pickGPUCollector("amd-smi\nrocm-smi\n"); c != (amdSMICollector{}) {
+		t.Errorf("amd-smi should win over rocm-smi, got %T", c)
+	}
+	if _, ok := pickGPUCollector(""); ok {
+		t.Error("expected no collector when nothing is installed")
+	}
+}
+
+func TestQueryHostGPUsDetectsOnce(t *testing.T) {
+	sshLog, _ := writeFakeSSH(t)
+
+	runs := []int{}
+	for i := 0; i < 2; i++ {
+		gpus, err := queryHostGPUs("gpu-box", 22)
+		if err != nil {
+			t.Fatalf("queryHostGPUs returned error: %v", err)
+		}
+		if len(gpus) != 1 || gpus[0].Vendor != vendorNVIDIA || gpus[0].Util != 97 {
+			t.Fatalf("unexpected gpus: %+v", gpus)
+		}
+		runs = append(runs, len(readLogLines(t, sshLog)))
+	}
+	if n := strings.Count(strings.Join(readLogLines(t, sshLog), "\n"), "command -v"); n != 1 {
+		t.Fatalf("expected one detection round trip, got %d", n)
+	}
+	// Once detection and field probing are done, a poll is one connection.
+	if runs[1]-runs[0] != 1 {
+		t.Fatalf("expected one ssh run per steady-state poll, got %d", runs[1]-runs[0])
+	}
+}
+
+func TestNoGPUToolIsClassified(t *testing.T) {
+	code, _ := classifyConnectionError(fmt.Errorf("%w (looked for nvidia-smi)", errNoGPUTool))
+	if code != "nvidia_smi_missing" {
+		t.Fatalf("got code %q", code)
+	}
+}
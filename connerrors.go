@@ -0,0 +1,271 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"syscall"
+)
+
+// pollError is a classified poll failure: what went wrong, how to fix it,
+// and whether retrying on the normal backoff schedule can help.
+type pollError struct {
+	Code      string
+	Message   string
+	Hint      string
+	Retryable bool
+	Err       error
+}
+
+func (e *pollError) Error() string {
+	if e.Err != nil {
+		return e.Err.Error()
+	}
+	return e.Message
+}
+
+func (e *pollError) Unwrap() error {
+	return e.Err
+}
+
+type errorClass struct {
+	message   string
+	hint      string
+	retryable bool
+}
+
+// errorClasses describes every error code a poll can end with. Codes are
+// shown to the frontend and stored on profiles, so they never change.
+var errorClasses = map[string]errorClass{
+	"auth_failed": {
+		"SSH auth failed. Check key-based access.",
+		"Load your key into ssh-agent or set IdentityFile for this host in ~/.ssh/config, then retry.",
+		false,
+	},
+	"auth_too_many": {
+		"SSH auth failed: too many keys offered.",
+		"The server gave up before ssh reached the right key. Set IdentitiesOnly yes and IdentityFile for this host in ~/.ssh/config.",
+		false,
+	},
+	"host_key": {
+		"SSH host key not trusted. Connect once in terminal to confirm host.",
+		"If the host was reinstalled, remove its old entry with ssh-keygen -R <host> first.",
+		false,
+	},
+	"jump_auth_failed": {
+		"SSH auth to the jump host failed.",
+		"Load the jump host's key into ssh-agent or set IdentityFile for the ProxyJump host in ~/.ssh/config, then retry.",
+		false,
+	},
+	"jump_failed": {
+		"Could not connect through the jump host.",
+		"Check the ProxyJump host in ~/.ssh/config: it may be down, unreachable, or rejecting your key.",
+		true,
+	},
+	"dns": {
+		"Host name could not be resolved. Check host alias and DNS.",
+		"If the name only resolves on a VPN, connect to it first.",
+		true,
+	},
+	"refused": {
+		"Connection refused by host. Check SSH service and port.",
+		"Make sure sshd is running and listening on the configured port.",
+		true,
+	},
+	"reset": {
+		"Connection reset by host.",
+		"The host or a firewall dropped the connection; sshd's MaxStartups or fail2ban can do this under load.",
+		true,
+	},
+	"no_route": {
+		"No route to host. Check network or VPN.",
+		"The host's network is unreachable from this machine; connect to the VPN or check the address.",
+		true,
+	},
+	"timeout": {
+		"Host unreachable. Check network or VPN and try again.",
+		"",
+		true,
+	},
+	"unreachable": {
+		"Could not connect to host. Check host name, port and network.",
+		"Run ssh <host> in a terminal to see ssh's full error.",
+		true,
+	},
+	"interrupted": {
+		"Connection dropped while reading GPUs.",
+		"",
+		true,
+	},
+	"nvidia_smi_missing": {
+		"No GPU tool (nvidia-smi, amd-smi, rocm-smi or xpu-smi) found on remote host.",
+		"Install the GPU driver tools, or make sure they are on PATH for non-interactive shells.",
+		false,
+	},
+	"driver_failed": {
+		"nvidia-smi cannot talk to the NVIDIA driver.",
+		"The driver is not loaded, was updated without a reboot, or a GPU fell off the bus. Check dmesg; a reboot usually fixes it.",
+		false,
+	},
+	"remote_failed": {
+		"GPU query failed on remote host.",
+		"Run the GPU tool on the host to see the full error.",
+		true,
+	},
+	"bad_output": {
+		"Remote host returned GPU data that could not be read.",
+		"",
+		true,
+	},
+	"unknown": {
+		"Connection failed",
+		"",
+		true,
+	},
+}
+
+// newPollError wraps err with code's message, hint and retryability.
+func newPollError(code string, err error) *pollError {
+	c, ok := errorClasses[code]
+	if !ok {
+		code, c = "unknown", errorClasses["unknown"]
+	}
+	return &pollError{Code: code, Message: c.message, Hint: c.hint, Retryable: c.retryable, Err: err}
+}
+
+// classifyError maps err to a pollError by its type: exit status 255 from
+// the ssh binary is a transport failure, any other exit status a failure of
+// the remote command, and native transport errors carry their own stage.
+func classifyError(err error) *pollError {
+	var pollErr *pollError
+	var sshErr *sshError
+	var exitErr *sshExitError
+	var sectionErr *probeSectionError
+	var fieldErr *gpuFieldError
+	switch {
+	case errors.As(err, &pollErr):
+		return pollErr
+	case errors.As(err, &sshErr):
+		return newPollError(classifySSHError(sshErr), err)
+	case errors.As(err, &exitErr):
+		if exitErr.Transport && exitErr.Status == sshTransportStatus {
+			return newPollError(classifySSHOutput(exitErr.Output), err)
+		}
+		return classifyRemoteFailure(exitErr.Status, exitErr.Output, err)
+	case errors.As(err, &sectionErr):
+		if sectionErr.Code < 0 {
+			return newPollError("interrupted", err)
+		}
+		return classifyRemoteFailure(sectionErr.Code, sectionErr.Output, err)
+	case errors.Is(err, errNoGPUTool):
+		return newPollError("nvidia_smi_missing", err)
+	case errors.As(err, &fieldErr):
+		return newPollError("bad_output", err)
+	}
+	e := newPollError("unknown", err)
+	if raw := strings.TrimSpace(err.Error()); raw != "" {
+		e.Message = raw
+	}
+	return e
+}
+
+// classifyConnectionError returns the code and user message for err.
+func classifyConnectionError(err error) (code string, msg string) {
+	e := classifyError(err)
+	return e.Code, e.Message
+}
+
+// classifySSHError maps typed native-transport errors to error codes. Auth
+// and host key failures stop retrying whichever hop they happen on.
+func classifySSHError(err *sshError) string {
+	switch {
+	case err.Kind == sshErrAuth && err.Jump:
+		return "jump_auth_failed"
+	case err.Kind == sshErrAuth:
+		return "auth_failed"
+	case err.Kind == sshErrHostKey:
+		return "host_key"
+	case err.Jump:
+		return "jump_failed"
+	case err.Kind == sshErrTimeout:
+		return "timeout"
+	}
+	var dnsErr *net.DNSError
+	switch {
+	case errors.As(err, &dnsErr):
+		return "dns"
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return "refused"
+	case errors.Is(err, syscall.ECONNRESET):
+		return "reset"
+	case errors.Is(err, syscall.EHOSTUNREACH), errors.Is(err, syscall.ENETUNREACH):
+		return "no_route"
+	default:
+		return "unreachable"
+	}
+}
+
+// sshDiagnostics maps OpenSSH's own messages, which it prints in English
+// because the exec transport runs it with LC_ALL=C, to error codes. Jump
+// host failures come first: they embed the jump's own auth or dial error.
+var sshDiagnostics = []struct {
+	text string
+	code string
+}{
+	{"stdio forwarding failed", "jump_failed"},
+	{"Connection closed by UNKNOWN port 65535", "jump_failed"},
+	{"channel 0: open failed", "jump_failed"},
+	{"Too many authentication failures", "auth_too_many"},
+	{"Permission denied", "auth_failed"},
+	{"Host key verification failed", "host_key"},
+	{"REMOTE HOST IDENTIFICATION HAS CHANGED", "host_key"},
+	{"Could not resolve hostname", "dns"},
+	{"Connection refused", "refused"},
+	{"Connection reset", "reset"},
+	{"No route to host", "no_route"},
+	{"Network is unreachable", "no_route"},
+	{"timed out", "timeout"},
+}
+
+// classifySSHOutput classifies a run where ssh itself failed. A jump host
+// that rejected the key is an auth failure, not a reason to retry.
+func classifySSHOutput(output string) string {
+	for _, d := range sshDiagnostics {
+		if !strings.Contains(output, d.text) {
+			continue
+		}
+		if d.code == "jump_failed" && (strings.Contains(output, "Permission denied") || strings.Contains(output, "Too many authentication failures")) {
+			return "jump_auth_failed"
+		}
+		return d.code
+	}
+	return "unreachable"
+}
+
+// nvidiaDriverFailures are nvidia-smi's messages when NVML cannot reach the
+// driver or a GPU.
+var nvidiaDriverFailures = []string{
+	"couldn't communicate with the NVIDIA driver",
+	"Failed to initialize NVML",
+	"Driver/library version mismatch",
+	"fallen off the bus",
+	"Unable to determine the device handle",
+}
+
+// classifyRemoteFailure classifies a remote command that ran and exited
+// with status. 127 is the shell's "command not found" in every locale.
+func classifyRemoteFailure(status int, output string, err error) *pollError {
+	if status == 127 {
+		return newPollError("nvidia_smi_missing", err)
+	}
+	for _, text := range nvidiaDriverFailures {
+		if strings.Contains(output, text) {
+			return newPollError("driver_failed", err)
+		}
+	}
+	e := newPollError("remote_failed", err)
+	if line, _, _ := strings.Cut(strings.TrimSpace(output), "\n"); line != "" {
+		e.Message += " " + strings.TrimSpace(line)
+	}
+	return e
+}
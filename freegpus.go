@@ -0,0 +1,235 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// freeGPUSnapshotSlack is how much older than its poll interval a
+	// watched connection's data may be before FindFreeGPUs polls the host
+	// again instead.
+	freeGPUSnapshotSlack = 5 * time.Second
+	freeGPUParallelPolls = 8
+)
+
+// FreeGPU is one GPU that satisfies a FindFreeGPUs query.
+type FreeGPU struct {
+	Index     int    `json:"index"`
+	UUID      string `json:"uuid"`
+	Name      string `json:"name"`
+	FreeMiB   int    `json:"freeMiB"`
+	Util      int    `json:"util"`
+	Processes int    `json:"processes"`
+}
+
+// FreeGPUCandidate is a host with enough free GPUs, with the best ones
+// picked.
+type FreeGPUCandidate struct {
+	ProfileID string    `json:"profileId"`
+	Name      string    `json:"name"`
+	Target    string    `json:"target"`
+	GPUs      []FreeGPU `json:"gpus"`
+	// CUDAVisibleDevices lists the picked indices. nvidia-smi numbers GPUs
+	// in PCI bus order, so Env also sets CUDA_DEVICE_ORDER to match.
+	CUDAVisibleDevices string `json:"cudaVisibleDevices"`
+	Env                string `json:"env"`
+	// Cached is set when the data came from a watched connection instead
+	// of a fresh poll.
+	Cached bool `json:"cached"`
+}
+
+// FreeGPUHostError is a saved host that could not be checked.
+type FreeGPUHostError struct {
+	ProfileID string `json:"profileId"`
+	Name      string `json:"name"`
+	Message   string `json:"message"`
+}
+
+// FreeGPUResult is the answer to a FindFreeGPUs query, best host first.
+type FreeGPUResult struct {
+	Candidates  []FreeGPUCandidate `json:"candidates"`
+	Unreachable []FreeGPUHostError `json:"unreachable"`
+}
+
+// freeGPUFetch returns a profile's GPUs and whether they came from cache.
+type freeGPUFetch func(p ConnectionProfile) ([]GPU, bool, error)
+
+// findFreeGPUs checks every profile in parallel and ranks hosts that have
+// at least count GPUs with minFreeMiB free and util at most maxUtil.
+func findFreeGPUs(profiles []ConnectionProfile, fetch freeGPUFetch, minFreeMiB, maxUtil, count int) FreeGPUResult {
+	if count < 1 {
+		count = 1
+	}
+	type outcome struct {
+		gpus   []GPU
+		cached bool
+		err    error
+	}
+	outcomes := make([]outcome, len(profiles))
+	sem := make(chan struct{}, freeGPUParallelPolls)
+	var wg sync.WaitGroup
+	for i, p := range profiles {
+		wg.Add(1)
+		go func(i int, p ConnectionProfile) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			gpus, cached, err := fetch(p)
+			outcomes[i] = outcome{gpus, cached, err}
+		}(i, p)
+	}
+	wg.Wait()
+
+	result := FreeGPUResult{Candidates: []FreeGPUCandidate{}, Unreachable: []FreeGPUHostError{}}
+	for i, p := range profiles {
+		o := outcomes[i]
+		if o.err != nil {
+			_, msg := classifyConnectionError(o.err)
+			result.Unreachable = append(result.Unreachable, FreeGPUHostError{ProfileID: p.ID, Name: p.Name, Message: msg})
+			continue
+		}
+		picked := pickFreeGPUs(o.gpus, minFreeMiB, maxUtil, count)
+		if picked == nil {
+			continue
+		}
+		indices := make([]int, len(picked))
+		for j, g := range picked {
+			indices[j] = g.Index
+		}
+		sort.Ints(indices)
+		devices := joinInts(indices)
+		result.Candidates = append(result.Candidates, FreeGPUCandidate{
+			ProfileID:          p.ID,
+			Name:               p.Name,
+			Target:             p.Target,
+			GPUs:               picked,
+			CUDAVisibleDevices: devices,
+			Env:                "CUDA_DEVICE_ORDER=PCI_BUS_ID CUDA_VISIBLE_DEVICES=" + devices,
+			Cached:             o.cached,
+		})
+	}
+
+	// Hosts whose picked GPUs have the most free memory come first; the
+	// least loaded wins ties.
+	sort.SliceStable(result.Candidates, func(i, j int) bool {
+		fi, ui := freeGPUTotals(result.Candidates[i].GPUs)
+		fj, uj := freeGPUTotals(result.Candidates[j].GPUs)
+		if fi != fj {
+			return fi > fj
+		}
+		if ui != uj {
+			return ui < uj
+		}
+		return result.Candidates[i].Name < result.Candidates[j].Name
+	})
+	return result
+}
+
+// pickFreeGPUs returns the count best GPUs that qualify, or nil when fewer
+// qualify. GPUs with unknown memory or utilization never qualify.
+func pickFreeGPUs(gpus []GPU, minFreeMiB, maxUtil, count int) []FreeGPU {
+	var eligible []FreeGPU
+	for _, g := range gpus {
+		if g.MemTotal < 0 || g.MemUsed < 0 || g.Util < 0 {
+			continue
+		}
+		free := g.MemTotal - g.MemUsed
+		if free < minFreeMiB || g.Util > maxUtil {
+			continue
+		}
+		eligible = append(eligible, FreeGPU{Index: g.Index, UUID: g.UUID, Name: g.Name, FreeMiB: free, Util: g.Util, Processes: len(g.Processes)})
+	}
+	if len(eligible) < count {
+		return nil
+	}
+	sort.SliceStable(eligible, func(i, j int) bool {
+		if eligible[i].FreeMiB != eligible[j].FreeMiB {
+			return eligible[i].FreeMiB > eligible[j].FreeMiB
+		}
+		if eligible[i].Util != eligible[j].Util {
+			return eligible[i].Util < eligible[j].Util
+		}
+		return eligible[i].Index < eligible[j].Index
+	})
+	return eligible[:count]
+}
+
+func freeGPUTotals(gpus []FreeGPU) (free, util int) {
+	for _, g := range gpus {
+		free += g.FreeMiB
+		util += g.Util
+	}
+	return free, util
+}
+
+func joinInts(values []int) string {
+	parts := make([]string, len(values))
+	for i, v := range values {
+		parts[i] = strconv.Itoa(v)
+	}
+	return strings.Join(parts, ",")
+}
+
+// parseMiB parses a memory size such as "20G", "20GB", "512M" or "20480"
+// (MiB) into MiB.
+func parseMiB(raw string) (int, error) {
+	s := strings.TrimSpace(strings.ToUpper(raw))
+	mult := 1.0
+	for _, suffix := range []struct {
+		s    string
+		mult float64
+	}{{"GIB", 1024}, {"GB", 1024}, {"G", 1024}, {"MIB", 1}, {"MB", 1}, {"M", 1}} {
+		if strings.HasSuffix(s, suffix.s) {
+			s, mult = strings.TrimSuffix(s, suffix.s), suffix.mult
+			break
+		}
+	}
+	v, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil || v < 0 {
+		return 0, fmt.Errorf("invalid memory size %q", raw)
+	}
+	return int(v * mult), nil
+}
+
+// pollProfileGPUs reads p's GPUs with the collector the profile selects, so
+// the app and the CLI see the same GPUs as the poll loop.
+func pollProfileGPUs(poll func(target string, port int, req probeRequest) (probeSnapshot, error), p ConnectionProfile) ([]GPU, error) {
+	snap, err := poll(p.Target, p.Port, probeRequest{collector: p.Collector})
+	return snap.GPUs, err
+}
+
+// snapshotMaxAge is how old connection id's data can get between two
+// polls: its interval, or the idle interval when it polls adaptively.
+func (a *App) snapshotMaxAge(id string) time.Duration {
+	interval, adaptive := a.pollSettings(id)
+	if adaptive {
+		interval = max(interval, idlePollInterval)
+	}
+	return interval + freeGPUSnapshotSlack
+}
+
+// FindFreeGPUs looks across all saved profiles for hosts with at least
+// count GPUs that have minFreeMiB of free memory and utilization at most
+// maxUtil percent. Watched connections answer from their latest data; other
+// hosts are polled.
+func (a *App) FindFreeGPUs(minFreeMiB int, maxUtil int, count int) FreeGPUResult {
+	snapshots := map[string]ConnectionSnapshot{}
+	for _, s := range a.GetConnectionSnapshots() {
+		snapshots[s.ID] = s
+	}
+	now := time.Now()
+	fetch := func(p ConnectionProfile) ([]GPU, bool, error) {
+		if s, ok := snapshots[p.ID]; ok && s.Meta.Status == "live" && s.Meta.ActiveTarget == p.Target &&
+			now.Sub(time.Unix(s.Meta.LastSuccessTs, 0)) <= a.snapshotMaxAge(p.ID) {
+			return s.GPUs, true, nil
+		}
+		gpus, err := pollProfileGPUs(a.poll, p)
+		return gpus, false, err
+	}
+	return findFreeGPUs(a.store.snapshot().Profiles, fetch, minFreeMiB, maxUtil, count)
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFindFreeGPUsRanksHosts(t *testing.T) {
+	profiles := []ConnectionProfile{
+		{ID: "a", Name: "alpha", Target: "alpha"},
+		{ID: "b", Name: "beta", Target: "beta"},
+		{ID: "c", Name: "gamma", Target: "gamma"},
+		{ID: "d", Name: "delta", Target: "delta"},
+	}
+	hosts := map[string][]GPU{
+		// Only one GPU qualifies.
+		"alpha": {{Index: 0, Util: 0, MemUsed: 0, MemTotal: 24576}, {Index: 1, Util: 95, MemUsed: 0, MemTotal: 24576}},
+		// Two qualify, 40G free in total.
+		"beta": {{Index: 0, Util: 5, MemUsed: 4096, MemTotal: 24576}, {Index: 1, Util: 0, MemUsed: 4096, MemTotal: 24576}},
+		// Three qualify; the two with the most free memory are picked.
+		"gamma": {{Index: 3, Util: 0, MemUsed: 0, MemTotal: 40960}, {Index: 1, Util: 0, MemUsed: 20000, MemTotal: 40960}, {Index: 0, Util: 2, MemUsed: 0, MemTotal: 40960}, {Index: 2, Util: -1, MemUsed: 0, MemTotal: 40960}},
+	}
+	fetch := func(p ConnectionProfile) ([]GPU, bool, error) {
+		if gpus, ok := hosts[p.Target]; ok {
+			return gpus, p.Target == "beta", nil
+		}
+		return nil, false, sshFailure("ssh: connect to host delta port 22: Connection refused")
+	}
+
+	result := findFreeGPUs(profiles, fetch, 20*1024, 10, 2)
+	if len(result.Candidates) != 2 {
+		t.Fatalf("expected two candidates, got %+v", result.Candidates)
+	}
+	best := result.Candidates[0]
+	if best.Name != "gamma" || best.CUDAVisibleDevices != "0,3" || best.GPUs[0].Index != 3 {
+		t.Fatalf("unexpected best candidate %+v", best)
+	}
+	if best.Env != "CUDA_DEVICE_ORDER=PCI_BUS_ID CUDA_VISIBLE_DEVICES=0,3" {
+		t.Fatalf("unexpected env %q", best.Env)
+	}
+	if second := result.Candidates[1]; second.Name != "beta" || !second.Cached || second.CUDAVisibleDevices != "0,1" {
+		t.Fatalf("unexpected second candidate %+v", second)
+	}
+	if len(result.Unreachable) != 1 || result.Unreachable[0].Name != "delta" || !strings.HasPrefix(result.Unreachable[0].Message, "Connection refused") {
+		t.Fatalf("unexpected unreachable %+v", result.Unreachable)
+	}
+}
+
+func TestFindFreeGPUsUsesFreshSnapshots(t *testing.T) {
+	var mu sync.Mutex
+	polled := map[string]int{}
+	a, _ := newTestApp(func(target string, port int) ([]GPU, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		polled[target]++
+		return []GPU{{Index: 0, Util: 0, MemUsed: 0, MemTotal: 8192}}, nil
+	})
+	for _, p := range []ConnectionProfile{
+		{ID: "watched", Target: "watched"},
+		{ID: "cold", Target: "cold"},
+		{ID: "slow", Target: "slow", PollIntervalSec: 60},
+		{ID: "behind", Target: "behind"},
+	} {
+		p.Name, p.Port = p.Target, 22
+		if _, err := a.SaveProfile(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Replace the workers saving started with ones holding known data.
+	stopTestWorkers(a)
+	clear(polled)
+	// Data is fresh while it is no older than the profile's poll interval.
+	for id, age := range map[string]time.Duration{"watched": 0, "slow": 45 * time.Second, "behind": 45 * time.Second} {
+		w := newConnectionWorker(id, id, 22)
+		w.meta = ConnectionMeta{Status: "live", ActiveTarget: id, LastSuccessTs: time.Now().Add(-age).Unix()}
+		w.gpus = []GPU{{Index: 0, Util: 0, MemUsed: 0, MemTotal: 8192}}
+		a.workers[id] = w
+	}
+
+	result := a.FindFreeGPUs(1024, 10, 1)
+	if len(result.Candidates) != 4 || polled["watched"] != 0 || polled["slow"] != 0 || polled["cold"] != 1 || polled["behind"] != 1 {
+		t.Fatalf("expected only the cold and stale hosts to be polled, got %v and %+v", polled, result.Candidates)
+	}
+}
+
+func TestParseMiB(t *testing.T) {
+	cases := map[string]int{"20G": 20480, "20gb": 20480, "1.5GiB": 1536, "512M": 512, "2048": 2048}
+	for in, want := range cases {
+		if got, err := parseMiB(in); err != nil || got != want {
+			t.Errorf("parseMiB(%q) = %d, %v; want %d", in, got, err, want)
+		}
+	}
+	if _, err := parseMiB("-1G"); err == nil {
+		t.Error("expected error for negative size")
+	}
+}
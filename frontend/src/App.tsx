@@ -2,18 +2,27 @@ import { useEffect, useMemo, useState } from 'react'
 import { EventsOn } from '../wailsjs/runtime/runtime'
 import {
   CheckForUpdate,
+  DeleteProfile,
   DoUpdate,
+  GetActiveProfileID,
+  GetConnectionSnapshots,
+  GetDisplayMode,
   HideWindow,
+  ImportLegacyProfiles,
+  ListProfiles,
+  ListSSHConfigConnections,
   Quit,
   RetryConnection,
-  SetConnection,
+  SaveProfile,
+  SetActiveProfile,
+  SetDisplayMode,
   TestConnection,
-  UpdateTrayData,
-  UpdateTrayTitle,
 } from '../wailsjs/go/main/App'
 
 import { GpuCard, type GpuData } from './components/gpu-card'
-import { formatTrayTitle, type MenuBarDisplayMode } from './components/menu-bar-item'
+import { HostCard, type HostStats } from './components/host-card'
+import { type MenuBarDisplayMode } from './components/menu-bar-item'
+import { SshHostPicker, type SshConfigHost } from './components/ssh-host-picker'
 import { StatusBadge, type ConnectionStatus } from './components/status-indicator'
 import { Button } from './components/ui/button'
 import { Input } from './components/ui/input'
@@ -34,15 +43,23 @@ interface ConnectionProfile {
   lastTestStatus: LastTestStatus
   lastErrorCode?: string
   lastErrorMessage?: string
+  collector?: string
+  hostMetrics?: boolean
+  mounts?: string[]
+  pollIntervalSec?: number
+  adaptivePolling?: boolean
 }
 
 interface ConnectionMeta {
+  connectionId?: string
   status: ConnectionStatus
   lastSuccessTs: number
   consecutiveFailures: number
   nextRetryInSec: number
   errorCode: string
   errorMessage: string
+  errorHint: string
+  pollState: string
   activeTarget: string
   activePort: number
 }
@@ -53,7 +70,7 @@ interface UpdateInfo {
   url: string
 }
 
-const STORAGE_VERSION = '2'
+const STORAGE_VERSION = '4'
 const STORAGE_VERSION_KEY = 'nvSmiStorageVersion'
 const STORAGE_CONNECTIONS_KEY = 'nvSmiV2Connections'
 const STORAGE_ACTIVE_CONNECTION_ID_KEY = 'nvSmiV2ActiveConnectionId'
@@ -68,6 +85,8 @@ const MODE_OPTIONS: { id: MenuBarDisplayMode; label: string; description: string
   { id: 'multi', label: 'Multi GPU', description: 'All GPUs side by side.' },
 ]
 
+const POLL_INTERVALS = [1, 2, 5, 10, 30]
+
 const EMPTY_META: ConnectionMeta = {
   status: 'idle',
   lastSuccessTs: 0,
@@ -75,22 +94,26 @@ const EMPTY_META: ConnectionMeta = {
   nextRetryInSec: 0,
   errorCode: '',
   errorMessage: '',
+  errorHint: '',
+  pollState: '',
   activeTarget: '',
   activePort: 0,
 }
 
-function readJson<T>(key: string, fallback: T): T {
-  try {
-    const value = localStorage.getItem(key)
-    if (!value) return fallback
-    return JSON.parse(value) as T
-  } catch {
-    return fallback
+// Since storage version 3 profiles live in the Go store. Profiles still in
+// localStorage are handed to the backend for migration instead of dropped.
+async function migrateStorage() {
+  if (localStorage.getItem(STORAGE_VERSION_KEY) === STORAGE_VERSION) return
+
+  const legacyConnections = localStorage.getItem(STORAGE_CONNECTIONS_KEY)
+  if (legacyConnections) {
+    await ImportLegacyProfiles(legacyConnections, localStorage.getItem(STORAGE_ACTIVE_CONNECTION_ID_KEY) ?? '')
   }
-}
 
-function migrateStorage() {
-  if (localStorage.getItem(STORAGE_VERSION_KEY) === STORAGE_VERSION) return
+  const legacyDisplayMode = localStorage.getItem(STORAGE_DISPLAY_MODE_KEY)
+  if (legacyDisplayMode) {
+    await SetDisplayMode(legacyDisplayMode).catch(() => {})
+  }
 
   localStorage.removeItem('nvSmiHost')
   localStorage.removeItem('nvSmiSettings')
@@ -101,8 +124,17 @@ function migrateStorage() {
   localStorage.setItem(STORAGE_VERSION_KEY, STORAGE_VERSION)
 }
 
-function createProfileId() {
-  return `conn_${Date.now()}_${Math.random().toString(36).slice(2, 9)}`
+function toConnectionProfile(profile: Omit<ConnectionProfile, 'lastUsedAt' | 'source' | 'lastTestStatus'> & {
+  lastUsedAt: number
+  source: string
+  lastTestStatus: string
+}): ConnectionProfile {
+  return {
+    ...profile,
+    source: profile.source as ProfileSource,
+    lastTestStatus: profile.lastTestStatus as LastTestStatus,
+    lastUsedAt: profile.lastUsedAt || null,
+  }
 }
 
 function formatRelative(ts: number | null): string {
@@ -114,19 +146,16 @@ function formatRelative(ts: number | null): string {
 }
 
 export default function App() {
-  migrateStorage()
-
   const [gpus, setGpus] = useState<GpuData[]>([])
+  const [hostStats, setHostStats] = useState<HostStats | null>(null)
   const [connMeta, setConnMeta] = useState<ConnectionMeta>(EMPTY_META)
   const [inlineError, setInlineError] = useState('')
 
-  const [connections, setConnections] = useState<ConnectionProfile[]>(() => readJson(STORAGE_CONNECTIONS_KEY, []))
-  const [activeConnectionId, setActiveConnectionId] = useState<string | null>(() => localStorage.getItem(STORAGE_ACTIVE_CONNECTION_ID_KEY))
+  const [connections, setConnections] = useState<ConnectionProfile[]>([])
+  const [activeConnectionId, setActiveConnectionId] = useState<string | null>(null)
+  const [profilesLoaded, setProfilesLoaded] = useState(false)
 
-  const [displayMode, setDisplayMode] = useState<MenuBarDisplayMode>(() => {
-    const saved = localStorage.getItem(STORAGE_DISPLAY_MODE_KEY)
-    return (saved as MenuBarDisplayMode) || 'graphic'
-  })
+  const [displayMode, setDisplayMode] = useState<MenuBarDisplayMode>('graphic')
 
   const [updateInfo, setUpdateInfo] = useState<UpdateInfo | null>(null)
   const [updateStatus, setUpdateStatus] = useState<'idle' | 'updating' | 'done' | 'opened'>('idle')
@@ -135,6 +164,7 @@ export default function App() {
   const [settingsOpen, setSettingsOpen] = useState(false)
   const [miniHostInput, setMiniHostInput] = useState('')
   const [isMiniConnecting, setIsMiniConnecting] = useState(false)
+  const [sshHosts, setSshHosts] = useState<SshConfigHost[]>([])
   const [updateCheckStatus, setUpdateCheckStatus] = useState<'idle' | 'checking' | 'done'>('idle')
 
   const [, forceClock] = useState(0)
@@ -152,29 +182,26 @@ export default function App() {
   }, [])
 
   useEffect(() => {
-    localStorage.setItem(STORAGE_CONNECTIONS_KEY, JSON.stringify(connections))
-  }, [connections])
-
-  useEffect(() => {
-    if (activeConnectionId) {
-      localStorage.setItem(STORAGE_ACTIVE_CONNECTION_ID_KEY, activeConnectionId)
-    } else {
-      localStorage.removeItem(STORAGE_ACTIVE_CONNECTION_ID_KEY)
-    }
-  }, [activeConnectionId])
-
-  useEffect(() => {
-    localStorage.setItem(STORAGE_DISPLAY_MODE_KEY, displayMode)
-  }, [displayMode])
+    migrateStorage()
+      .catch(() => {})
+      .then(() => Promise.all([ListProfiles(), GetActiveProfileID(), GetDisplayMode()]))
+      .then(([profiles, activeId, mode]) => {
+        setConnections((profiles ?? []).map(toConnectionProfile))
+        setActiveConnectionId(activeId || null)
+        setDisplayMode(mode as MenuBarDisplayMode)
+      })
+      .finally(() => setProfilesLoaded(true))
+  }, [])
 
   useEffect(() => {
-    const offData = EventsOn('gpu:data', (payload: GpuData[]) => {
-      setGpus(payload)
-      setInlineError('')
-      if (activeConnectionId) {
+    // Every saved profile is polled, so profile statuses follow all
+    // connections while the readout only shows the active one.
+    const offData = EventsOn('gpu:data', (payload: GpuData[], connectionId?: string) => {
+      const id = connectionId || activeConnectionId
+      if (id) {
         setConnections(prev =>
           prev.map(profile =>
-            profile.id === activeConnectionId
+            profile.id === id
               ? {
                   ...profile,
                   lastUsedAt: Date.now(),
@@ -186,14 +213,22 @@ export default function App() {
           ),
         )
       }
+      if (connectionId && connectionId !== activeConnectionId) return
+      setGpus(payload)
+      setInlineError('')
     })
 
-    const offError = EventsOn('gpu:error', (message: string) => {
-      setInlineError(message)
-      if (activeConnectionId) {
+    const offHost = EventsOn('gpu:host', (payload: HostStats | null, connectionId?: string) => {
+      if (connectionId && connectionId !== activeConnectionId) return
+      setHostStats(payload)
+    })
+
+    const offError = EventsOn('gpu:error', (message: string, connectionId?: string) => {
+      const id = connectionId || activeConnectionId
+      if (id) {
         setConnections(prev =>
           prev.map(profile =>
-            profile.id === activeConnectionId
+            profile.id === id
               ? {
                   ...profile,
                   lastTestStatus: 'failed',
@@ -204,9 +239,12 @@ export default function App() {
           ),
         )
       }
+      if (connectionId && connectionId !== activeConnectionId) return
+      setInlineError(message)
     })
 
-    const offMeta = EventsOn('gpu:conn_meta', (meta: ConnectionMeta) => {
+    const offMeta = EventsOn('gpu:conn_meta', (meta: ConnectionMeta, connectionId?: string) => {
+      if (connectionId && connectionId !== activeConnectionId) return
       setConnMeta(meta)
     })
 
@@ -218,6 +256,7 @@ export default function App() {
 
     return () => {
       offData()
+      offHost()
       offError()
       offMeta()
       offUpdate()
@@ -233,20 +272,9 @@ export default function App() {
   }, [])
 
   useEffect(() => {
-    const status = connMeta.status || 'idle'
-    if (displayMode === 'graphic' && gpus.length > 0 && (status === 'live' || status === 'stale')) {
-      const g = gpus[0]
-      UpdateTrayData(g.temp, g.util, g.memUsed, g.memTotal, status)
-    } else if (displayMode === 'graphic') {
-      UpdateTrayData(0, 0, 0, 0, status)
-    } else {
-      UpdateTrayTitle(formatTrayTitle(gpus, status, displayMode))
-    }
-  }, [gpus, connMeta.status, displayMode])
-
-  useEffect(() => {
+    if (!profilesLoaded) return
     if (!activeConnection) {
-      SetConnection('', 0)
+      SetActiveProfile('')
       setConnMeta(EMPTY_META)
       return
     }
@@ -259,8 +287,30 @@ export default function App() {
     }))
     setInlineError('')
     setGpus([])
-    SetConnection(activeConnection.target, activeConnection.port)
-  }, [activeConnection?.id, activeConnection?.target, activeConnection?.port])
+    setHostStats(null)
+    // The profile kept polling while another one was shown; pick up its
+    // latest data instead of waiting for the next poll.
+    const id = activeConnection.id
+    SetActiveProfile(id)
+      .then(() => GetConnectionSnapshots())
+      .then(snapshots => {
+        const snap = snapshots?.find(s => s.id === id)
+        if (!snap || snap.meta.status === 'connecting') return
+        setConnMeta(snap.meta as ConnectionMeta)
+        setGpus((snap.gpus ?? []) as GpuData[])
+        setHostStats((snap.host ?? null) as HostStats | null)
+        setInlineError(snap.meta.status === 'error' ? snap.meta.errorMessage : '')
+      })
+      .catch(() => {})
+  }, [profilesLoaded, activeConnection?.id, activeConnection?.target, activeConnection?.port])
+
+  // Re-read ~/.ssh/config whenever the settings panel opens.
+  useEffect(() => {
+    if (!settingsOpen) return
+    ListSSHConfigConnections()
+      .then(hosts => setSshHosts(hosts ?? []))
+      .catch(() => setSshHosts([]))
+  }, [settingsOpen])
 
   // Sync miniHostInput with active connection
   useEffect(() => {
@@ -304,21 +354,25 @@ export default function App() {
     setIsMiniConnecting(true)
     try {
       const result = await TestConnection(target, port)
-      const profileId = createProfileId()
-      const profile: ConnectionProfile = {
-        id: profileId,
+      const saved = await SaveProfile({
+        id: '',
         name: target,
         target,
         port,
-        source: 'manual',
-        lastUsedAt: result.success ? Date.now() : null,
+        source: sshHosts.some(h => h.target === target) ? 'ssh_config' : 'manual',
+        lastUsedAt: result.success ? Date.now() : 0,
         lastTestStatus: result.success ? 'success' : 'failed',
         lastErrorCode: result.success ? '' : result.code,
         lastErrorMessage: result.success ? '' : result.message,
-      }
-      setConnections(prev => [profile, ...prev])
+        collector: '',
+        hostMetrics: false,
+        mounts: [],
+        pollIntervalSec: 0,
+        adaptivePolling: false,
+      })
+      setConnections(prev => [toConnectionProfile(saved), ...prev])
       if (result.success) {
-        setActiveConnectionId(profileId)
+        setActiveConnectionId(saved.id)
         setSettingsOpen(false)
       }
     } finally {
@@ -339,11 +393,52 @@ export default function App() {
     }
   }
 
+  async function updateProfile(profile: ConnectionProfile, changes: Pick<ConnectionProfile, 'collector' | 'hostMetrics' | 'mounts' | 'pollIntervalSec' | 'adaptivePolling'>) {
+    const saved = await SaveProfile({
+      ...profile,
+      lastUsedAt: profile.lastUsedAt ?? 0,
+      lastErrorCode: profile.lastErrorCode ?? '',
+      lastErrorMessage: profile.lastErrorMessage ?? '',
+      collector: profile.collector ?? '',
+      hostMetrics: profile.hostMetrics ?? false,
+      mounts: profile.mounts ?? [],
+      pollIntervalSec: profile.pollIntervalSec ?? 0,
+      adaptivePolling: profile.adaptivePolling ?? false,
+      ...changes,
+    })
+    setConnections(prev => prev.map(p => (p.id === saved.id ? toConnectionProfile(saved) : p)))
+  }
+
+  // Switches a profile between the nvidia-smi query and XML collectors.
+  function handleToggleCollector(profile: ConnectionProfile) {
+    return updateProfile(profile, { collector: profile.collector === 'xml' ? 'query' : 'xml' })
+  }
+
+  // Turns the CPU/RAM/disk/network readout on or off for a profile.
+  function handleToggleHostMetrics(profile: ConnectionProfile) {
+    if (profile.hostMetrics && profile.id === activeConnectionId) setHostStats(null)
+    return updateProfile(profile, { hostMetrics: !profile.hostMetrics })
+  }
+
+  // Steps a profile through the poll interval presets.
+  function handleCycleInterval(profile: ConnectionProfile) {
+    const current = profile.pollIntervalSec || 1
+    const next = POLL_INTERVALS[(POLL_INTERVALS.indexOf(current) + 1) % POLL_INTERVALS.length]
+    return updateProfile(profile, { pollIntervalSec: next === 1 ? 0 : next })
+  }
+
+  // Adaptive polling slows down while hidden and idle.
+  function handleToggleAdaptive(profile: ConnectionProfile) {
+    return updateProfile(profile, { adaptivePolling: !profile.adaptivePolling })
+  }
+
   function handleDelete(profileId: string) {
+    DeleteProfile(profileId)
     setConnections(prev => prev.filter(profile => profile.id !== profileId))
     if (activeConnectionId === profileId) {
       setActiveConnectionId(null)
       setGpus([])
+      setHostStats(null)
       setConnMeta(EMPTY_META)
     }
   }
@@ -407,6 +502,13 @@ export default function App() {
             </div>
           </div>
 
+          {/* SSH config aliases, with what ssh will actually use */}
+          <SshHostPicker
+            hosts={sshHosts}
+            selected={miniHostInput}
+            onPick={host => setMiniHostInput(host.port === 22 ? host.target : `${host.target}:${host.port}`)}
+          />
+
           {/* Saved connections list */}
           {hasConnections && (
             <div className='space-y-0.5'>
@@ -426,6 +528,46 @@ export default function App() {
                       {profile.name}{profile.port !== 22 ? `:${profile.port}` : ''}
                     </span>
                   </button>
+                  <button
+                    className={cn(
+                      'shrink-0 rounded px-1 py-0.5 text-[9px] font-medium hover:bg-accent',
+                      profile.collector === 'xml' ? 'text-primary' : 'text-muted-foreground',
+                    )}
+                    title='Read GPUs with nvidia-smi -q -x (MIG, retired pages)'
+                    onClick={e => { e.stopPropagation(); handleToggleCollector(profile).catch(() => {}) }}
+                  >
+                    XML
+                  </button>
+                  <button
+                    className={cn(
+                      'shrink-0 rounded px-1 py-0.5 text-[9px] font-medium hover:bg-accent',
+                      profile.hostMetrics ? 'text-primary' : 'text-muted-foreground',
+                    )}
+                    title='Show host CPU, memory, disk and network next to the GPUs'
+                    onClick={e => { e.stopPropagation(); handleToggleHostMetrics(profile).catch(() => {}) }}
+                  >
+                    HOST
+                  </button>
+                  <button
+                    className={cn(
+                      'shrink-0 rounded px-1 py-0.5 text-[9px] font-medium hover:bg-accent',
+                      (profile.pollIntervalSec ?? 0) > 1 ? 'text-primary' : 'text-muted-foreground',
+                    )}
+                    title='Poll interval'
+                    onClick={e => { e.stopPropagation(); handleCycleInterval(profile).catch(() => {}) }}
+                  >
+                    {profile.pollIntervalSec || 1}s
+                  </button>
+                  <button
+                    className={cn(
+                      'shrink-0 rounded px-1 py-0.5 text-[9px] font-medium hover:bg-accent',
+                      profile.adaptivePolling ? 'text-primary' : 'text-muted-foreground',
+                    )}
+                    title='Adaptive polling: every 15s while hidden and idle'
+                    onClick={e => { e.stopPropagation(); handleToggleAdaptive(profile).catch(() => {}) }}
+                  >
+                    AUTO
+                  </button>
                   <button
                     className='shrink-0 rounded p-1 text-muted-foreground hover:bg-accent hover:text-foreground'
                     onClick={e => { e.stopPropagation(); handleDelete(profile.id) }}
@@ -450,7 +592,10 @@ export default function App() {
                       ? 'bg-primary text-primary-foreground'
                       : 'bg-secondary text-secondary-foreground hover:bg-accent',
                   )}
-                  onClick={() => setDisplayMode(option.id)}
+                  onClick={() => {
+                    setDisplayMode(option.id)
+                    SetDisplayMode(option.id).catch(() => {})
+                  }}
                 >
                   {option.label}
                 </button>
@@ -499,6 +644,7 @@ export default function App() {
               <AlertTriangle className='mt-0.5 h-3.5 w-3.5 shrink-0' />
               <div>
                 <p>{connMeta.errorMessage || inlineError}</p>
+                {connMeta.errorHint && <p className='mt-0.5 text-red-300/70'>{connMeta.errorHint}</p>}
                 <button className='mt-1 text-red-400 underline underline-offset-2 hover:text-red-300' onClick={() => RetryConnection()}>
                   Retry now
                 </button>
@@ -514,6 +660,13 @@ export default function App() {
             </div>
           )}
 
+          {/* Paused banner */}
+          {connMeta.pollState === 'paused' && (
+            <div className='rounded-md border border-border bg-muted/40 px-2 py-2 text-[11px] text-muted-foreground'>
+              <p>Polling paused while the system sleeps or runs low on battery.</p>
+            </div>
+          )}
+
           {/* Idle empty state */}
           {connMeta.status === 'idle' && gpus.length === 0 && (
             <div className='flex flex-col items-center gap-3 rounded-md border border-dashed px-3 py-8'>
@@ -538,6 +691,9 @@ export default function App() {
             </div>
           )}
 
+          {/* Host metrics */}
+          {hostStats && gpus.length > 0 && <HostCard host={hostStats} />}
+
           {/* GPU cards */}
           {gpus.map(gpu => (
             <GpuCard key={gpu.index} gpu={gpu} />
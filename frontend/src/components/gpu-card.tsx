@@ -4,7 +4,17 @@ import { useMemo, useState } from 'react'
 import { MetricBar } from './metric-bar'
 import { cn } from './ui/utils'
 
+export interface GpuProcess {
+  gpuUuid: string
+  pid: number
+  processName: string
+  usedMemory: number
+  user: string
+  command: string
+}
+
 export interface GpuData {
+  vendor?: string
   index: number
   name: string
   util: number
@@ -16,6 +26,42 @@ export interface GpuData {
   powerLimit: number
   driverVersion?: string
   cudaVersion?: string
+  uuid?: string
+  pciBusId?: string
+  pstate?: string
+  clockSm?: number
+  clockMaxSm?: number
+  throttleReasons?: string[]
+  eccUncorrected?: number
+  pcieGen?: number
+  pcieWidth?: number
+  encoderUtil?: number
+  decoderUtil?: number
+  migMode?: string
+  migDevices?: { index: number; gpuInstanceId: number }[]
+  retiredPagesSbe?: number
+  retiredPagesDbe?: number
+  retiredPagesPending?: boolean
+  remappedRowsPending?: boolean
+  processes?: GpuProcess[]
+}
+
+// gpuDetails lists the optional nvidia-smi fields the host reported.
+function gpuDetails(gpu: GpuData): string[] {
+  const known = (v?: number) => v !== undefined && v >= 0
+  const retired = Math.max(gpu.retiredPagesSbe ?? 0, 0) + Math.max(gpu.retiredPagesDbe ?? 0, 0)
+  return [
+    gpu.pstate && gpu.pstate,
+    known(gpu.clockSm) && `SM ${gpu.clockSm}${known(gpu.clockMaxSm) ? `/${gpu.clockMaxSm}` : ''} MHz`,
+    known(gpu.pcieGen) && `PCIe ${gpu.pcieGen}${known(gpu.pcieWidth) ? ` x${gpu.pcieWidth}` : ''}`,
+    (known(gpu.encoderUtil) || known(gpu.decoderUtil)) &&
+      `Enc ${known(gpu.encoderUtil) ? gpu.encoderUtil : '--'}% / Dec ${known(gpu.decoderUtil) ? gpu.decoderUtil : '--'}%`,
+    known(gpu.eccUncorrected) && `ECC ${gpu.eccUncorrected}`,
+    gpu.migMode === 'Enabled' && (gpu.migDevices?.length ? `MIG ×${gpu.migDevices.length}` : 'MIG'),
+    retired > 0 && `Retired pages ${retired}`,
+    (gpu.retiredPagesPending || gpu.remappedRowsPending) && 'Reset pending',
+    gpu.throttleReasons?.length && `Throttle: ${gpu.throttleReasons.join(', ')}`,
+  ].filter((d): d is string => typeof d === 'string' && d !== '')
 }
 
 function tempColor(temp: number) {
@@ -118,12 +164,38 @@ export function GpuCard({ gpu }: { gpu: GpuData }) {
             <MetricBar label='Power' value={gpu.powerDraw} max={gpu.powerLimit} unit='W' thresholds={{ warn: 80, critical: 95 }} />
           </div>
 
+          {gpu.processes && gpu.processes.length > 0 && (
+            <div className='space-y-1 border-t pt-2'>
+              <p className='text-[10px] uppercase tracking-wider text-muted-foreground'>Processes</p>
+              <table className='w-full table-fixed text-[10px]'>
+                <tbody>
+                  {gpu.processes.map(proc => (
+                    <tr key={proc.pid} title={proc.command || proc.processName}>
+                      <td className='w-12 font-mono text-muted-foreground'>{proc.pid}</td>
+                      <td className='w-16 truncate'>{proc.user || '--'}</td>
+                      <td className='truncate text-muted-foreground'>{proc.command || proc.processName}</td>
+                      <td className='w-16 text-right font-mono'>{fmtVal(proc.usedMemory, ' MiB')}</td>
+                    </tr>
+                  ))}
+                </tbody>
+              </table>
+            </div>
+          )}
+
           {(gpu.driverVersion || gpu.cudaVersion) && (
             <div className='flex items-center gap-3 border-t pt-2 text-[10px] text-muted-foreground'>
               {gpu.driverVersion && <span>Driver {gpu.driverVersion}</span>}
               {gpu.cudaVersion && <span>CUDA {gpu.cudaVersion}</span>}
             </div>
           )}
+
+          {gpuDetails(gpu).length > 0 && (
+            <div className='flex flex-wrap items-center gap-x-3 gap-y-1 text-[10px] text-muted-foreground'>
+              {gpuDetails(gpu).map((d) => (
+                <span key={d}>{d}</span>
+              ))}
+            </div>
+          )}
         </div>
       )}
     </div>
@@ -0,0 +1,65 @@
+import { Cpu } from 'lucide-react'
+import { MetricBar } from './metric-bar'
+
+export interface DiskUsage {
+  mount: string
+  used: number
+  total: number
+}
+
+export interface HostStats {
+  load1: number
+  load5: number
+  load15: number
+  cpuCount: number
+  cpuUtil: number
+  cpuIowait: number
+  memUsed: number
+  memTotal: number
+  swapUsed: number
+  swapTotal: number
+  netRxBps: number
+  netTxBps: number
+  disks: DiskUsage[]
+}
+
+const THRESHOLDS = { warn: 75, critical: 90 }
+
+function fmtRate(bps: number) {
+  if (bps < 0) return '--'
+  if (bps >= 1 << 20) return `${(bps / (1 << 20)).toFixed(1)} MiB/s`
+  if (bps >= 1 << 10) return `${(bps / (1 << 10)).toFixed(0)} KiB/s`
+  return `${Math.round(bps)} B/s`
+}
+
+const gib = (mib: number) => Math.round(mib / 1024)
+
+export function HostCard({ host }: { host: HostStats }) {
+  return (
+    <div className='space-y-2.5 rounded-lg border bg-card px-3 py-3'>
+      <div className='flex items-center gap-2 text-xs font-medium text-card-foreground'>
+        <Cpu className='h-3.5 w-3.5 text-muted-foreground' />
+        <span>Host</span>
+        <span className='ml-auto font-mono text-[10px] text-muted-foreground'>
+          load {host.load1.toFixed(2)} {host.load5.toFixed(2)} {host.load15.toFixed(2)}
+          {host.cpuCount > 0 && ` · ${host.cpuCount} CPUs`}
+        </span>
+      </div>
+      <MetricBar label='CPU' value={host.cpuUtil < 0 ? -1 : Math.round(host.cpuUtil)} max={100} unit='%' thresholds={THRESHOLDS} />
+      {host.cpuIowait >= 5 && (
+        <p className='text-[10px] text-amber-300'>I/O wait {host.cpuIowait.toFixed(1)}%</p>
+      )}
+      <MetricBar label='RAM' value={gib(host.memUsed)} max={gib(host.memTotal)} unit=' GiB' thresholds={THRESHOLDS} />
+      {host.swapTotal > 0 && host.swapUsed > 0 && (
+        <MetricBar label='Swap' value={gib(host.swapUsed)} max={gib(host.swapTotal)} unit=' GiB' thresholds={THRESHOLDS} />
+      )}
+      {host.disks.map(disk => (
+        <MetricBar key={disk.mount} label={`Disk ${disk.mount}`} value={gib(disk.used)} max={gib(disk.total)} unit=' GiB' thresholds={THRESHOLDS} />
+      ))}
+      <div className='flex justify-between font-mono text-[10px] text-muted-foreground'>
+        <span>↓ {fmtRate(host.netRxBps)}</span>
+        <span>↑ {fmtRate(host.netTxBps)}</span>
+      </div>
+    </div>
+  )
+}
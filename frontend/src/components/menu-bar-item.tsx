@@ -257,45 +257,3 @@ export function MenuBarDropdownPopup({
     </div>
   )
 }
-
-export function formatTrayTitle(
-  gpus: GpuData[],
-  status: ConnectionStatus,
-  mode: MenuBarDisplayMode = 'standard',
-): string {
-  if (status === 'idle') return 'NVSmiBar'
-  if (status === 'connecting') return 'NV ···'
-  if (status === 'error') return 'NV ⚠'
-  const g = gpus[0]
-  if (!g) return 'NV ···'
-
-  const memPct = g.memTotal > 0 ? Math.round((g.memUsed / g.memTotal) * 100) : 0
-  const powerPct = g.powerLimit > 0 ? Math.round((Math.max(g.powerDraw, 0) / g.powerLimit) * 100) : 0
-
-  let value = ''
-  switch (mode) {
-    case 'minimal':
-      value = `${g.temp}°`
-      break
-    case 'compact':
-      value = `${g.temp}° · ${g.util}%`
-      break
-    case 'standard':
-      value = `${g.temp}° · ${g.util}% · ${vramGB(g.memUsed)}G`
-      break
-    case 'spark':
-      value = `${sparkChar(g.util)}${sparkChar(memPct)}${sparkChar(powerPct)} ${g.temp}°`
-      break
-    case 'multi':
-      value = gpus.map(gpu => `G${gpu.index}:${gpu.temp}°·${gpu.util}%`).join(' │ ')
-      break
-    case 'graphic':
-      value = `${g.temp}° · ${g.util}% | ${vramGB(g.memUsed)}/${vramGB(g.memTotal)}G`
-      break
-  }
-
-  if (status === 'stale') {
-    return `${value} !`
-  }
-  return value
-}
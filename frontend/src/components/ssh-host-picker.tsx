@@ -0,0 +1,56 @@
+import { cn } from './ui/utils'
+
+// SshConfigHost is a ~/.ssh/config alias with the values ssh will actually
+// use for it, resolved by the backend.
+export interface SshConfigHost {
+  name: string
+  target: string
+  port: number
+  hostName: string
+  user: string
+  proxyJump: string
+  identityFiles: string[]
+}
+
+// Shows where an alias really connects: user@hostname:port, the jump host
+// and the identity files.
+export function ResolvedHostDetails({ host }: { host: SshConfigHost }) {
+  const hostName = host.hostName || host.target
+  return (
+    <div className='space-y-0.5 font-mono text-[10px] text-muted-foreground'>
+      <p className='truncate'>
+        {host.user ? `${host.user}@` : ''}{hostName}:{host.port || 22}
+      </p>
+      {host.proxyJump && <p className='truncate'>via {host.proxyJump}</p>}
+      {host.identityFiles?.length > 0 && (
+        <p className='truncate' title={host.identityFiles.join('\n')}>key {host.identityFiles.join(', ')}</p>
+      )}
+    </div>
+  )
+}
+
+export function SshHostPicker({ hosts, selected, onPick }: {
+  hosts: SshConfigHost[]
+  selected: string
+  onPick: (host: SshConfigHost) => void
+}) {
+  if (hosts.length === 0) return null
+  return (
+    <div className='space-y-0.5'>
+      <label className='text-[10px] uppercase tracking-wider text-muted-foreground'>From ~/.ssh/config</label>
+      {hosts.map(host => (
+        <button
+          key={host.name}
+          className={cn(
+            'block w-full rounded px-2 py-1 text-left hover:bg-accent',
+            selected === host.target && 'bg-accent',
+          )}
+          onClick={() => onPick(host)}
+        >
+          <span className='block truncate text-xs text-foreground'>{host.name}</span>
+          <ResolvedHostDetails host={host} />
+        </button>
+      ))}
+    </div>
+  )
+}
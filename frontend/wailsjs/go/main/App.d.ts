@@ -4,30 +4,84 @@ import {main} from '../models';
 
 export function CheckForUpdate():Promise<main.UpdateInfo>;
 
+export function DeleteProfile(arg1:string):Promise<void>;
+
 export function DoUpdate(arg1:string):Promise<void>;
 
+export function ExportHistory(arg1:number,arg2:number,arg3:string):Promise<string>;
+
+export function FindFreeGPUs(arg1:number,arg2:number,arg3:number):Promise<main.FreeGPUResult>;
+
+export function GetActiveProfileID():Promise<string>;
+
+export function GetAlertHistory():Promise<Array<main.AlertEvent>>;
+
+export function GetAlertRules():Promise<Array<main.AlertRule>>;
+
+export function GetConnectionSnapshots():Promise<Array<main.ConnectionSnapshot>>;
+
+export function GetDisplayMode():Promise<string>;
+
+export function GetHistory(arg1:string,arg2:number,arg3:number,arg4:number):Promise<Array<main.HistoryPoint>>;
+
+export function GetMetricsExporter():Promise<main.MetricsExporterConfig>;
+
+export function GetNotificationConfig():Promise<main.NotificationConfig>;
+
+export function GetRecorderConfig():Promise<main.RecorderConfig>;
+
+export function GetSSHTransport():Promise<string>;
+
 export function GetVersion():Promise<string>;
 
+export function GetWebhooks():Promise<Array<main.WebhookConfig>>;
+
 export function HandleTrayClick():Promise<void>;
 
 export function HideWindow():Promise<void>;
 
+export function ImportLegacyProfiles(arg1:string,arg2:string):Promise<number>;
+
+export function ListProfiles():Promise<Array<main.ConnectionProfile>>;
+
 export function ListSSHConfigConnections():Promise<Array<main.SSHConfigConnection>>;
 
 export function Quit():Promise<void>;
 
 export function RetryConnection():Promise<void>;
 
+export function SaveProfile(arg1:main.ConnectionProfile):Promise<main.ConnectionProfile>;
+
+export function SendTestWebhook(arg1:main.WebhookConfig):Promise<void>;
+
+export function SetActiveProfile(arg1:string):Promise<void>;
+
+export function SetAlertRules(arg1:Array<main.AlertRule>):Promise<void>;
+
 export function SetConnection(arg1:string,arg2:number):Promise<void>;
 
+export function SetDisplayMode(arg1:string):Promise<void>;
+
 export function SetHost(arg1:string):Promise<void>;
 
+export function SetMetricsExporter(arg1:boolean,arg2:string):Promise<void>;
+
+export function SetNotificationConfig(arg1:main.NotificationConfig):Promise<void>;
+
+export function SetProfileMuted(arg1:string,arg2:boolean):Promise<void>;
+
+export function SetRecorderConfig(arg1:main.RecorderConfig):Promise<void>;
+
+export function SetSSHTransport(arg1:string):Promise<void>;
+
+export function SetWebhooks(arg1:Array<main.WebhookConfig>):Promise<void>;
+
 export function ShowMainWindow():Promise<void>;
 
 export function ShowMiniWindow():Promise<void>;
 
 export function TestConnection(arg1:string,arg2:number):Promise<main.ConnectionTestResult>;
 
-export function UpdateTrayData(arg1:number,arg2:number,arg3:number,arg4:number,arg5:string):Promise<void>;
+export function UnwatchConnection(arg1:string):Promise<void>;
 
-export function UpdateTrayTitle(arg1:string):Promise<void>;
+export function WatchConnection(arg1:string,arg2:string,arg3:number):Promise<void>;
@@ -6,14 +6,70 @@ export function CheckForUpdate() {
   return window['go']['main']['App']['CheckForUpdate']();
 }
 
+export function DeleteProfile(arg1) {
+  return window['go']['main']['App']['DeleteProfile'](arg1);
+}
+
 export function DoUpdate(arg1) {
   return window['go']['main']['App']['DoUpdate'](arg1);
 }
 
+export function ExportHistory(arg1,arg2,arg3) {
+  return window['go']['main']['App']['ExportHistory'](arg1, arg2, arg3);
+}
+
+export function FindFreeGPUs(arg1,arg2,arg3) {
+  return window['go']['main']['App']['FindFreeGPUs'](arg1, arg2, arg3);
+}
+
+export function GetActiveProfileID() {
+  return window['go']['main']['App']['GetActiveProfileID']();
+}
+
+export function GetAlertHistory() {
+  return window['go']['main']['App']['GetAlertHistory']();
+}
+
+export function GetAlertRules() {
+  return window['go']['main']['App']['GetAlertRules']();
+}
+
+export function GetConnectionSnapshots() {
+  return window['go']['main']['App']['GetConnectionSnapshots']();
+}
+
+export function GetDisplayMode() {
+  return window['go']['main']['App']['GetDisplayMode']();
+}
+
+export function GetHistory(arg1,arg2,arg3,arg4) {
+  return window['go']['main']['App']['GetHistory'](arg1, arg2, arg3, arg4);
+}
+
+export function GetMetricsExporter() {
+  return window['go']['main']['App']['GetMetricsExporter']();
+}
+
+export function GetNotificationConfig() {
+  return window['go']['main']['App']['GetNotificationConfig']();
+}
+
+export function GetRecorderConfig() {
+  return window['go']['main']['App']['GetRecorderConfig']();
+}
+
+export function GetSSHTransport() {
+  return window['go']['main']['App']['GetSSHTransport']();
+}
+
 export function GetVersion() {
   return window['go']['main']['App']['GetVersion']();
 }
 
+export function GetWebhooks() {
+  return window['go']['main']['App']['GetWebhooks']();
+}
+
 export function HandleTrayClick() {
   return window['go']['main']['App']['HandleTrayClick']();
 }
@@ -22,6 +78,14 @@ export function HideWindow() {
   return window['go']['main']['App']['HideWindow']();
 }
 
+export function ImportLegacyProfiles(arg1,arg2) {
+  return window['go']['main']['App']['ImportLegacyProfiles'](arg1, arg2);
+}
+
+export function ListProfiles() {
+  return window['go']['main']['App']['ListProfiles']();
+}
+
 export function ListSSHConfigConnections() {
   return window['go']['main']['App']['ListSSHConfigConnections']();
 }
@@ -34,14 +98,58 @@ export function RetryConnection() {
   return window['go']['main']['App']['RetryConnection']();
 }
 
+export function SaveProfile(arg1) {
+  return window['go']['main']['App']['SaveProfile'](arg1);
+}
+
+export function SendTestWebhook(arg1) {
+  return window['go']['main']['App']['SendTestWebhook'](arg1);
+}
+
+export function SetActiveProfile(arg1) {
+  return window['go']['main']['App']['SetActiveProfile'](arg1);
+}
+
+export function SetAlertRules(arg1) {
+  return window['go']['main']['App']['SetAlertRules'](arg1);
+}
+
 export function SetConnection(arg1, arg2) {
   return window['go']['main']['App']['SetConnection'](arg1, arg2);
 }
 
+export function SetDisplayMode(arg1) {
+  return window['go']['main']['App']['SetDisplayMode'](arg1);
+}
+
 export function SetHost(arg1) {
   return window['go']['main']['App']['SetHost'](arg1);
 }
 
+export function SetMetricsExporter(arg1,arg2) {
+  return window['go']['main']['App']['SetMetricsExporter'](arg1, arg2);
+}
+
+export function SetNotificationConfig(arg1) {
+  return window['go']['main']['App']['SetNotificationConfig'](arg1);
+}
+
+export function SetProfileMuted(arg1,arg2) {
+  return window['go']['main']['App']['SetProfileMuted'](arg1, arg2);
+}
+
+export function SetRecorderConfig(arg1) {
+  return window['go']['main']['App']['SetRecorderConfig'](arg1);
+}
+
+export function SetSSHTransport(arg1) {
+  return window['go']['main']['App']['SetSSHTransport'](arg1);
+}
+
+export function SetWebhooks(arg1) {
+  return window['go']['main']['App']['SetWebhooks'](arg1);
+}
+
 export function ShowMainWindow() {
   return window['go']['main']['App']['ShowMainWindow']();
 }
@@ -54,10 +162,10 @@ export function TestConnection(arg1, arg2) {
   return window['go']['main']['App']['TestConnection'](arg1, arg2);
 }
 
-export function UpdateTrayData(arg1, arg2, arg3, arg4, arg5) {
-  return window['go']['main']['App']['UpdateTrayData'](arg1, arg2, arg3, arg4, arg5);
+export function UnwatchConnection(arg1) {
+  return window['go']['main']['App']['UnwatchConnection'](arg1);
 }
 
-export function UpdateTrayTitle(arg1) {
-  return window['go']['main']['App']['UpdateTrayTitle'](arg1);
+export function WatchConnection(arg1,arg2,arg3) {
+  return window['go']['main']['App']['WatchConnection'](arg1, arg2, arg3);
 }
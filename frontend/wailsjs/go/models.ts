@@ -1,9 +1,178 @@
 export namespace main {
 	
+	export class AlertEvent {
+	    ruleId: string;
+	    ruleName: string;
+	    connectionId: string;
+	    target: string;
+	    gpuIndex: number;
+	    metric: string;
+	    value: number;
+	    threshold: number;
+	    state: string;
+	    timestamp: number;
+	    message: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new AlertEvent(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.ruleId = source["ruleId"];
+	        this.ruleName = source["ruleName"];
+	        this.connectionId = source["connectionId"];
+	        this.target = source["target"];
+	        this.gpuIndex = source["gpuIndex"];
+	        this.metric = source["metric"];
+	        this.value = source["value"];
+	        this.threshold = source["threshold"];
+	        this.state = source["state"];
+	        this.timestamp = source["timestamp"];
+	        this.message = source["message"];
+	    }
+	}
+	export class AlertRule {
+	    id: string;
+	    name: string;
+	    enabled: boolean;
+	    connectionId: string;
+	    metric: string;
+	    op: string;
+	    threshold: number;
+	    forSec: number;
+	    hysteresis: number;
+	    cooldownSec: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new AlertRule(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.id = source["id"];
+	        this.name = source["name"];
+	        this.enabled = source["enabled"];
+	        this.connectionId = source["connectionId"];
+	        this.metric = source["metric"];
+	        this.op = source["op"];
+	        this.threshold = source["threshold"];
+	        this.forSec = source["forSec"];
+	        this.hysteresis = source["hysteresis"];
+	        this.cooldownSec = source["cooldownSec"];
+	    }
+	}
+	export class ConnectionMeta {
+	    connectionId: string;
+	    status: string;
+	    lastSuccessTs: number;
+	    consecutiveFailures: number;
+	    nextRetryInSec: number;
+	    errorCode: string;
+	    errorMessage: string;
+	    errorHint: string;
+	    pollState: string;
+	    activeTarget: string;
+	    activePort: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new ConnectionMeta(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.connectionId = source["connectionId"];
+	        this.status = source["status"];
+	        this.lastSuccessTs = source["lastSuccessTs"];
+	        this.consecutiveFailures = source["consecutiveFailures"];
+	        this.nextRetryInSec = source["nextRetryInSec"];
+	        this.errorCode = source["errorCode"];
+	        this.errorMessage = source["errorMessage"];
+	        this.errorHint = source["errorHint"];
+	        this.pollState = source["pollState"];
+	        this.activeTarget = source["activeTarget"];
+	        this.activePort = source["activePort"];
+	    }
+	}
+	export class ConnectionProfile {
+	    id: string;
+	    name: string;
+	    target: string;
+	    port: number;
+	    source: string;
+	    lastUsedAt: number;
+	    lastTestStatus: string;
+	    lastErrorCode: string;
+	    lastErrorMessage: string;
+	    collector: string;
+	    hostMetrics: boolean;
+	    mounts: string[];
+	    pollIntervalSec: number;
+	    adaptivePolling: boolean;
+	
+	    static createFrom(source: any = {}) {
+	        return new ConnectionProfile(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.id = source["id"];
+	        this.name = source["name"];
+	        this.target = source["target"];
+	        this.port = source["port"];
+	        this.source = source["source"];
+	        this.lastUsedAt = source["lastUsedAt"];
+	        this.lastTestStatus = source["lastTestStatus"];
+	        this.lastErrorCode = source["lastErrorCode"];
+	        this.lastErrorMessage = source["lastErrorMessage"];
+	        this.collector = source["collector"];
+	        this.hostMetrics = source["hostMetrics"];
+	        this.mounts = source["mounts"];
+	        this.pollIntervalSec = source["pollIntervalSec"];
+	        this.adaptivePolling = source["adaptivePolling"];
+	    }
+	}
+	export class ConnectionSnapshot {
+	    id: string;
+	    meta: ConnectionMeta;
+	    gpus: GPU[];
+	    host: HostStats;
+	
+	    static createFrom(source: any = {}) {
+	        return new ConnectionSnapshot(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.id = source["id"];
+	        this.meta = this.convertValues(source["meta"], ConnectionMeta);
+	        this.gpus = this.convertValues(source["gpus"], GPU);
+	        this.host = this.convertValues(source["host"], HostStats);
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
 	export class ConnectionTestResult {
 	    success: boolean;
 	    code: string;
 	    message: string;
+	    hint: string;
 	    gpuCount: number;
 	
 	    static createFrom(source: any = {}) {
@@ -15,14 +184,423 @@ export namespace main {
 	        this.success = source["success"];
 	        this.code = source["code"];
 	        this.message = source["message"];
+	        this.hint = source["hint"];
 	        this.gpuCount = source["gpuCount"];
 	    }
 	}
+	export class DiskUsage {
+	    mount: string;
+	    used: number;
+	    total: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new DiskUsage(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.mount = source["mount"];
+	        this.used = source["used"];
+	        this.total = source["total"];
+	    }
+	}
+	export class FreeGPU {
+	    index: number;
+	    uuid: string;
+	    name: string;
+	    freeMiB: number;
+	    util: number;
+	    processes: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new FreeGPU(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.index = source["index"];
+	        this.uuid = source["uuid"];
+	        this.name = source["name"];
+	        this.freeMiB = source["freeMiB"];
+	        this.util = source["util"];
+	        this.processes = source["processes"];
+	    }
+	}
+	export class FreeGPUCandidate {
+	    profileId: string;
+	    name: string;
+	    target: string;
+	    gpus: FreeGPU[];
+	    cudaVisibleDevices: string;
+	    env: string;
+	    cached: boolean;
+	
+	    static createFrom(source: any = {}) {
+	        return new FreeGPUCandidate(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.profileId = source["profileId"];
+	        this.name = source["name"];
+	        this.target = source["target"];
+	        this.gpus = this.convertValues(source["gpus"], FreeGPU);
+	        this.cudaVisibleDevices = source["cudaVisibleDevices"];
+	        this.env = source["env"];
+	        this.cached = source["cached"];
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class FreeGPUHostError {
+	    profileId: string;
+	    name: string;
+	    message: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new FreeGPUHostError(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.profileId = source["profileId"];
+	        this.name = source["name"];
+	        this.message = source["message"];
+	    }
+	}
+	export class FreeGPUResult {
+	    candidates: FreeGPUCandidate[];
+	    unreachable: FreeGPUHostError[];
+	
+	    static createFrom(source: any = {}) {
+	        return new FreeGPUResult(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.candidates = this.convertValues(source["candidates"], FreeGPUCandidate);
+	        this.unreachable = this.convertValues(source["unreachable"], FreeGPUHostError);
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class GPU {
+	    vendor: string;
+	    index: number;
+	    name: string;
+	    util: number;
+	    temp: number;
+	    memUsed: number;
+	    memTotal: number;
+	    fanSpeed: number;
+	    powerDraw: number;
+	    powerLimit: number;
+	    driverVersion: string;
+	    cudaVersion: string;
+	    uuid: string;
+	    pciBusId: string;
+	    pstate: string;
+	    clockSm: number;
+	    clockMem: number;
+	    clockMaxSm: number;
+	    clockMaxMem: number;
+	    throttleReasons: string[];
+	    eccUncorrected: number;
+	    pcieGen: number;
+	    pcieGenMax: number;
+	    pcieWidth: number;
+	    pcieWidthMax: number;
+	    encoderUtil: number;
+	    decoderUtil: number;
+	    memReserved: number;
+	    migMode: string;
+	    migDevices: MigDevice[];
+	    retiredPagesSbe: number;
+	    retiredPagesDbe: number;
+	    retiredPagesPending: boolean;
+	    remappedRowsUnc: number;
+	    remappedRowsPending: boolean;
+	    processes: GPUProcess[];
+	
+	    static createFrom(source: any = {}) {
+	        return new GPU(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.vendor = source["vendor"];
+	        this.index = source["index"];
+	        this.name = source["name"];
+	        this.util = source["util"];
+	        this.temp = source["temp"];
+	        this.memUsed = source["memUsed"];
+	        this.memTotal = source["memTotal"];
+	        this.fanSpeed = source["fanSpeed"];
+	        this.powerDraw = source["powerDraw"];
+	        this.powerLimit = source["powerLimit"];
+	        this.driverVersion = source["driverVersion"];
+	        this.cudaVersion = source["cudaVersion"];
+	        this.uuid = source["uuid"];
+	        this.pciBusId = source["pciBusId"];
+	        this.pstate = source["pstate"];
+	        this.clockSm = source["clockSm"];
+	        this.clockMem = source["clockMem"];
+	        this.clockMaxSm = source["clockMaxSm"];
+	        this.clockMaxMem = source["clockMaxMem"];
+	        this.throttleReasons = source["throttleReasons"];
+	        this.eccUncorrected = source["eccUncorrected"];
+	        this.pcieGen = source["pcieGen"];
+	        this.pcieGenMax = source["pcieGenMax"];
+	        this.pcieWidth = source["pcieWidth"];
+	        this.pcieWidthMax = source["pcieWidthMax"];
+	        this.encoderUtil = source["encoderUtil"];
+	        this.decoderUtil = source["decoderUtil"];
+	        this.memReserved = source["memReserved"];
+	        this.migMode = source["migMode"];
+	        this.migDevices = this.convertValues(source["migDevices"], MigDevice);
+	        this.retiredPagesSbe = source["retiredPagesSbe"];
+	        this.retiredPagesDbe = source["retiredPagesDbe"];
+	        this.retiredPagesPending = source["retiredPagesPending"];
+	        this.remappedRowsUnc = source["remappedRowsUnc"];
+	        this.remappedRowsPending = source["remappedRowsPending"];
+	        this.processes = this.convertValues(source["processes"], GPUProcess);
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class GPUProcess {
+	    gpuUuid: string;
+	    pid: number;
+	    processName: string;
+	    usedMemory: number;
+	    user: string;
+	    command: string;
+	    gpuInstanceId: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new GPUProcess(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.gpuUuid = source["gpuUuid"];
+	        this.pid = source["pid"];
+	        this.processName = source["processName"];
+	        this.usedMemory = source["usedMemory"];
+	        this.user = source["user"];
+	        this.command = source["command"];
+	        this.gpuInstanceId = source["gpuInstanceId"];
+	    }
+	}
+	export class HistoryPoint {
+	    ts: number;
+	    util: number;
+	    temp: number;
+	    memUsed: number;
+	    memTotal: number;
+	    fanSpeed: number;
+	    powerDraw: number;
+	    powerLimit: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new HistoryPoint(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.ts = source["ts"];
+	        this.util = source["util"];
+	        this.temp = source["temp"];
+	        this.memUsed = source["memUsed"];
+	        this.memTotal = source["memTotal"];
+	        this.fanSpeed = source["fanSpeed"];
+	        this.powerDraw = source["powerDraw"];
+	        this.powerLimit = source["powerLimit"];
+	    }
+	}
+	export class HostStats {
+	    load1: number;
+	    load5: number;
+	    load15: number;
+	    cpuCount: number;
+	    cpuUtil: number;
+	    cpuIowait: number;
+	    memUsed: number;
+	    memTotal: number;
+	    swapUsed: number;
+	    swapTotal: number;
+	    netRxBps: number;
+	    netTxBps: number;
+	    disks: DiskUsage[];
+	
+	    static createFrom(source: any = {}) {
+	        return new HostStats(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.load1 = source["load1"];
+	        this.load5 = source["load5"];
+	        this.load15 = source["load15"];
+	        this.cpuCount = source["cpuCount"];
+	        this.cpuUtil = source["cpuUtil"];
+	        this.cpuIowait = source["cpuIowait"];
+	        this.memUsed = source["memUsed"];
+	        this.memTotal = source["memTotal"];
+	        this.swapUsed = source["swapUsed"];
+	        this.swapTotal = source["swapTotal"];
+	        this.netRxBps = source["netRxBps"];
+	        this.netTxBps = source["netTxBps"];
+	        this.disks = this.convertValues(source["disks"], DiskUsage);
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class MetricsExporterConfig {
+	    enabled: boolean;
+	    addr: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new MetricsExporterConfig(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.enabled = source["enabled"];
+	        this.addr = source["addr"];
+	    }
+	}
+	export class MigDevice {
+	    index: number;
+	    gpuInstanceId: number;
+	    computeInstanceId: number;
+	    smCount: number;
+	    memUsed: number;
+	    memTotal: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new MigDevice(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.index = source["index"];
+	        this.gpuInstanceId = source["gpuInstanceId"];
+	        this.computeInstanceId = source["computeInstanceId"];
+	        this.smCount = source["smCount"];
+	        this.memUsed = source["memUsed"];
+	        this.memTotal = source["memTotal"];
+	    }
+	}
+	export class NotificationConfig {
+	    enabled: boolean;
+	    mutedProfiles: string[];
+	    jobFinished: boolean;
+	    alerts: boolean;
+	    minIntervalSec: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new NotificationConfig(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.enabled = source["enabled"];
+	        this.mutedProfiles = source["mutedProfiles"];
+	        this.jobFinished = source["jobFinished"];
+	        this.alerts = source["alerts"];
+	        this.minIntervalSec = source["minIntervalSec"];
+	    }
+	}
+	export class RecorderConfig {
+	    enabled: boolean;
+	    retentionDays: number;
+	    maxMiB: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new RecorderConfig(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.enabled = source["enabled"];
+	        this.retentionDays = source["retentionDays"];
+	        this.maxMiB = source["maxMiB"];
+	    }
+	}
 	export class SSHConfigConnection {
 	    name: string;
 	    target: string;
 	    port: number;
 	    source: string;
+	    hostName: string;
+	    user: string;
+	    proxyJump: string;
+	    identityFiles: string[];
 	
 	    static createFrom(source: any = {}) {
 	        return new SSHConfigConnection(source);
@@ -34,6 +612,10 @@ export namespace main {
 	        this.target = source["target"];
 	        this.port = source["port"];
 	        this.source = source["source"];
+	        this.hostName = source["hostName"];
+	        this.user = source["user"];
+	        this.proxyJump = source["proxyJump"];
+	        this.identityFiles = source["identityFiles"];
 	    }
 	}
 	export class UpdateInfo {
@@ -52,6 +634,32 @@ export namespace main {
 	        this.url = source["url"];
 	    }
 	}
+	export class WebhookConfig {
+	    id: string;
+	    name: string;
+	    enabled: boolean;
+	    url: string;
+	    format: string;
+	    template: string;
+	    events: string[];
+	    connectionId: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new WebhookConfig(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.id = source["id"];
+	        this.name = source["name"];
+	        this.enabled = source["enabled"];
+	        this.url = source["url"];
+	        this.format = source["format"];
+	        this.template = source["template"];
+	        this.events = source["events"];
+	        this.connectionId = source["connectionId"];
+	    }
+	}
 
 }
 
@@ -0,0 +1,334 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// gpuField maps one nvidia-smi --query-gpu field onto GPU. Exactly one of
+// intVal, strVal and set is non-nil; adding a field to the query only takes a
+// new entry in gpuFields.
+type gpuField struct {
+	name string
+	// aliases are other names nvidia-smi prints for the field in CSV
+	// headers.
+	aliases  []string
+	required bool
+	// text marks the free-form column that absorbs stray commas, since
+	// nvidia-smi does not quote values.
+	text   bool
+	intVal func(*GPU) *int
+	strVal func(*GPU) *string
+	set    func(*GPU, string)
+}
+
+// gpuFields is the full query in column order. The required fields come
+// first; optional ones are dropped when a host's nvidia-smi rejects them.
+var gpuFields = []gpuField{
+	{name: "index", required: true, intVal: func(g *GPU) *int { return &g.Index }},
+	{name: "name", required: true, text: true, strVal: func(g *GPU) *string { return &g.Name }},
+	{name: "utilization.gpu", required: true, intVal: func(g *GPU) *int { return &g.Util }},
+	{name: "temperature.gpu", required: true, intVal: func(g *GPU) *int { return &g.Temp }},
+	{name: "memory.used", required: true, intVal: func(g *GPU) *int { return &g.MemUsed }},
+	{name: "memory.total", required: true, intVal: func(g *GPU) *int { return &g.MemTotal }},
+	{name: "fan.speed", intVal: func(g *GPU) *int { return &g.FanSpeed }},
+	{name: "power.draw", intVal: func(g *GPU) *int { return &g.PowerDraw }},
+	{name: "power.limit", intVal: func(g *GPU) *int { return &g.PowerLimit }},
+	{name: "driver_version", strVal: func(g *GPU) *string { return &g.DriverVersion }},
+	{name: "cuda_version", strVal: func(g *GPU) *string { return &g.CudaVersion }},
+	{name: "uuid", strVal: func(g *GPU) *string { return &g.UUID }},
+	{name: "pci.bus_id", strVal: func(g *GPU) *string { return &g.PCIBusID }},
+	{name: "pstate", strVal: func(g *GPU) *string { return &g.PState }},
+	{name: "clocks.sm", aliases: []string{"clocks.current.sm"}, intVal: func(g *GPU) *int { return &g.ClockSM }},
+	{name: "clocks.mem", aliases: []string{"clocks.current.memory"}, intVal: func(g *GPU) *int { return &g.ClockMem }},
+	{name: "clocks.max.sm", intVal: func(g *GPU) *int { return &g.ClockMaxSM }},
+	{name: "clocks.max.mem", aliases: []string{"clocks.max.memory"}, intVal: func(g *GPU) *int { return &g.ClockMaxMem }},
+	{name: "clocks_throttle_reasons.active", aliases: []string{"clocks_event_reasons.active"}, set: func(g *GPU, v string) { g.ThrottleReasons = decodeThrottleReasons(v) }},
+	{name: "ecc.errors.uncorrected.volatile.total", intVal: func(g *GPU) *int { return &g.EccUncorrected }},
+	{name: "pcie.link.gen.current", intVal: func(g *GPU) *int { return &g.PCIeGen }},
+	{name: "pcie.link.gen.max", intVal: func(g *GPU) *int { return &g.PCIeGenMax }},
+	{name: "pcie.link.width.current", intVal: func(g *GPU) *int { return &g.PCIeWidth }},
+	{name: "pcie.link.width.max", intVal: func(g *GPU) *int { return &g.PCIeWidthMax }},
+	{name: "utilization.encoder", intVal: func(g *GPU) *int { return &g.EncoderUtil }},
+	{name: "utilization.decoder", intVal: func(g *GPU) *int { return &g.DecoderUtil }},
+	{name: "memory.reserved", intVal: func(g *GPU) *int { return &g.MemReserved }},
+	{name: "mig.mode.current", strVal: func(g *GPU) *string { return &g.MigMode }},
+}
+
+// apply parses raw into g. Only required fields can fail; optional ones
+// that are missing or unparseable are left unknown.
+func (f gpuField) apply(g *GPU, raw string) error {
+	switch {
+	case f.required && f.intVal != nil:
+		v, err := parseRequiredInt(raw)
+		if err != nil {
+			return err
+		}
+		*f.intVal(g) = v
+	case f.required:
+		v := strings.TrimSpace(raw)
+		if v == "" {
+			return fmt.Errorf("empty value")
+		}
+		*f.strVal(g) = v
+	case f.intVal != nil:
+		*f.intVal(g) = optionalInt(raw)
+	case f.strVal != nil:
+		*f.strVal(g) = optionalString(raw)
+	default:
+		f.set(g, optionalString(raw))
+	}
+	return nil
+}
+
+// gpuFieldError reports a required value that could not be parsed.
+type gpuFieldError struct {
+	Line  int
+	Field string
+	Value string
+	Err   error
+}
+
+func (e *gpuFieldError) Error() string {
+	return fmt.Sprintf("nvidia-smi output line %d: parse %s %q: %v", e.Line, e.Field, e.Value, e.Err)
+}
+
+func (e *gpuFieldError) Unwrap() error { return e.Err }
+
+// parseOutput parses nvidia-smi --query-gpu CSV. Columns are mapped by name:
+// from the header row when the output has one, otherwise from fields, the
+// list that was queried.
+func parseOutput(raw string, fields []string) ([]GPU, error) {
+	r := csv.NewReader(strings.NewReader(raw))
+	r.FieldsPerRecord = -1
+	r.LazyQuotes = true
+	r.TrimLeadingSpace = true
+
+	columns := fields
+	gpus := []GPU{}
+	first := true
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("parse nvidia-smi output: %w", err)
+		}
+		if len(record) == 1 && strings.TrimSpace(record[0]) == "" {
+			continue
+		}
+		line, _ := r.FieldPos(0)
+		if first {
+			first = false
+			if header, ok := parseGPUHeader(record); ok {
+				columns = header
+				continue
+			}
+		}
+		gpu, err := parseGPURecord(mergeTextColumn(record, columns), columns, line)
+		if err != nil {
+			return nil, err
+		}
+		gpus = append(gpus, gpu)
+	}
+	return gpus, nil
+}
+
+func parseGPURecord(record, columns []string, line int) (GPU, error) {
+	gpu := newGPU()
+	gpu.Vendor = vendorNVIDIA
+	seen := 0
+	for i, name := range columns {
+		field, ok := gpuFieldSpecs[name]
+		if !ok {
+			continue
+		}
+		if i >= len(record) {
+			if field.required {
+				return GPU{}, &gpuFieldError{Line: line, Field: name, Err: fmt.Errorf("missing column")}
+			}
+			continue
+		}
+		if err := field.apply(&gpu, record[i]); err != nil {
+			return GPU{}, &gpuFieldError{Line: line, Field: name, Value: strings.TrimSpace(record[i]), Err: err}
+		}
+		if field.required {
+			seen++
+		}
+	}
+	if seen < requiredGPUFieldCount {
+		return GPU{}, fmt.Errorf("nvidia-smi output line %d: missing required fields", line)
+	}
+	return gpu, nil
+}
+
+// parseGPUHeader recognizes a CSV header such as "index, name,
+// utilization.gpu [%]" and returns the canonical field name of each column,
+// empty for columns it does not know.
+func parseGPUHeader(record []string) ([]string, bool) {
+	columns := make([]string, len(record))
+	required := 0
+	for i, col := range record {
+		col = strings.TrimSpace(col)
+		if j := strings.Index(col, " ["); j >= 0 {
+			col = col[:j]
+		}
+		if name, ok := gpuFieldNames[col]; ok {
+			if gpuFieldSpecs[name].required {
+				required++
+			}
+			columns[i] = name
+		}
+	}
+	return columns, required == requiredGPUFieldCount
+}
+
+// mergeTextColumn rejoins a value that contained commas, which nvidia-smi
+// writes unquoted, so the remaining columns line up again.
+func mergeTextColumn(record, columns []string) []string {
+	extra := len(record) - len(columns)
+	if extra <= 0 {
+		return record
+	}
+	for i, name := range columns {
+		if !gpuFieldSpecs[name].text || i >= len(record) {
+			continue
+		}
+		merged := append([]string{}, record[:i]...)
+		merged = append(merged, strings.Join(record[i:i+extra+1], ", "))
+		return append(merged, record[i+extra+1:]...)
+	}
+	return record
+}
+
+var (
+	gpuFieldSpecs = map[string]gpuField{}
+	// gpuFieldNames maps every name and alias to the canonical name.
+	gpuFieldNames         = map[string]string{}
+	allGPUFieldNames      []string
+	requiredGPUFieldCount int
+)
+
+func init() {
+	for _, f := range gpuFields {
+		gpuFieldSpecs[f.name] = f
+		gpuFieldNames[f.name] = f.name
+		for _, alias := range f.aliases {
+			gpuFieldNames[alias] = f.name
+		}
+		allGPUFieldNames = append(allGPUFieldNames, f.name)
+		if f.required {
+			requiredGPUFieldCount++
+		}
+	}
+}
+
+// newGPU returns a GPU with every optional numeric field unknown.
+func newGPU() GPU {
+	var g GPU
+	for _, f := range gpuFields {
+		if f.intVal != nil && !f.required {
+			*f.intVal(&g) = -1
+		}
+	}
+	g.ThrottleReasons = []string{}
+	g.MigDevices = []MigDevice{}
+	g.RetiredPagesSBE, g.RetiredPagesDBE, g.RemappedRowsUnc = -1, -1, -1
+	g.Processes = []GPUProcess{}
+	return g
+}
+
+func gpuQueryCommand(fields []string) string {
+	return "nvidia-smi --query-gpu=" + strings.Join(fields, ",") + " --format=csv,noheader,nounits"
+}
+
+// throttleReasonBits follows nvmlClocksThrottleReasons.
+var throttleReasonBits = []struct {
+	bit  uint64
+	name string
+}{
+	{0x1, "gpu_idle"},
+	{0x2, "applications_clocks_setting"},
+	{0x4, "sw_power_cap"},
+	{0x8, "hw_slowdown"},
+	{0x10, "sync_boost"},
+	{0x20, "sw_thermal_slowdown"},
+	{0x40, "hw_thermal_slowdown"},
+	{0x80, "hw_power_brake_slowdown"},
+	{0x100, "display_clock_setting"},
+}
+
+// decodeThrottleReasons turns a bitmask such as "0x0000000000000004" into
+// reason names. Unknown or missing values decode to none.
+func decodeThrottleReasons(raw string) []string {
+	reasons := []string{}
+	raw = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(raw)), "0x")
+	mask, err := strconv.ParseUint(raw, 16, 64)
+	if err != nil {
+		return reasons
+	}
+	for _, r := range throttleReasonBits {
+		if mask&r.bit != 0 {
+			reasons = append(reasons, r.name)
+		}
+	}
+	return reasons
+}
+
+var invalidFieldPattern = regexp.MustCompile(`(?i)field "([^"]+)" is not a valid field`)
+
+// dropRejectedGPUFields removes the fields an nvidia-smi error complains
+// about. When the error names no field it recognizes, every optional field is
+// dropped. It reports false when there is nothing left to drop, so the error
+// is real.
+func dropRejectedGPUFields(fields []string, errText string) ([]string, bool) {
+	if !strings.Contains(strings.ToLower(errText), "is not a valid field") {
+		return nil, false
+	}
+	rejected := map[string]bool{}
+	for _, m := range invalidFieldPattern.FindAllStringSubmatch(errText, -1) {
+		if f, ok := gpuFieldSpecs[m[1]]; ok && !f.required {
+			rejected[m[1]] = true
+		}
+	}
+	var kept []string
+	for _, name := range fields {
+		if gpuFieldSpecs[name].required || (len(rejected) > 0 && !rejected[name]) {
+			kept = append(kept, name)
+		}
+	}
+	if len(kept) == len(fields) {
+		return nil, false
+	}
+	return kept, true
+}
+
+// gpuFieldCache remembers which fields each host accepts so probing happens
+// once per host rather than on every poll.
+type gpuFieldCache struct {
+	mu     sync.Mutex
+	fields map[string][]string
+}
+
+var gpuFieldsCache = &gpuFieldCache{fields: map[string][]string{}}
+
+func (c *gpuFieldCache) get(key string) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if fields, ok := c.fields[key]; ok {
+		return fields
+	}
+	return allGPUFieldNames
+}
+
+func (c *gpuFieldCache) set(key string, fields []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.fields[key] = fields
+}
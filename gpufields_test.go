@@ -0,0 +1,139 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseOutputRecordedFixtures(t *testing.T) {
+	cases := []struct {
+		file  string
+		count int
+		check func(t *testing.T, gpus []GPU)
+	}{
+		{"470-tesla-t4.csv", 2, func(t *testing.T, gpus []GPU) {
+			g := gpus[1]
+			if g.Name != "Tesla T4" || g.Util != 87 || g.MemUsed != 14211 || g.FanSpeed != -1 || g.PowerDraw != 68 || g.DriverVersion != "470.199.02" {
+				t.Fatalf("unexpected gpu: %+v", g)
+			}
+			if g.ClockSM != -1 || g.PState != "" {
+				t.Fatalf("fields absent from the output should be unknown: %+v", g)
+			}
+		}},
+		{"535-a100-mig.csv", 2, func(t *testing.T, gpus []GPU) {
+			g := gpus[0]
+			if g.MigMode != "Enabled" || g.UUID != "GPU-5a1e2c3b-0d4e-4f5a-8b6c-7d8e9f0a1b2c" || g.PCIBusID != "00000000:07:00.0" {
+				t.Fatalf("unexpected gpu: %+v", g)
+			}
+			if g.ClockSM != 1410 || g.ClockMem != 1593 || strings.Join(g.ThrottleReasons, ",") != "gpu_idle" {
+				t.Fatalf("aliased header columns not mapped: %+v", g)
+			}
+			if len(gpus[1].ThrottleReasons) != 0 || gpus[1].MigMode != "Disabled" {
+				t.Fatalf("unexpected gpu: %+v", gpus[1])
+			}
+		}},
+		{"550-h100.csv", 1, func(t *testing.T, gpus []GPU) {
+			g := gpus[0]
+			if g.ClockMaxSM != 1980 || g.PCIeGenMax != 5 || g.PCIeWidthMax != 16 || g.MemReserved != 522 {
+				t.Fatalf("unexpected gpu: %+v", g)
+			}
+			if strings.Join(g.ThrottleReasons, ",") != "sw_power_cap" {
+				t.Fatalf("clocks_event_reasons not decoded: %v", g.ThrottleReasons)
+			}
+		}},
+		{"555-rtx4090.csv", 1, func(t *testing.T, gpus []GPU) {
+			g := gpus[0]
+			if g.FanSpeed != 30 || g.EccUncorrected != -1 || g.EncoderUtil != 3 || g.DecoderUtil != 0 || g.MigMode != "" {
+				t.Fatalf("unexpected gpu: %+v", g)
+			}
+		}},
+		{"525-windows-crlf.csv", 1, func(t *testing.T, gpus []GPU) {
+			if g := gpus[0]; g.Name != "NVIDIA RTX A4000" || g.MemTotal != 16376 || g.FanSpeed != -1 {
+				t.Fatalf("unexpected gpu: %+v", g)
+			}
+		}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.file, func(t *testing.T) {
+			raw, err := os.ReadFile(filepath.Join("testdata", "nvidia-smi", tc.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			// The header names the columns; the declared list is ignored.
+			gpus, err := parseOutput(string(raw), allGPUFieldNames)
+			if err != nil {
+				t.Fatalf("parseOutput returned error: %v", err)
+			}
+			if len(gpus) != tc.count {
+				t.Fatalf("expected %d gpus, got %d", tc.count, len(gpus))
+			}
+			tc.check(t, gpus)
+		})
+	}
+}
+
+func TestParseOutputNameWithComma(t *testing.T) {
+	fields := allGPUFieldNames[:8]
+	gpus, err := parseOutput("0, NVIDIA RTX A6000, Engineering Sample, 78, 66, 10240, 49140, 45, 210.3\n", fields)
+	if err != nil {
+		t.Fatalf("parseOutput returned error: %v", err)
+	}
+	if g := gpus[0]; g.Name != "NVIDIA RTX A6000, Engineering Sample" || g.Util != 78 || g.PowerDraw != 210 {
+		t.Fatalf("unexpected gpu: %+v", g)
+	}
+
+	gpus, err = parseOutput(`0, "NVIDIA A10, rev b", 1, 40, 5, 24000`, allGPUFieldNames[:6])
+	if err != nil || gpus[0].Name != "NVIDIA A10, rev b" {
+		t.Fatalf("quoted name not parsed: %+v %v", gpus, err)
+	}
+}
+
+func TestParseOutputFieldError(t *testing.T) {
+	_, err := parseOutput("0, Tesla T4, 1, 30, 0, 15109\n1, Tesla T4, [N/A], 30, 0, 15109\n", allGPUFieldNames[:6])
+	var fieldErr *gpuFieldError
+	if !errors.As(err, &fieldErr) {
+		t.Fatalf("expected gpuFieldError, got %v", err)
+	}
+	if fieldErr.Line != 2 || fieldErr.Field != "utilization.gpu" || fieldErr.Value != "[N/A]" {
+		t.Fatalf("unexpected field error: %+v", fieldErr)
+	}
+
+	if _, err := parseOutput("0, Tesla T4, 1\n", allGPUFieldNames[:6]); err == nil {
+		t.Fatal("expected error for truncated line")
+	}
+}
+
+func FuzzParseOutput(f *testing.F) {
+	files, err := filepath.Glob(filepath.Join("testdata", "nvidia-smi", "*.csv"))
+	if err != nil || len(files) == 0 {
+		f.Fatalf("no nvidia-smi fixtures: %v", err)
+	}
+	for _, file := range files {
+		raw, err := os.ReadFile(file)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(string(raw))
+		// The same rows without the header go through the declared list.
+		if _, rows, ok := strings.Cut(string(raw), "\n"); ok {
+			f.Add(rows)
+		}
+	}
+	f.Add("0, NVIDIA A100, 97, 71, 30000, 40960, N/A, 250.5, 400.0, 550.54.14, 12.4\n")
+	f.Add(`0, "NVIDIA A10, rev b", 1, 40, 5, 24000`)
+
+	f.Fuzz(func(t *testing.T, raw string) {
+		gpus, err := parseOutput(raw, allGPUFieldNames)
+		if err != nil {
+			return
+		}
+		for _, g := range gpus {
+			if g.Name == "" || g.ThrottleReasons == nil {
+				t.Fatalf("accepted gpu without required data: %+v", g)
+			}
+		}
+	})
+}
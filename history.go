@@ -0,0 +1,259 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// historyTier describes one downsampling level: samples are averaged into
+// buckets of resolution and the newest retention worth of buckets is kept.
+type historyTier struct {
+	resolution time.Duration
+	retention  time.Duration
+}
+
+var defaultHistoryTiers = []historyTier{
+	{resolution: time.Second, retention: 15 * time.Minute},
+	{resolution: 10 * time.Second, retention: 24 * time.Hour},
+}
+
+// HistoryPoint is one bucket of averaged GPU readings. Metrics that were
+// unsupported for the whole bucket are -1, matching GPU.
+type HistoryPoint struct {
+	Ts         int64   `json:"ts"`
+	Util       float64 `json:"util"`
+	Temp       float64 `json:"temp"`
+	MemUsed    float64 `json:"memUsed"`
+	MemTotal   float64 `json:"memTotal"`
+	FanSpeed   float64 `json:"fanSpeed"`
+	PowerDraw  float64 `json:"powerDraw"`
+	PowerLimit float64 `json:"powerLimit"`
+}
+
+const historyMetricCount = 7
+
+func gpuHistoryValues(g GPU) [historyMetricCount]int {
+	return [historyMetricCount]int{g.Util, g.Temp, g.MemUsed, g.MemTotal, g.FanSpeed, g.PowerDraw, g.PowerLimit}
+}
+
+// historyBucket accumulates samples falling into one bucket.
+type historyBucket struct {
+	start  int64
+	sums   [historyMetricCount]float64
+	counts [historyMetricCount]int
+	n      int
+}
+
+func (b *historyBucket) add(values [historyMetricCount]float64) {
+	for i, v := range values {
+		if v >= 0 {
+			b.sums[i] += v
+			b.counts[i]++
+		}
+	}
+	b.n++
+}
+
+func (b *historyBucket) point() HistoryPoint {
+	var avg [historyMetricCount]float64
+	for i := range avg {
+		avg[i] = -1
+		if b.counts[i] > 0 {
+			avg[i] = b.sums[i] / float64(b.counts[i])
+		}
+	}
+	return HistoryPoint{
+		Ts:         b.start,
+		Util:       avg[0],
+		Temp:       avg[1],
+		MemUsed:    avg[2],
+		MemTotal:   avg[3],
+		FanSpeed:   avg[4],
+		PowerDraw:  avg[5],
+		PowerLimit: avg[6],
+	}
+}
+
+func historyPointValues(p HistoryPoint) [historyMetricCount]float64 {
+	return [historyMetricCount]float64{p.Util, p.Temp, p.MemUsed, p.MemTotal, p.FanSpeed, p.PowerDraw, p.PowerLimit}
+}
+
+// historyRing is a fixed-capacity ring of completed buckets for one tier.
+type historyRing struct {
+	tier    historyTier
+	points  []HistoryPoint
+	next    int
+	full    bool
+	current historyBucket
+}
+
+func newHistoryRing(tier historyTier) *historyRing {
+	size := int(tier.retention / tier.resolution)
+	if size < 1 {
+		size = 1
+	}
+	return &historyRing{tier: tier, points: make([]HistoryPoint, size)}
+}
+
+func (r *historyRing) add(ts int64, values [historyMetricCount]float64) {
+	res := int64(r.tier.resolution / time.Second)
+	start := ts - ts%res
+	if r.current.n > 0 && start != r.current.start {
+		r.push(r.current.point())
+		r.current = historyBucket{}
+	}
+	if r.current.n == 0 {
+		r.current.start = start
+	}
+	r.current.add(values)
+}
+
+func (r *historyRing) push(p HistoryPoint) {
+	r.points[r.next] = p
+	r.next = (r.next + 1) % len(r.points)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// since returns buckets starting at or after ts in chronological order,
+// including the bucket still being filled.
+func (r *historyRing) since(ts int64) []HistoryPoint {
+	var out []HistoryPoint
+	appendFrom := func(points []HistoryPoint) {
+		for _, p := range points {
+			if p.Ts >= ts {
+				out = append(out, p)
+			}
+		}
+	}
+	if r.full {
+		appendFrom(r.points[r.next:])
+	}
+	appendFrom(r.points[:r.next])
+	if r.current.n > 0 && r.current.start >= ts {
+		out = append(out, r.current.point())
+	}
+	return out
+}
+
+type historyKey struct {
+	connectionID string
+	gpuIndex     int
+}
+
+// historyStore keeps rolling per-GPU history for every watched connection,
+// independent of whether the frontend is open.
+type historyStore struct {
+	mu     sync.Mutex
+	tiers  []historyTier
+	series map[historyKey][]*historyRing
+}
+
+func newHistoryStore(tiers []historyTier) *historyStore {
+	return &historyStore{tiers: tiers, series: map[historyKey][]*historyRing{}}
+}
+
+func (h *historyStore) record(connectionID string, gpus []GPU, now time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	ts := now.Unix()
+	for _, g := range gpus {
+		key := historyKey{connectionID: connectionID, gpuIndex: g.Index}
+		rings, ok := h.series[key]
+		if !ok {
+			for _, tier := range h.tiers {
+				rings = append(rings, newHistoryRing(tier))
+			}
+			h.series[key] = rings
+		}
+		var values [historyMetricCount]float64
+		for i, v := range gpuHistoryValues(g) {
+			values[i] = float64(v)
+		}
+		for _, r := range rings {
+			r.add(ts, values)
+		}
+	}
+}
+
+// query returns points since the given time. The finest tier that still
+// covers since is used; a coarser resolution than that tier is produced by
+// re-averaging its buckets.
+func (h *historyStore) query(connectionID string, gpuIndex int, since time.Time, resolution time.Duration, now time.Time) []HistoryPoint {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	rings, ok := h.series[historyKey{connectionID: connectionID, gpuIndex: gpuIndex}]
+	if !ok || len(rings) == 0 {
+		return []HistoryPoint{}
+	}
+
+	ring := rings[len(rings)-1]
+	for _, r := range rings {
+		if now.Sub(since) <= r.tier.retention && (resolution <= 0 || r.tier.resolution <= resolution) {
+			ring = r
+			break
+		}
+	}
+	points := ring.since(since.Unix())
+	if resolution <= ring.tier.resolution || len(points) == 0 {
+		if points == nil {
+			return []HistoryPoint{}
+		}
+		return points
+	}
+	return downsampleHistory(points, resolution)
+}
+
+func downsampleHistory(points []HistoryPoint, resolution time.Duration) []HistoryPoint {
+	res := int64(resolution / time.Second)
+	out := []HistoryPoint{}
+	var b historyBucket
+	for _, p := range points {
+		start := p.Ts - p.Ts%res
+		if b.n > 0 && start != b.start {
+			out = append(out, b.point())
+			b = historyBucket{}
+		}
+		if b.n == 0 {
+			b.start = start
+		}
+		b.add(historyPointValues(p))
+	}
+	if b.n > 0 {
+		out = append(out, b.point())
+	}
+	return out
+}
+
+// recent returns up to the n newest buckets of the finest tier, oldest
+// first.
+func (h *historyStore) recent(connectionID string, gpuIndex int, n int) []HistoryPoint {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	rings, ok := h.series[historyKey{connectionID: connectionID, gpuIndex: gpuIndex}]
+	if !ok || len(rings) == 0 {
+		return nil
+	}
+	points := rings[0].since(0)
+	if len(points) > n {
+		points = points[len(points)-n:]
+	}
+	return points
+}
+
+func (h *historyStore) forget(connectionID string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for key := range h.series {
+		if key.connectionID == connectionID {
+			delete(h.series, key)
+		}
+	}
+}
+
+// GetHistory returns averaged readings for one GPU since the given Unix
+// time. resolution is in seconds; 0 picks the finest tier available.
+func (a *App) GetHistory(connectionID string, gpuIndex int, since int64, resolution int) []HistoryPoint {
+	return a.history.query(connectionID, gpuIndex, time.Unix(since, 0), time.Duration(resolution)*time.Second, time.Now())
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHistoryRecordsEverySecond(t *testing.T) {
+	h := newHistoryStore(defaultHistoryTiers)
+	start := time.Unix(1700000000, 0)
+	for i := 0; i < 5; i++ {
+		h.record("conn", []GPU{{Index: 0, Util: i * 10, Temp: 60, FanSpeed: -1}}, start.Add(time.Duration(i)*time.Second))
+	}
+
+	points := h.query("conn", 0, start, 0, start.Add(5*time.Second))
+	if len(points) != 5 {
+		t.Fatalf("expected 5 points, got %d: %+v", len(points), points)
+	}
+	if points[4].Util != 40 || points[4].Ts != start.Unix()+4 {
+		t.Fatalf("unexpected latest point: %+v", points[4])
+	}
+	if points[0].FanSpeed != -1 {
+		t.Fatalf("unsupported metric should stay -1, got %v", points[0].FanSpeed)
+	}
+	if got := h.query("conn", 1, start, 0, start); len(got) != 0 {
+		t.Fatalf("expected no history for unknown GPU, got %+v", got)
+	}
+}
+
+func TestHistoryRingWrapsAndUsesCoarseTier(t *testing.T) {
+	tiers := []historyTier{
+		{resolution: time.Second, retention: 10 * time.Second},
+		{resolution: 10 * time.Second, retention: 100 * time.Second},
+	}
+	h := newHistoryStore(tiers)
+	start := time.Unix(1700000000, 0)
+	for i := 0; i < 60; i++ {
+		h.record("conn", []GPU{{Index: 0, Util: i}}, start.Add(time.Duration(i)*time.Second))
+	}
+	now := start.Add(59 * time.Second)
+
+	fine := h.query("conn", 0, now.Add(-5*time.Second), 0, now)
+	if len(fine) != 6 || fine[0].Util != 54 {
+		t.Fatalf("unexpected fine points: %+v", fine)
+	}
+
+	coarse := h.query("conn", 0, start, 0, now)
+	if len(coarse) != 6 {
+		t.Fatalf("expected 6 ten-second buckets, got %d: %+v", len(coarse), coarse)
+	}
+	if coarse[0].Ts != start.Unix() || coarse[0].Util != 4.5 {
+		t.Fatalf("unexpected first coarse bucket: %+v", coarse[0])
+	}
+}
+
+func TestHistoryDownsamplesToRequestedResolution(t *testing.T) {
+	h := newHistoryStore(defaultHistoryTiers)
+	// Aligned to a 30s boundary so both buckets are complete.
+	start := time.Unix(1700000010, 0)
+	for i := 0; i < 60; i++ {
+		h.record("conn", []GPU{{Index: 0, Temp: 50 + i%2*10}}, start.Add(time.Duration(i)*time.Second))
+	}
+	points := h.query("conn", 0, start, 30*time.Second, start.Add(time.Minute))
+	if len(points) != 2 || points[0].Temp != 55 {
+		t.Fatalf("unexpected downsampled points: %+v", points)
+	}
+}
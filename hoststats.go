@@ -0,0 +1,291 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const hostSectionMarker = "--nvsmibar-host--"
+
+// defaultHostMounts is what df reports on when a profile selects no mounts.
+var defaultHostMounts = []string{"/"}
+
+// HostStats is the CPU, memory, disk and network state of a polled host,
+// emitted with every GPU poll of a profile that enables host metrics.
+type HostStats struct {
+	Load1    float64 `json:"load1"`
+	Load5    float64 `json:"load5"`
+	Load15   float64 `json:"load15"`
+	CPUCount int     `json:"cpuCount"`
+	// CPUUtil and CPUIOWait are percentages over the time since the previous
+	// poll; -1 on the first poll or after a counter reset.
+	CPUUtil   float64 `json:"cpuUtil"`
+	CPUIOWait float64 `json:"cpuIowait"`
+	// Memory, swap and disk sizes are in MiB.
+	MemUsed   int `json:"memUsed"`
+	MemTotal  int `json:"memTotal"`
+	SwapUsed  int `json:"swapUsed"`
+	SwapTotal int `json:"swapTotal"`
+	// NetRxBps and NetTxBps are bytes per second summed over every interface
+	// but loopback; -1 on the first poll or after a counter reset.
+	NetRxBps float64     `json:"netRxBps"`
+	NetTxBps float64     `json:"netTxBps"`
+	Disks    []DiskUsage `json:"disks"`
+}
+
+// DiskUsage is one filesystem as reported by df.
+type DiskUsage struct {
+	Mount string `json:"mount"`
+	Used  int    `json:"used"`
+	Total int    `json:"total"`
+}
+
+// hostSample is one reading of the host's counters. Rates need two samples,
+// so the worker keeps the previous one.
+type hostSample struct {
+	at    time.Time
+	stats HostStats
+
+	cpuTotal, cpuIdle, cpuIOWait uint64
+	netRx, netTx                 uint64
+}
+
+// hostStatsCommand reads every host metric as one probe section, split by
+// hostSectionMarker. df may fail for a missing mount; the others still
+// print.
+func hostStatsCommand(mounts []string) string {
+	quoted := make([]string, len(mounts))
+	for i, m := range mounts {
+		quoted[i] = shellQuote(m)
+	}
+	sep := "; echo " + hostSectionMarker + "; "
+	return "cat /proc/loadavg" + sep +
+		"cat /proc/meminfo" + sep +
+		"grep '^cpu' /proc/stat" + sep +
+		"cat /proc/net/dev" + sep +
+		"df -Pk -- " + strings.Join(quoted, " ") + " 2>/dev/null; true"
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// parseHostSample parses the sections printed by hostStatsCommand.
+func parseHostSample(raw string) (hostSample, error) {
+	sections := strings.Split(strings.ReplaceAll(raw, "\r\n", "\n"), hostSectionMarker+"\n")
+	if len(sections) != 5 {
+		return hostSample{}, fmt.Errorf("unexpected host metrics output: %d sections", len(sections))
+	}
+	var s hostSample
+	if err := s.parseLoadavg(sections[0]); err != nil {
+		return hostSample{}, err
+	}
+	if err := s.parseMeminfo(sections[1]); err != nil {
+		return hostSample{}, err
+	}
+	if err := s.parseStat(sections[2]); err != nil {
+		return hostSample{}, err
+	}
+	s.parseNetDev(sections[3])
+	s.stats.Disks = parseDF(sections[4])
+	return s, nil
+}
+
+func (s *hostSample) parseLoadavg(section string) error {
+	fields := strings.Fields(section)
+	if len(fields) < 3 {
+		return fmt.Errorf("parse /proc/loadavg: %q", strings.TrimSpace(section))
+	}
+	loads := make([]float64, 3)
+	for i := range loads {
+		v, err := strconv.ParseFloat(fields[i], 64)
+		if err != nil {
+			return fmt.Errorf("parse /proc/loadavg: %w", err)
+		}
+		loads[i] = v
+	}
+	s.stats.Load1, s.stats.Load5, s.stats.Load15 = loads[0], loads[1], loads[2]
+	return nil
+}
+
+func (s *hostSample) parseMeminfo(section string) error {
+	kib := map[string]uint64{}
+	sc := bufio.NewScanner(strings.NewReader(section))
+	for sc.Scan() {
+		key, rest, ok := strings.Cut(sc.Text(), ":")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(rest)
+		if len(fields) == 0 {
+			continue
+		}
+		if v, err := strconv.ParseUint(fields[0], 10, 64); err == nil {
+			kib[key] = v
+		}
+	}
+	total, ok := kib["MemTotal"]
+	if !ok || total == 0 {
+		return fmt.Errorf("parse /proc/meminfo: no MemTotal")
+	}
+	// Kernels before 3.14 have no MemAvailable.
+	avail, ok := kib["MemAvailable"]
+	if !ok {
+		avail = kib["MemFree"] + kib["Buffers"] + kib["Cached"]
+	}
+	if avail > total {
+		avail = total
+	}
+	s.stats.MemTotal = int(total / 1024)
+	s.stats.MemUsed = int((total - avail) / 1024)
+	swapTotal, swapFree := kib["SwapTotal"], kib["SwapFree"]
+	if swapFree > swapTotal {
+		swapFree = swapTotal
+	}
+	s.stats.SwapTotal = int(swapTotal / 1024)
+	s.stats.SwapUsed = int((swapTotal - swapFree) / 1024)
+	return nil
+}
+
+// parseStat reads the aggregate cpu line and counts the per-CPU ones.
+func (s *hostSample) parseStat(section string) error {
+	found := false
+	sc := bufio.NewScanner(strings.NewReader(section))
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) == 0 || !strings.HasPrefix(fields[0], "cpu") {
+			continue
+		}
+		if fields[0] != "cpu" {
+			s.stats.CPUCount++
+			continue
+		}
+		// user nice system idle iowait irq softirq steal; guest time is
+		// already included in user and nice.
+		var ticks [8]uint64
+		for i := 0; i < len(ticks) && i+1 < len(fields); i++ {
+			v, err := strconv.ParseUint(fields[i+1], 10, 64)
+			if err != nil {
+				return fmt.Errorf("parse /proc/stat: %w", err)
+			}
+			ticks[i] = v
+		}
+		for _, v := range ticks {
+			s.cpuTotal += v
+		}
+		s.cpuIdle = ticks[3] + ticks[4]
+		s.cpuIOWait = ticks[4]
+		found = true
+	}
+	if !found {
+		return fmt.Errorf("parse /proc/stat: no cpu line")
+	}
+	return nil
+}
+
+func (s *hostSample) parseNetDev(section string) {
+	sc := bufio.NewScanner(strings.NewReader(section))
+	for sc.Scan() {
+		name, rest, ok := strings.Cut(sc.Text(), ":")
+		if !ok || strings.TrimSpace(name) == "lo" {
+			continue
+		}
+		fields := strings.Fields(rest)
+		if len(fields) < 9 {
+			continue
+		}
+		rx, errRx := strconv.ParseUint(fields[0], 10, 64)
+		tx, errTx := strconv.ParseUint(fields[8], 10, 64)
+		if errRx != nil || errTx != nil {
+			continue
+		}
+		s.netRx += rx
+		s.netTx += tx
+	}
+}
+
+// parseDF reads df -Pk output. Mount points are the last column and may
+// contain spaces.
+func parseDF(section string) []DiskUsage {
+	disks := []DiskUsage{}
+	seen := map[string]bool{}
+	sc := bufio.NewScanner(strings.NewReader(section))
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) < 6 || fields[0] == "Filesystem" {
+			continue
+		}
+		total, errTotal := strconv.ParseUint(fields[1], 10, 64)
+		used, errUsed := strconv.ParseUint(fields[2], 10, 64)
+		mount := strings.Join(fields[5:], " ")
+		if errTotal != nil || errUsed != nil || seen[mount] {
+			continue
+		}
+		seen[mount] = true
+		disks = append(disks, DiskUsage{Mount: mount, Used: int(used / 1024), Total: int(total / 1024)})
+	}
+	return disks
+}
+
+// hostStats returns cur's readings with the rates since prev filled in.
+func hostStats(prev *hostSample, cur hostSample) HostStats {
+	stats := cur.stats
+	stats.CPUUtil, stats.CPUIOWait = -1, -1
+	stats.NetRxBps, stats.NetTxBps = -1, -1
+	if prev == nil {
+		return stats
+	}
+	if cur.cpuTotal > prev.cpuTotal && cur.cpuIdle >= prev.cpuIdle && cur.cpuIOWait >= prev.cpuIOWait {
+		total := float64(cur.cpuTotal - prev.cpuTotal)
+		idle := float64(cur.cpuIdle - prev.cpuIdle)
+		if idle <= total {
+			stats.CPUUtil = round1(100 * (total - idle) / total)
+			stats.CPUIOWait = round1(100 * float64(cur.cpuIOWait-prev.cpuIOWait) / total)
+		}
+	}
+	elapsed := cur.at.Sub(prev.at).Seconds()
+	if elapsed > 0 && cur.netRx >= prev.netRx && cur.netTx >= prev.netTx {
+		stats.NetRxBps = float64(cur.netRx-prev.netRx) / elapsed
+		stats.NetTxBps = float64(cur.netTx-prev.netTx) / elapsed
+	}
+	return stats
+}
+
+func round1(v float64) float64 {
+	return float64(int64(v*10+0.5)) / 10
+}
+
+// hostMounts returns the mounts to report for connection id, and whether its
+// profile enables host metrics at all.
+func (a *App) hostMounts(id string) ([]string, bool) {
+	cfg := a.store.snapshot()
+	i, ok := findProfile(cfg.Profiles, id)
+	if !ok || !cfg.Profiles[i].HostMetrics {
+		return nil, false
+	}
+	if len(cfg.Profiles[i].Mounts) == 0 {
+		return defaultHostMounts, true
+	}
+	return cfg.Profiles[i].Mounts, true
+}
+
+// normalizeMounts trims, validates and de-duplicates a profile's df mounts.
+func normalizeMounts(mounts []string) ([]string, error) {
+	out := []string{}
+	seen := map[string]bool{}
+	for _, m := range mounts {
+		m = strings.TrimSpace(m)
+		if m == "" || seen[m] {
+			continue
+		}
+		if !strings.HasPrefix(m, "/") {
+			return nil, fmt.Errorf("mount %q must be an absolute path", m)
+		}
+		seen[m] = true
+		out = append(out, m)
+	}
+	return out, nil
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func readHostSample(t *testing.T, file string, at time.Time) hostSample {
+	t.Helper()
+	s, err := parseHostSample(string(readFixture(t, "host", file)))
+	if err != nil {
+		t.Fatalf("parseHostSample(%s) returned error: %v", file, err)
+	}
+	s.at = at
+	return s
+}
+
+func TestHostStatsFromSamples(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	a := readHostSample(t, "ubuntu-22.04-a.txt", start)
+	b := readHostSample(t, "ubuntu-22.04-b.txt", start.Add(2*time.Second))
+
+	first := hostStats(nil, a)
+	if first.Load1 != 12.41 || first.Load15 != 10.02 || first.CPUCount != 4 {
+		t.Fatalf("unexpected load: %+v", first)
+	}
+	if first.MemTotal != 515730 || first.MemUsed != 122841 || first.SwapTotal != 8191 || first.SwapUsed != 1024 {
+		t.Fatalf("unexpected memory: %+v", first)
+	}
+	if first.CPUUtil != -1 || first.NetRxBps != -1 {
+		t.Fatalf("rates need two samples: %+v", first)
+	}
+	if len(first.Disks) != 2 || first.Disks[0] != (DiskUsage{Mount: "/", Used: 597979, Total: 937366}) || first.Disks[1].Mount != "/mnt/data sets" {
+		t.Fatalf("unexpected disks: %+v", first.Disks)
+	}
+
+	stats := hostStats(&a, b)
+	if stats.CPUUtil != 58.7 || stats.CPUIOWait != 6.3 {
+		t.Fatalf("unexpected cpu: util %v iowait %v", stats.CPUUtil, stats.CPUIOWait)
+	}
+	// Loopback is excluded; eno1 moved 50 MB in and 1 MB out over 2s.
+	if stats.NetRxBps != 25e6 || stats.NetTxBps != 5e5 {
+		t.Fatalf("unexpected network: rx %v tx %v", stats.NetRxBps, stats.NetTxBps)
+	}
+
+	// A reboot resets the counters; that poll reports no rates.
+	if reset := hostStats(&b, a); reset.CPUUtil != -1 || reset.NetRxBps != -1 {
+		t.Fatalf("expected unknown rates after counter reset: %+v", reset)
+	}
+}
+
+func TestParseHostSampleErrors(t *testing.T) {
+	// A host without /proc prints only the markers and df.
+	raw := strings.Repeat(hostSectionMarker+"\n", 4)
+	if _, err := parseHostSample(raw); err == nil {
+		t.Fatal("expected error without /proc")
+	}
+	if _, err := parseHostSample("0.1 0.2 0.3 1/2 3\n"); err == nil {
+		t.Fatal("expected error for missing sections")
+	}
+}
+
+func TestHostStatsCommandQuotesMounts(t *testing.T) {
+	cmd := hostStatsCommand([]string{"/", "/mnt/it's"})
+	if !strings.HasSuffix(cmd, `df -Pk -- '/' '/mnt/it'\''s' 2>/dev/null; true`) {
+		t.Fatalf("unexpected command: %s", cmd)
+	}
+}
+
+func TestWorkerEmitsHostStats(t *testing.T) {
+	a, rec := newTestApp(func(target string, port int) ([]GPU, error) {
+		return []GPU{{Index: 0, Name: "A100"}}, nil
+	})
+	defer stopTestWorkers(a)
+	var gotMounts []string
+	a.poll = func(target string, port int, req probeRequest) (probeSnapshot, error) {
+		gotMounts = req.mounts
+		s, err := parseHostSample(string(readFixture(t, "host", "ubuntu-22.04-a.txt")))
+		s.at = time.Now()
+		return probeSnapshot{GPUs: []GPU{{Index: 0, Name: "A100"}}, host: &s}, err
+	}
+	p, err := a.SaveProfile(ConnectionProfile{Target: "box", HostMetrics: true, Mounts: []string{" /data ", "/data"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.SaveProfile(ConnectionProfile{Target: "box", Mounts: []string{"data"}}); err == nil {
+		t.Fatal("expected error for relative mount")
+	}
+
+	a.WatchConnection(p.ID, p.Target, p.Port)
+	waitFor(t, func() bool { return len(rec.find("gpu:host", p.ID)) > 0 })
+	host, ok := rec.find("gpu:host", p.ID)[0].data[0].(*HostStats)
+	if !ok || host == nil || host.MemTotal != 515730 {
+		t.Fatalf("unexpected host stats: %#v", rec.find("gpu:host", p.ID)[0].data[0])
+	}
+	if strings.Join(gotMounts, ",") != "/data" {
+		t.Fatalf("unexpected mounts: %v", gotMounts)
+	}
+	if snaps := a.GetConnectionSnapshots(); len(snaps) != 1 || snaps[0].Host == nil {
+		t.Fatal("snapshot should carry host stats")
+	}
+}
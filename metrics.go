@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultMetricsAddr = "127.0.0.1:9835"
+
+// MetricsExporterConfig controls the embedded Prometheus endpoint.
+type MetricsExporterConfig struct {
+	Enabled bool   `json:"enabled"`
+	Addr    string `json:"addr"`
+}
+
+// metricsExporter serves the latest polled readings at /metrics in the
+// Prometheus text exposition format.
+type metricsExporter struct {
+	mu       sync.Mutex
+	server   *http.Server
+	addr     string
+	snapshot func() []ConnectionSnapshot
+}
+
+func newMetricsExporter(snapshot func() []ConnectionSnapshot) *metricsExporter {
+	return &metricsExporter{snapshot: snapshot}
+}
+
+func (m *metricsExporter) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		writeMetrics(w, m.snapshot())
+	})
+	return mux
+}
+
+// start (re)binds the exporter to addr. It is a no-op when already serving
+// on the same address.
+func (m *metricsExporter) start(addr string) error {
+	if addr == "" {
+		addr = defaultMetricsAddr
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.server != nil && m.addr == addr {
+		return nil
+	}
+	m.stopLocked()
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("metrics exporter: %w", err)
+	}
+	server := &http.Server{Handler: m.handler(), ReadHeaderTimeout: 5 * time.Second}
+	go server.Serve(ln)
+	m.server = server
+	m.addr = addr
+	return nil
+}
+
+func (m *metricsExporter) stop() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.stopLocked()
+}
+
+func (m *metricsExporter) stopLocked() {
+	if m.server == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	_ = m.server.Shutdown(ctx)
+	m.server = nil
+	m.addr = ""
+}
+
+// GetMetricsExporter returns the exporter settings.
+func (a *App) GetMetricsExporter() MetricsExporterConfig {
+	cfg := a.store.snapshot().MetricsExporter
+	if cfg.Addr == "" {
+		cfg.Addr = defaultMetricsAddr
+	}
+	return cfg
+}
+
+// SetMetricsExporter enables or disables the /metrics endpoint and persists
+// the choice.
+func (a *App) SetMetricsExporter(enabled bool, addr string) error {
+	addr = strings.TrimSpace(addr)
+	if addr == "" {
+		addr = defaultMetricsAddr
+	}
+	if enabled {
+		if err := a.metrics.start(addr); err != nil {
+			return err
+		}
+	} else {
+		a.metrics.stop()
+	}
+	return a.store.update(func(cfg *appConfig) {
+		cfg.MetricsExporter = MetricsExporterConfig{Enabled: enabled, Addr: addr}
+	})
+}
+
+func (a *App) startMetricsExporter() {
+	cfg := a.store.snapshot().MetricsExporter
+	if !cfg.Enabled {
+		return
+	}
+	if err := a.metrics.start(cfg.Addr); err != nil {
+		println(err.Error())
+	}
+}
+
+type metricFamily struct {
+	name string
+	help string
+}
+
+var (
+	metricUp                  = metricFamily{"nvsmibar_up", "Whether the last poll of the host succeeded."}
+	metricConsecutiveFailures = metricFamily{"nvsmibar_consecutive_failures", "Consecutive failed polls of the host."}
+	metricLastSuccess         = metricFamily{"nvsmibar_last_success_timestamp_seconds", "Unix time of the last successful poll."}
+	metricGPUUtil             = metricFamily{"nvsmibar_gpu_utilization_percent", "GPU utilization."}
+	metricGPUTemp             = metricFamily{"nvsmibar_gpu_temperature_celsius", "GPU core temperature."}
+	metricGPUMemUsed          = metricFamily{"nvsmibar_gpu_memory_used_bytes", "GPU memory in use."}
+	metricGPUMemTotal         = metricFamily{"nvsmibar_gpu_memory_total_bytes", "Total GPU memory."}
+	metricGPUPowerDraw        = metricFamily{"nvsmibar_gpu_power_draw_watts", "GPU power draw."}
+	metricGPUPowerLimit       = metricFamily{"nvsmibar_gpu_power_limit_watts", "GPU power limit."}
+	metricGPUFan              = metricFamily{"nvsmibar_gpu_fan_speed_percent", "GPU fan speed."}
+)
+
+type metricSample struct {
+	labels string
+	value  float64
+}
+
+// writeMetrics renders snapshots in the Prometheus text format. Readings
+// nvidia-smi reported as unsupported (-1) are omitted rather than exported
+// as bogus values; GPUs of stale hosts keep their last values with up=0.
+func writeMetrics(w io.Writer, snapshots []ConnectionSnapshot) {
+	samples := map[metricFamily][]metricSample{}
+	add := func(f metricFamily, labels string, v float64) {
+		samples[f] = append(samples[f], metricSample{labels: labels, value: v})
+	}
+
+	for _, snap := range snapshots {
+		host := labelSet("connection", snap.ID, "target", snap.Meta.ActiveTarget)
+		up := 0.0
+		if snap.Meta.Status == "live" {
+			up = 1
+		}
+		add(metricUp, host, up)
+		add(metricConsecutiveFailures, host, float64(snap.Meta.ConsecutiveFailures))
+		if snap.Meta.LastSuccessTs > 0 {
+			add(metricLastSuccess, host, float64(snap.Meta.LastSuccessTs))
+		}
+		if snap.Meta.Status != "live" && snap.Meta.Status != "stale" {
+			continue
+		}
+
+		for _, g := range snap.GPUs {
+			labels := labelSet(
+				"connection", snap.ID,
+				"target", snap.Meta.ActiveTarget,
+				"gpu", strconv.Itoa(g.Index),
+				"name", g.Name,
+				"uuid", g.UUID,
+			)
+			addOptional := func(f metricFamily, v int, scale float64) {
+				if v >= 0 {
+					add(f, labels, float64(v)*scale)
+				}
+			}
+			addOptional(metricGPUUtil, g.Util, 1)
+			addOptional(metricGPUTemp, g.Temp, 1)
+			addOptional(metricGPUMemUsed, g.MemUsed, 1024*1024)
+			addOptional(metricGPUMemTotal, g.MemTotal, 1024*1024)
+			addOptional(metricGPUPowerDraw, g.PowerDraw, 1)
+			addOptional(metricGPUPowerLimit, g.PowerLimit, 1)
+			addOptional(metricGPUFan, g.FanSpeed, 1)
+		}
+	}
+
+	families := []metricFamily{
+		metricUp, metricConsecutiveFailures, metricLastSuccess,
+		metricGPUUtil, metricGPUTemp, metricGPUMemUsed, metricGPUMemTotal,
+		metricGPUPowerDraw, metricGPUPowerLimit, metricGPUFan,
+	}
+	for _, f := range families {
+		if len(samples[f]) == 0 {
+			continue
+		}
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n", f.name, f.help, f.name)
+		for _, s := range samples[f] {
+			fmt.Fprintf(w, "%s{%s} %s\n", f.name, s.labels, strconv.FormatFloat(s.value, 'g', -1, 64))
+		}
+	}
+}
+
+func labelSet(kv ...string) string {
+	parts := make([]string, 0, len(kv)/2)
+	for i := 0; i+1 < len(kv); i += 2 {
+		parts = append(parts, kv[i]+`="`+escapeLabelValue(kv[i+1])+`"`)
+	}
+	return strings.Join(parts, ",")
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabelValue(v string) string {
+	return labelEscaper.Replace(v)
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func sampleSnapshots() []ConnectionSnapshot {
+	return []ConnectionSnapshot{
+		{
+			ID:   "conn_a",
+			Meta: ConnectionMeta{Status: "live", ActiveTarget: "alice@box-a", LastSuccessTs: 1700000000},
+			GPUs: []GPU{{Index: 0, Name: `NVIDIA "A100"`, UUID: "GPU-aaa", Util: 97, Temp: 71, MemUsed: 1024, MemTotal: 40960, PowerDraw: 250, PowerLimit: 400, FanSpeed: -1}},
+		},
+		{
+			ID:   "conn_b",
+			Meta: ConnectionMeta{Status: "error", ActiveTarget: "box-b", ConsecutiveFailures: 7},
+			GPUs: []GPU{{Index: 0, Name: "old", Util: 10}},
+		},
+	}
+}
+
+func TestWriteMetrics(t *testing.T) {
+	var buf bytes.Buffer
+	writeMetrics(&buf, sampleSnapshots())
+	out := buf.String()
+
+	for _, want := range []string{
+		"# TYPE nvsmibar_up gauge",
+		`nvsmibar_up{connection="conn_a",target="alice@box-a"} 1`,
+		`nvsmibar_up{connection="conn_b",target="box-b"} 0`,
+		`nvsmibar_consecutive_failures{connection="conn_b",target="box-b"} 7`,
+		`nvsmibar_last_success_timestamp_seconds{connection="conn_a",target="alice@box-a"} 1.7e+09`,
+		`nvsmibar_gpu_utilization_percent{connection="conn_a",target="alice@box-a",gpu="0",name="NVIDIA \"A100\"",uuid="GPU-aaa"} 97`,
+		`nvsmibar_gpu_memory_used_bytes{connection="conn_a",target="alice@box-a",gpu="0",name="NVIDIA \"A100\"",uuid="GPU-aaa"} 1.073741824e+09`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("expected %q in output:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "nvsmibar_gpu_fan_speed_percent") {
+		t.Fatalf("unsupported fan speed should be omitted:\n%s", out)
+	}
+	if strings.Contains(out, `connection="conn_b",target="box-b",gpu=`) {
+		t.Fatalf("GPUs of hosts in error state should be omitted:\n%s", out)
+	}
+}
+
+func TestMetricsHandler(t *testing.T) {
+	exporter := newMetricsExporter(sampleSnapshots)
+	server := httptest.NewServer(exporter.handler())
+	defer server.Close()
+
+	resp, err := server.Client().Get(server.URL + "/metrics")
+	if err != nil {
+		t.Fatalf("GET /metrics: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/plain; version=0.0.4") {
+		t.Fatalf("unexpected content type %q", resp.Header.Get("Content-Type"))
+	}
+	if !strings.Contains(string(body), "nvsmibar_gpu_temperature_celsius") {
+		t.Fatalf("unexpected body:\n%s", body)
+	}
+}
+
+func TestSetMetricsExporterPersists(t *testing.T) {
+	a, _ := newTestApp(nil)
+	defer a.metrics.stop()
+
+	if err := a.SetMetricsExporter(true, "127.0.0.1:0"); err != nil {
+		t.Fatalf("SetMetricsExporter returned error: %v", err)
+	}
+	if cfg := a.GetMetricsExporter(); !cfg.Enabled || cfg.Addr != "127.0.0.1:0" {
+		t.Fatalf("unexpected config: %+v", cfg)
+	}
+	if err := a.SetMetricsExporter(false, ""); err != nil {
+		t.Fatalf("SetMetricsExporter returned error: %v", err)
+	}
+	if a.metrics.server != nil {
+		t.Fatal("expected server to be stopped")
+	}
+}
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultConnectionID identifies the connection driven by the legacy
+// SetConnection/SetHost bindings.
+const defaultConnectionID = "default"
+
+// ConnectionSnapshot is the latest known state of one watched connection.
+type ConnectionSnapshot struct {
+	ID   string         `json:"id"`
+	Meta ConnectionMeta `json:"meta"`
+	GPUs []GPU          `json:"gpus"`
+	// Host is nil unless the profile enables host metrics.
+	Host *HostStats `json:"host"`
+}
+
+// connectionWorker polls a single host on its own goroutine.
+type connectionWorker struct {
+	id     string
+	target string
+	port   int
+
+	stopCh    chan struct{}
+	pollNowCh chan struct{}
+	// rescheduleCh asks the worker to re-plan its next poll.
+	rescheduleCh chan struct{}
+
+	mu   sync.Mutex
+	meta ConnectionMeta
+	gpus []GPU
+	host *HostStats
+}
+
+func newConnectionWorker(id, target string, port int) *connectionWorker {
+	return &connectionWorker{
+		id:           id,
+		target:       target,
+		port:         port,
+		stopCh:       make(chan struct{}),
+		pollNowCh:    make(chan struct{}, 1),
+		rescheduleCh: make(chan struct{}, 1),
+		meta:         ConnectionMeta{ConnectionID: id, Status: "connecting", ActiveTarget: target, ActivePort: port},
+		gpus:         []GPU{},
+	}
+}
+
+func (w *connectionWorker) wake() {
+	select {
+	case w.pollNowCh <- struct{}{}:
+	default:
+	}
+}
+
+func (w *connectionWorker) reschedule() {
+	select {
+	case w.rescheduleCh <- struct{}{}:
+	default:
+	}
+}
+
+func (w *connectionWorker) snapshot() ConnectionSnapshot {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	gpus := make([]GPU, len(w.gpus))
+	copy(gpus, w.gpus)
+	return ConnectionSnapshot{ID: w.id, Meta: w.meta, GPUs: gpus, Host: w.host}
+}
+
+// WatchConnection starts polling target under id, replacing any existing
+// worker with the same id whose target or port differs.
+func (a *App) WatchConnection(id string, target string, port int) {
+	id = strings.TrimSpace(id)
+	target = strings.TrimSpace(target)
+	if id == "" {
+		return
+	}
+	if target == "" {
+		a.UnwatchConnection(id)
+		return
+	}
+
+	a.mu.Lock()
+	if existing, ok := a.workers[id]; ok {
+		if existing.target == target && existing.port == port {
+			a.mu.Unlock()
+			existing.wake()
+			return
+		}
+		close(existing.stopCh)
+		delete(a.workers, id)
+	}
+	w := newConnectionWorker(id, target, port)
+	a.workers[id] = w
+	a.workerWG.Add(1)
+	a.mu.Unlock()
+
+	go a.runWorker(w)
+}
+
+// UnwatchConnection stops polling the connection with the given id.
+func (a *App) UnwatchConnection(id string) {
+	a.mu.Lock()
+	w, ok := a.workers[id]
+	if ok {
+		close(w.stopCh)
+		delete(a.workers, id)
+	}
+	a.mu.Unlock()
+	if ok {
+		a.alerts.forget(id)
+		a.notifications.forget(id)
+		a.webhooks.forget(id)
+		a.emit("gpu:conn_meta", ConnectionMeta{ConnectionID: id, Status: "idle"}, id)
+		a.updateTray(id, "idle", nil)
+	}
+}
+
+// GetConnectionSnapshots returns the latest data of every watched connection.
+func (a *App) GetConnectionSnapshots() []ConnectionSnapshot {
+	a.mu.Lock()
+	workers := make([]*connectionWorker, 0, len(a.workers))
+	for _, w := range a.workers {
+		workers = append(workers, w)
+	}
+	a.mu.Unlock()
+
+	snapshots := make([]ConnectionSnapshot, 0, len(workers))
+	for _, w := range workers {
+		snapshots = append(snapshots, w.snapshot())
+	}
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].ID < snapshots[j].ID
+	})
+	return snapshots
+}
+
+func (a *App) stopAllWorkers() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for id, w := range a.workers {
+		close(w.stopCh)
+		delete(a.workers, id)
+	}
+}
+
+func newConnMeta(id string, status string, lastSuccess time.Time, failures int, nextRetryAt time.Time, lastErr *pollError, target string, port int, now time.Time) ConnectionMeta {
+	meta := ConnectionMeta{
+		ConnectionID:        id,
+		Status:              status,
+		ConsecutiveFailures: failures,
+		ActiveTarget:        target,
+		ActivePort:          port,
+	}
+	if lastErr != nil {
+		meta.ErrorCode, meta.ErrorMessage, meta.ErrorHint = lastErr.Code, lastErr.Message, lastErr.Hint
+	}
+	if !lastSuccess.IsZero() {
+		meta.LastSuccessTs = lastSuccess.Unix()
+	}
+	if !nextRetryAt.IsZero() && nextRetryAt.After(now) {
+		remaining := int(nextRetryAt.Sub(now).Seconds())
+		if remaining <= 0 {
+			remaining = 1
+		}
+		meta.NextRetryInSec = remaining
+	}
+	return meta
+}
+
+// onPollResult runs after every poll attempt with the meta just published
+// at now. gpus is nil when the attempt failed.
+func (a *App) onPollResult(id string, meta ConnectionMeta, gpus []GPU, now time.Time) {
+	a.recordProfileStatus(id, meta)
+	a.evaluateAlerts(id, meta, gpus, now)
+	a.deliverNotifications(a.notifications.observe(id, meta, gpus, now))
+	a.webhooks.observe(id, meta, gpus, now)
+	if gpus != nil {
+		a.recorder.record(id, meta.ActiveTarget, gpus)
+	}
+}
+
+// runWorker polls w until it is stopped. A pollScheduler picks the time of
+// each poll from the profile's interval, the window and power state, and
+// recent failures; wake forces a poll and reschedule re-plans the next one.
+func (a *App) runWorker(w *connectionWorker) {
+	defer a.workerWG.Done()
+	target, port := w.target, w.port
+	status := "connecting"
+	var lastSuccess time.Time
+	var lastErr *pollError
+	var prevHost *hostSample
+	sched := newPollScheduler(a.pollSettings(w.id))
+	pollState := pollFast
+	var nextPoll time.Time
+
+	publish := func(now time.Time) ConnectionMeta {
+		var nextRetryAt time.Time
+		if pollState == pollBackoff {
+			nextRetryAt = nextPoll
+		}
+		meta := newConnMeta(w.id, status, lastSuccess, sched.failures, nextRetryAt, lastErr, target, port, now)
+		meta.PollState = pollState
+		w.mu.Lock()
+		w.meta = meta
+		gpus := w.gpus
+		w.mu.Unlock()
+		a.emit("gpu:conn_meta", meta, w.id)
+		a.updateTray(w.id, meta.Status, gpus)
+		return meta
+	}
+
+	publish(a.clock.Now())
+
+	for {
+		now := a.clock.Now()
+		sched.configure(a.pollSettings(w.id))
+		state, due := sched.next(now, a.pollEnv())
+		nextPoll = due
+		if state != pollState {
+			pollState = state
+			publish(now)
+		}
+
+		if state == pollPaused || now.Before(due) {
+			// A nil timer never fires: a paused worker waits for a
+			// reschedule or a manual retry.
+			var timer <-chan time.Time
+			if state != pollPaused {
+				wait := due.Sub(now)
+				if state == pollBackoff {
+					// Wake every second to count the retry down in the meta.
+					wait = min(wait, time.Second)
+				}
+				timer = a.clock.After(wait)
+			}
+			select {
+			case <-a.stopCh:
+				return
+			case <-w.stopCh:
+				return
+			case <-w.rescheduleCh:
+				continue
+			case <-timer:
+				if state == pollBackoff {
+					publish(a.clock.Now())
+				}
+				continue
+			case <-w.pollNowCh:
+			}
+		}
+
+		now = a.clock.Now()
+		if lastSuccess.IsZero() {
+			status = "connecting"
+			publish(now)
+		}
+
+		snap, err := a.collect(w.id, target, port)
+		gpus := snap.GPUs
+
+		// The worker may have been replaced or removed while the query ran.
+		select {
+		case <-w.stopCh:
+			return
+		default:
+		}
+
+		if err == nil {
+			var host *HostStats
+			if snap.host != nil {
+				stats := hostStats(prevHost, *snap.host)
+				host = &stats
+			}
+			prevHost = snap.host
+			w.mu.Lock()
+			w.gpus = gpus
+			w.host = host
+			w.mu.Unlock()
+			a.emit("gpu:data", gpus, w.id)
+			a.emit("gpu:host", host, w.id)
+			// Recorded before publishing so the tray sparkline includes
+			// this poll.
+			a.history.record(w.id, gpus, now)
+			lastSuccess = now
+			lastErr = nil
+			status = "live"
+			sched.succeeded(now, gpus)
+			pollState, nextPoll = sched.next(now, a.pollEnv())
+			a.onPollResult(w.id, publish(now), gpus, now)
+			continue
+		}
+
+		lastErr = classifyError(err)
+		a.emit("gpu:error", lastErr.Message, w.id)
+		sched.failed(now, lastErr.Retryable)
+		pollState, nextPoll = sched.next(now, a.pollEnv())
+
+		if !lastSuccess.IsZero() {
+			status = "stale"
+			if sched.failures >= 6 {
+				status = "error"
+			}
+		} else {
+			status = "error"
+		}
+
+		a.onPollResult(w.id, publish(now), nil, now)
+	}
+}
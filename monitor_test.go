@@ -0,0 +1,129 @@
+package main
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+type recordedEvent struct {
+	name string
+	data []interface{}
+}
+
+type eventRecorder struct {
+	mu     sync.Mutex
+	events []recordedEvent
+}
+
+func (r *eventRecorder) emit(event string, data ...interface{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, recordedEvent{name: event, data: data})
+}
+
+func (r *eventRecorder) find(name string, connectionID string) []recordedEvent {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var out []recordedEvent
+	for _, e := range r.events {
+		if e.name == name && len(e.data) == 2 && e.data[1] == connectionID {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+func newTestApp(query func(target string, port int) ([]GPU, error)) (*App, *eventRecorder) {
+	rec := &eventRecorder{}
+	a := NewApp()
+	a.emit = rec.emit
+	a.query = query
+	a.poll = func(target string, port int, req probeRequest) (probeSnapshot, error) {
+		gpus, err := query(target, port)
+		return probeSnapshot{GPUs: gpus}, err
+	}
+	a.store = newConfigStore("")
+	a.recorder = newRecorder("", time.Now)
+	a.notifier = noopNotifier{}
+	return a, rec
+}
+
+// stopTestWorkers stops a's workers and waits for them to return, so none
+// outlives its test.
+func stopTestWorkers(a *App) {
+	a.stopAllWorkers()
+	a.workerWG.Wait()
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if cond() {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatal("condition not met before deadline")
+}
+
+func TestWatchConnectionsPollConcurrently(t *testing.T) {
+	a, rec := newTestApp(func(target string, port int) ([]GPU, error) {
+		if target == "box-b" {
+			return nil, sshFailure("ssh: connect to host box-b port 22: Connection refused")
+		}
+		return []GPU{{Index: 0, Name: target, Util: 50}}, nil
+	})
+	defer stopTestWorkers(a)
+
+	a.WatchConnection("a", "box-a", 22)
+	a.WatchConnection("b", "box-b", 0)
+
+	waitFor(t, func() bool {
+		return len(rec.find("gpu:data", "a")) > 0 && len(rec.find("gpu:error", "b")) > 0
+	})
+
+	data := rec.find("gpu:data", "a")[0].data[0].([]GPU)
+	if data[0].Name != "box-a" {
+		t.Fatalf("unexpected data for connection a: %+v", data)
+	}
+	if len(rec.find("gpu:data", "b")) != 0 {
+		t.Fatal("connection b should not have emitted data")
+	}
+
+	snapshots := a.GetConnectionSnapshots()
+	if len(snapshots) != 2 || snapshots[0].ID != "a" || snapshots[1].ID != "b" {
+		t.Fatalf("unexpected snapshots: %+v", snapshots)
+	}
+	if snapshots[0].Meta.Status != "live" || len(snapshots[0].GPUs) != 1 {
+		t.Fatalf("unexpected snapshot a: %+v", snapshots[0])
+	}
+	if snapshots[1].Meta.Status != "error" || snapshots[1].Meta.ErrorCode != "refused" {
+		t.Fatalf("unexpected snapshot b: %+v", snapshots[1])
+	}
+}
+
+func TestUnwatchConnectionEmitsIdle(t *testing.T) {
+	a, rec := newTestApp(func(target string, port int) ([]GPU, error) {
+		return []GPU{{Index: 0}}, nil
+	})
+	defer stopTestWorkers(a)
+
+	a.SetConnection("box-a", 22)
+	waitFor(t, func() bool { return len(rec.find("gpu:data", defaultConnectionID)) > 0 })
+
+	a.SetConnection("", 0)
+	if len(a.GetConnectionSnapshots()) != 0 {
+		t.Fatal("expected no watched connections")
+	}
+	sawIdle := false
+	for _, e := range rec.find("gpu:conn_meta", defaultConnectionID) {
+		if e.data[0].(ConnectionMeta).Status == "idle" {
+			sawIdle = true
+		}
+	}
+	if !sawIdle {
+		t.Fatal("expected idle meta after unwatch")
+	}
+}
@@ -0,0 +1,335 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultNotifyMinIntervalSec = 60
+
+	// A GPU counts as running a job once utilization stays at or above
+	// jobBusyUtil for jobBusyFor; the job is finished when it then stays at
+	// or below jobIdleUtil for jobIdleFor.
+	jobBusyUtil = 50
+	jobIdleUtil = 5
+	jobBusyFor  = 5 * time.Minute
+	jobIdleFor  = 30 * time.Second
+)
+
+// NotificationConfig controls desktop notifications.
+type NotificationConfig struct {
+	Enabled bool `json:"enabled"`
+	// MutedProfiles lists connection IDs that never notify.
+	MutedProfiles []string `json:"mutedProfiles"`
+	// JobFinished notifies when a GPU goes idle after sustained load.
+	JobFinished bool `json:"jobFinished"`
+	// Alerts notifies when an alert rule fires.
+	Alerts bool `json:"alerts"`
+	// MinIntervalSec is the minimum time between two notifications of the
+	// same kind (status, job, alert) about the same connection; more are
+	// dropped. Recovery notices are always sent.
+	MinIntervalSec int `json:"minIntervalSec"`
+}
+
+func defaultNotificationConfig() NotificationConfig {
+	return NotificationConfig{Enabled: true, MutedProfiles: []string{}, JobFinished: true, Alerts: true, MinIntervalSec: defaultNotifyMinIntervalSec}
+}
+
+func normalizeNotificationConfig(cfg NotificationConfig) NotificationConfig {
+	if cfg.MinIntervalSec < 0 {
+		cfg.MinIntervalSec = 0
+	}
+	if cfg.MutedProfiles == nil {
+		cfg.MutedProfiles = []string{}
+	}
+	return cfg
+}
+
+// notification is one desktop notification.
+type notification struct {
+	title  string
+	body   string
+	urgent bool
+}
+
+// notifier delivers desktop notifications. Platform backends live in
+// notify_*.go; tests substitute a recorder.
+type notifier interface {
+	notify(n notification) error
+}
+
+type noopNotifier struct{}
+
+func (noopNotifier) notify(n notification) error { return nil }
+
+type jobState struct {
+	busySince time.Time
+	loaded    bool
+	idleSince time.Time
+}
+
+type connNotifyState struct {
+	status   string
+	degraded bool                 // a stale or down notification went out
+	lastSent map[string]time.Time // by notification kind
+	jobs     map[int]*jobState
+}
+
+// Notification kinds share a rate limit; notifyRecovery is never limited so
+// a short outage is always closed out.
+const (
+	notifyStatus   = "status"
+	notifyRecovery = "recovery"
+	notifyJob      = "job"
+	notifyAlert    = "alert"
+)
+
+// notificationEngine turns poll results and alert events into notifications.
+// Like alertEngine it is driven by the timestamps passed in.
+type notificationEngine struct {
+	mu    sync.Mutex
+	cfg   NotificationConfig
+	conns map[string]*connNotifyState
+}
+
+func newNotificationEngine(cfg NotificationConfig) *notificationEngine {
+	return &notificationEngine{cfg: normalizeNotificationConfig(cfg), conns: map[string]*connNotifyState{}}
+}
+
+func (e *notificationEngine) configure(cfg NotificationConfig) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.cfg = normalizeNotificationConfig(cfg)
+}
+
+// forget discards state for a connection that is no longer watched.
+func (e *notificationEngine) forget(connectionID string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	delete(e.conns, connectionID)
+}
+
+func (e *notificationEngine) state(connectionID string) *connNotifyState {
+	st := e.conns[connectionID]
+	if st == nil {
+		st = &connNotifyState{lastSent: map[string]time.Time{}, jobs: map[int]*jobState{}}
+		e.conns[connectionID] = st
+	}
+	return st
+}
+
+// observe feeds one published status into the engine. gpus is nil when the
+// poll failed. State is tracked even while muted so unmuting does not replay
+// old transitions.
+func (e *notificationEngine) observe(connectionID string, meta ConnectionMeta, gpus []GPU, now time.Time) []notification {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	st := e.state(connectionID)
+	host := meta.ActiveTarget
+	var out []notification
+
+	prev := st.status
+	st.status = meta.Status
+	if prev != meta.Status {
+		switch {
+		case meta.Status == "stale" && prev == "live":
+			if e.allow(connectionID, st, notifyStatus, now) {
+				st.degraded = true
+				out = append(out, notification{
+					title: host + " is not responding",
+					body:  "Showing the last data received.",
+				})
+			}
+		case meta.Status == "error" && (prev == "live" || prev == "stale"):
+			body := "Retrying in the background."
+			if meta.ErrorMessage != "" {
+				body = meta.ErrorMessage
+			}
+			if e.allow(connectionID, st, notifyStatus, now) {
+				st.degraded = true
+				out = append(out, notification{title: host + " is down", body: body, urgent: true})
+			}
+		case meta.Status == "live" && st.degraded:
+			if e.allow(connectionID, st, notifyRecovery, now) {
+				st.degraded = false
+				out = append(out, notification{
+					title: host + " recovered",
+					body:  "Receiving GPU data again.",
+				})
+			}
+		}
+	}
+
+	done, durations := finishedJobs(st.jobs, gpus, now)
+	for i, g := range done {
+		if !e.cfg.JobFinished || !e.allow(connectionID, st, notifyJob, now) {
+			break
+		}
+		out = append(out, notification{
+			title: fmt.Sprintf("Job finished on %s GPU %d", host, g.Index),
+			body:  fmt.Sprintf("Utilization dropped to %d%% after %s of load.", g.Util, formatNotifyDuration(durations[i])),
+		})
+	}
+	return out
+}
+
+// alert turns a fired alert event into a notification.
+func (e *notificationEngine) alert(ev AlertEvent, now time.Time) []notification {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if ev.State != "fired" || !e.cfg.Alerts {
+		return nil
+	}
+	if !e.allow(ev.ConnectionID, e.state(ev.ConnectionID), notifyAlert, now) {
+		return nil
+	}
+	return []notification{{title: ev.RuleName, body: ev.Message, urgent: true}}
+}
+
+// allow reports whether a notification of kind may go out now, and records
+// it as sent if so. It may not when notifications are off, the connection
+// is muted, or one of the same kind was sent within the minimum interval.
+func (e *notificationEngine) allow(connectionID string, st *connNotifyState, kind string, now time.Time) bool {
+	if !e.cfg.Enabled || e.muted(connectionID) {
+		return false
+	}
+	if kind != notifyRecovery {
+		last, ok := st.lastSent[kind]
+		if ok && now.Sub(last) < time.Duration(e.cfg.MinIntervalSec)*time.Second {
+			return false
+		}
+	}
+	st.lastSent[kind] = now
+	return true
+}
+
+func (e *notificationEngine) muted(connectionID string) bool {
+	for _, id := range e.cfg.MutedProfiles {
+		if id == connectionID {
+			return true
+		}
+	}
+	return false
+}
+
+// advance feeds one utilization sample into the job-finished heuristic and
+// reports how long the finished job ran.
+func (j *jobState) advance(util int, now time.Time) (time.Duration, bool) {
+	switch {
+	case util < 0:
+	case util >= jobBusyUtil:
+		j.idleSince = time.Time{}
+		if j.busySince.IsZero() {
+			j.busySince = now
+		}
+		if now.Sub(j.busySince) >= jobBusyFor {
+			j.loaded = true
+		}
+	case util <= jobIdleUtil:
+		if !j.loaded {
+			j.busySince = time.Time{}
+			break
+		}
+		if j.idleSince.IsZero() {
+			j.idleSince = now
+		}
+		if now.Sub(j.idleSince) >= jobIdleFor {
+			d := j.idleSince.Sub(j.busySince)
+			*j = jobState{}
+			return d, true
+		}
+	default:
+		// Moderate load keeps a running job alive but does not start one.
+		j.idleSince = time.Time{}
+		if !j.loaded {
+			j.busySince = time.Time{}
+		}
+	}
+	return 0, false
+}
+
+// finishedJobs advances the job heuristic for every GPU in gpus and returns
+// the GPUs whose job just finished with the job durations.
+func finishedJobs(jobs map[int]*jobState, gpus []GPU, now time.Time) ([]GPU, []time.Duration) {
+	var done []GPU
+	var durations []time.Duration
+	for _, g := range gpus {
+		j := jobs[g.Index]
+		if j == nil {
+			j = &jobState{}
+			jobs[g.Index] = j
+		}
+		if d, ok := j.advance(g.Util, now); ok {
+			done = append(done, g)
+			durations = append(durations, d)
+		}
+	}
+	return done, durations
+}
+
+func formatNotifyDuration(d time.Duration) string {
+	d = d.Round(time.Minute)
+	if d < time.Hour {
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	}
+	return strings.TrimSuffix(fmt.Sprintf("%dh%02dm", int(d.Hours()), int(d.Minutes())%60), "00m")
+}
+
+// deliverNotifications hands notifications to the platform off the poll
+// goroutine; a slow notification daemon must not delay polling.
+func (a *App) deliverNotifications(ns []notification) {
+	if len(ns) == 0 {
+		return
+	}
+	go func() {
+		for _, n := range ns {
+			if err := a.notifier.notify(n); err != nil {
+				println("notify:", err.Error())
+				return
+			}
+		}
+	}()
+}
+
+// GetNotificationConfig returns the desktop notification settings.
+func (a *App) GetNotificationConfig() NotificationConfig {
+	return a.notificationConfig()
+}
+
+func (a *App) notificationConfig() NotificationConfig {
+	cfg := a.store.snapshot().Notifications
+	if cfg == nil {
+		return defaultNotificationConfig()
+	}
+	return normalizeNotificationConfig(*cfg)
+}
+
+// SetNotificationConfig applies and persists the desktop notification
+// settings.
+func (a *App) SetNotificationConfig(cfg NotificationConfig) error {
+	cfg = normalizeNotificationConfig(cfg)
+	a.notifications.configure(cfg)
+	return a.store.update(func(c *appConfig) {
+		c.Notifications = &cfg
+	})
+}
+
+// SetProfileMuted mutes or unmutes notifications for one profile.
+func (a *App) SetProfileMuted(id string, muted bool) error {
+	cfg := a.notificationConfig()
+	kept := []string{}
+	for _, m := range cfg.MutedProfiles {
+		if m != id {
+			kept = append(kept, m)
+		}
+	}
+	if muted {
+		kept = append(kept, id)
+	}
+	cfg.MutedProfiles = kept
+	return a.SetNotificationConfig(cfg)
+}
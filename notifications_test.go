@@ -0,0 +1,190 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type notifyStep struct {
+	status string
+	util   int
+}
+
+// feedNotifications publishes one status per second and returns the titles
+// of notifications produced.
+func feedNotifications(e *notificationEngine, start time.Time, steps []notifyStep) []string {
+	var titles []string
+	for i, s := range steps {
+		now := start.Add(time.Duration(i) * time.Second)
+		meta := ConnectionMeta{Status: s.status, ActiveTarget: "box"}
+		var gpus []GPU
+		if s.status == "live" {
+			gpus = []GPU{{Index: 0, Util: s.util}}
+		}
+		for _, n := range e.observe("conn", meta, gpus, now) {
+			titles = append(titles, n.title)
+		}
+	}
+	return titles
+}
+
+func statusSteps(statuses ...string) []notifyStep {
+	steps := make([]notifyStep, len(statuses))
+	for i, s := range statuses {
+		steps[i] = notifyStep{status: s, util: 20}
+	}
+	return steps
+}
+
+func TestNotifyStatusTransitions(t *testing.T) {
+	cfg := defaultNotificationConfig()
+	cfg.MinIntervalSec = 0
+	e := newNotificationEngine(cfg)
+	start := time.Unix(1700000000, 0)
+
+	got := feedNotifications(e, start, statusSteps("connecting", "live", "live", "stale", "stale", "error", "error", "live"))
+	want := []string{"box is not responding", "box is down", "box recovered"}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+
+	// A host that never connected does not notify on failure or recovery.
+	e.forget("conn")
+	if got := feedNotifications(e, start, statusSteps("connecting", "error", "live")); len(got) != 0 {
+		t.Fatalf("expected no notifications for a first connection, got %q", got)
+	}
+}
+
+func TestNotifyRateLimitAndMute(t *testing.T) {
+	cfg := defaultNotificationConfig()
+	cfg.MinIntervalSec = 60
+	e := newNotificationEngine(cfg)
+	start := time.Unix(1700000000, 0)
+
+	// Down follows stale within the interval and is dropped; since the
+	// outage was reported, recovery still is once the interval has passed.
+	got := feedNotifications(e, start, statusSteps("live", "stale", "error"))
+	if len(got) != 1 || got[0] != "box is not responding" {
+		t.Fatalf("expected only the first notification, got %q", got)
+	}
+	if got := feedNotifications(e, start.Add(2*time.Minute), statusSteps("live")); len(got) != 1 || got[0] != "box recovered" {
+		t.Fatalf("expected recovery, got %q", got)
+	}
+
+	cfg.MutedProfiles = []string{"conn"}
+	e.configure(cfg)
+	if got := feedNotifications(e, start.Add(time.Hour), statusSteps("stale", "error")); len(got) != 0 {
+		t.Fatalf("muted connection notified: %q", got)
+	}
+	ev := AlertEvent{RuleName: "Hot", ConnectionID: "conn", State: "fired"}
+	if got := e.alert(ev, start.Add(2*time.Hour)); len(got) != 0 {
+		t.Fatalf("muted connection notified alert: %+v", got)
+	}
+	cfg.MutedProfiles = nil
+	e.configure(cfg)
+	if got := e.alert(ev, start.Add(3*time.Hour)); len(got) != 1 || got[0].title != "Hot" || !got[0].urgent {
+		t.Fatalf("expected alert notification, got %+v", got)
+	}
+	ev.State = "resolved"
+	if got := e.alert(ev, start.Add(4*time.Hour)); len(got) != 0 {
+		t.Fatalf("resolved alerts should not notify, got %+v", got)
+	}
+}
+
+func TestNotifyRecoveryInsideInterval(t *testing.T) {
+	cfg := defaultNotificationConfig()
+	cfg.MinIntervalSec = 60
+	e := newNotificationEngine(cfg)
+	start := time.Unix(1700000000, 0)
+
+	// A blip shorter than the interval is still closed out.
+	got := feedNotifications(e, start, statusSteps("live", "stale", "live"))
+	want := []string{"box is not responding", "box recovered"}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+
+	// An alert does not use up the rate limit of the host going down.
+	ev := AlertEvent{RuleName: "Hot", ConnectionID: "conn", State: "fired"}
+	later := start.Add(2 * time.Minute)
+	if got := e.alert(ev, later); len(got) != 1 {
+		t.Fatalf("expected alert notification, got %+v", got)
+	}
+	if got := feedNotifications(e, later, statusSteps("live", "error")); len(got) != 1 || got[0] != "box is down" {
+		t.Fatalf("expected down notification after an alert, got %q", got)
+	}
+}
+
+func TestNotifyJobFinished(t *testing.T) {
+	cfg := defaultNotificationConfig()
+	cfg.MinIntervalSec = 0
+	e := newNotificationEngine(cfg)
+	start := time.Unix(1700000000, 0)
+
+	var steps []notifyStep
+	add := func(n, util int) {
+		for i := 0; i < n; i++ {
+			steps = append(steps, notifyStep{status: "live", util: util})
+		}
+	}
+	// A one-minute burst is not a job.
+	add(60, 95)
+	add(60, 0)
+	// Over ten minutes of load with a short dip, then idle.
+	add(400, 95)
+	add(20, 0)
+	add(300, 90)
+	add(60, 1)
+
+	got := feedNotifications(e, start, steps)
+	if len(got) != 1 || got[0] != "Job finished on box GPU 0" {
+		t.Fatalf("expected one job-finished notification, got %q", got)
+	}
+	if d := formatNotifyDuration(720 * time.Second); d != "12m" {
+		t.Fatalf("unexpected duration %q", d)
+	}
+}
+
+type recordingNotifier struct {
+	mu   sync.Mutex
+	sent []notification
+}
+
+func (r *recordingNotifier) notify(n notification) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sent = append(r.sent, n)
+	return nil
+}
+
+func (r *recordingNotifier) count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.sent)
+}
+
+func TestHostDownNotifiesThroughNotifier(t *testing.T) {
+	a, _ := newTestApp(nil)
+	n := &recordingNotifier{}
+	a.notifier = n
+	if err := a.SetNotificationConfig(NotificationConfig{Enabled: true, MinIntervalSec: 0}); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	a.onPollResult("conn", ConnectionMeta{Status: "live", ActiveTarget: "box"}, []GPU{{Index: 0, Util: 10}}, now)
+	a.onPollResult("conn", ConnectionMeta{Status: "error", ActiveTarget: "box", LastSuccessTs: now.Unix()}, nil, now.Add(time.Second))
+	waitFor(t, func() bool { return n.count() == 1 })
+	if !n.sent[0].urgent || n.sent[0].title != "box is down" {
+		t.Fatalf("unexpected notification %+v", n.sent[0])
+	}
+
+	if err := a.SetProfileMuted("conn", true); err != nil {
+		t.Fatal(err)
+	}
+	if cfg := a.GetNotificationConfig(); len(cfg.MutedProfiles) != 1 || cfg.MutedProfiles[0] != "conn" {
+		t.Fatalf("mute not persisted: %+v", cfg)
+	}
+}
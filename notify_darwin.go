@@ -0,0 +1,28 @@
+package main
+
+import (
+	"os/exec"
+	"strings"
+)
+
+// osascriptNotifier posts notifications through Notification Center via
+// osascript, which needs no bundle entitlements.
+type osascriptNotifier struct{}
+
+func newPlatformNotifier() notifier {
+	return osascriptNotifier{}
+}
+
+func (osascriptNotifier) notify(n notification) error {
+	script := "display notification " + appleScriptString(n.body) + " with title " + appleScriptString(n.title)
+	if n.urgent {
+		script += ` sound name "Funk"`
+	}
+	return exec.Command("osascript", "-e", script).Run()
+}
+
+func appleScriptString(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	return `"` + s + `"`
+}
@@ -0,0 +1,56 @@
+//go:build linux
+
+package main
+
+import (
+	"sync"
+
+	"github.com/godbus/dbus/v5"
+)
+
+const (
+	notifyName = "org.freedesktop.Notifications"
+	notifyPath = dbus.ObjectPath("/org/freedesktop/Notifications")
+)
+
+// dbusNotifier sends notifications through the freedesktop notification
+// service. The session bus is connected on first use and reconnected after
+// a failed call.
+type dbusNotifier struct {
+	connect func() (sniBus, error)
+
+	mu  sync.Mutex
+	bus sniBus
+}
+
+func newPlatformNotifier() notifier {
+	return &dbusNotifier{connect: connectSessionBus}
+}
+
+func (d *dbusNotifier) notify(n notification) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.bus == nil {
+		bus, err := d.connect()
+		if err != nil {
+			return err
+		}
+		d.bus = bus
+	}
+
+	urgency := byte(1)
+	if n.urgent {
+		urgency = 2
+	}
+	hints := map[string]dbus.Variant{
+		"urgency":       dbus.MakeVariant(urgency),
+		"desktop-entry": dbus.MakeVariant("nvsmibar"),
+	}
+	err := d.bus.Call(notifyName, notifyPath, notifyName+".Notify",
+		"NVSmiBar", uint32(0), "utilities-system-monitor", n.title, n.body, []string{}, hints, int32(-1))
+	if err != nil {
+		d.bus.Close()
+		d.bus = nil
+	}
+	return err
+}
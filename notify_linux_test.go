@@ -0,0 +1,43 @@
+//go:build linux
+
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestDBusNotifierReconnectsAfterFailure(t *testing.T) {
+	bus := newFakeSessionBus()
+	connects := 0
+	d := &dbusNotifier{connect: func() (sniBus, error) {
+		connects++
+		return bus, nil
+	}}
+
+	if err := d.notify(notification{title: "box is down", body: "timeout"}); err != nil {
+		t.Fatalf("notify returned error: %v", err)
+	}
+	if len(bus.calls) != 1 || bus.calls[0] != "org.freedesktop.Notifications.Notify NVSmiBar" {
+		t.Fatalf("unexpected calls %v", bus.calls)
+	}
+
+	bus.noWatch = true
+	if err := d.notify(notification{title: "again"}); err == nil {
+		t.Fatal("expected error without a notification service")
+	}
+	if !bus.closed || d.bus != nil {
+		t.Fatal("expected the failed connection to be dropped")
+	}
+
+	bus.noWatch = false
+	if err := d.notify(notification{title: "later"}); err != nil || connects != 2 {
+		t.Fatalf("expected a reconnect, got err=%v connects=%d", err, connects)
+	}
+
+	d.connect = func() (sniBus, error) { return nil, errors.New("no session bus") }
+	d.bus = nil
+	if err := d.notify(notification{title: "x"}); err == nil {
+		t.Fatal("expected connect error")
+	}
+}
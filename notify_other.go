@@ -0,0 +1,7 @@
+//go:build !darwin && !linux
+
+package main
+
+func newPlatformNotifier() notifier {
+	return noopNotifier{}
+}
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strings"
+)
+
+// GPU collectors a profile can select. The query collector runs
+// nvidia-smi --query-gpu; the XML collector runs nvidia-smi -q -x, which is
+// slower but also reports MIG instances, retired pages and per-instance
+// processes.
+const (
+	collectorQuery = "query"
+	collectorXML   = "xml"
+)
+
+func validCollector(c string) bool {
+	return c == "" || c == collectorQuery || c == collectorXML
+}
+
+// nvsmiLog mirrors the parts of nvidia-smi -q -x output that NVSmiBar uses.
+// Element names changed across driver releases; both spellings are listed
+// where they differ.
+type nvsmiLog struct {
+	DriverVersion string     `xml:"driver_version"`
+	CudaVersion   string     `xml:"cuda_version"`
+	GPUs          []nvsmiGPU `xml:"gpu"`
+}
+
+type nvsmiGPU struct {
+	ID          string `xml:"id,attr"`
+	ProductName string `xml:"product_name"`
+	UUID        string `xml:"uuid"`
+	MinorNumber string `xml:"minor_number"`
+	MigMode     struct {
+		Current string `xml:"current_mig"`
+	} `xml:"mig_mode"`
+	MigDevices []struct {
+		Index             string      `xml:"index"`
+		GPUInstanceID     string      `xml:"gpu_instance_id"`
+		ComputeInstanceID string      `xml:"compute_instance_id"`
+		SMCount           string      `xml:"device_attributes>shared>multiprocessor_count"`
+		Memory            nvsmiMemory `xml:"fb_memory_usage"`
+	} `xml:"mig_devices>mig_device"`
+	PCI struct {
+		BusID        string `xml:"pci_bus_id"`
+		GenMax       string `xml:"pci_gpu_link_info>pcie_gen>max_link_gen"`
+		GenCurrent   string `xml:"pci_gpu_link_info>pcie_gen>current_link_gen"`
+		WidthMax     string `xml:"pci_gpu_link_info>link_widths>max_link_width"`
+		WidthCurrent string `xml:"pci_gpu_link_info>link_widths>current_link_width"`
+	} `xml:"pci"`
+	FanSpeed        string          `xml:"fan_speed"`
+	PState          string          `xml:"performance_state"`
+	ThrottleReasons nvsmiReasonList `xml:"clocks_throttle_reasons"`
+	EventReasons    nvsmiReasonList `xml:"clocks_event_reasons"`
+	Memory          nvsmiMemory     `xml:"fb_memory_usage"`
+	Utilization     struct {
+		GPU     string `xml:"gpu_util"`
+		Encoder string `xml:"encoder_util"`
+		Decoder string `xml:"decoder_util"`
+	} `xml:"utilization"`
+	ECC struct {
+		DoubleBit string `xml:"volatile>double_bit>total"`
+		DRAM      string `xml:"volatile>dram_uncorrectable"`
+		SRAM      string `xml:"volatile>sram_uncorrectable"`
+	} `xml:"ecc_errors"`
+	RetiredPages struct {
+		SingleBit        string `xml:"multiple_single_bit_retirement>retired_count"`
+		DoubleBit        string `xml:"double_bit_retirement>retired_count"`
+		Pending          string `xml:"pending_retirement"`
+		PendingBlacklist string `xml:"pending_blacklist"`
+	} `xml:"retired_pages"`
+	RemappedRows struct {
+		Uncorrectable string `xml:"remapped_row_unc"`
+		Pending       string `xml:"remapped_row_pending"`
+	} `xml:"remapped_rows"`
+	Temperature string         `xml:"temperature>gpu_temp"`
+	Power       nvsmiPower     `xml:"power_readings"`
+	GPUPower    nvsmiPower     `xml:"gpu_power_readings"`
+	Clocks      nvsmiClocks    `xml:"clocks"`
+	MaxClocks   nvsmiClocks    `xml:"max_clocks"`
+	Processes   []nvsmiProcess `xml:"processes>process_info"`
+}
+
+type nvsmiMemory struct {
+	Total    string `xml:"total"`
+	Reserved string `xml:"reserved"`
+	Used     string `xml:"used"`
+}
+
+type nvsmiPower struct {
+	Draw         string `xml:"power_draw"`
+	Limit        string `xml:"power_limit"`
+	CurrentLimit string `xml:"current_power_limit"`
+}
+
+type nvsmiClocks struct {
+	SM  string `xml:"sm_clock"`
+	Mem string `xml:"mem_clock"`
+}
+
+type nvsmiProcess struct {
+	GPUInstanceID string `xml:"gpu_instance_id"`
+	PID           string `xml:"pid"`
+	Type          string `xml:"type"`
+	Name          string `xml:"process_name"`
+	UsedMemory    string `xml:"used_memory"`
+}
+
+// compute reports whether the process shows up in
+// nvidia-smi --query-compute-apps: types C, M and combinations such as C+G,
+// but not graphics-only G.
+func (p nvsmiProcess) compute() bool {
+	return strings.ContainsAny(p.Type, "CM")
+}
+
+// nvsmiReasonList collects the per-reason children of a throttle or event
+// reason block, e.g. <clocks_event_reason_sw_power_cap>Active</...>.
+type nvsmiReasonList struct {
+	Reasons []struct {
+		XMLName xml.Name
+		Value   string `xml:",chardata"`
+	} `xml:",any"`
+}
+
+func (l nvsmiReasonList) active() []string {
+	reasons := []string{}
+	for _, r := range l.Reasons {
+		if strings.TrimSpace(r.Value) != "Active" {
+			continue
+		}
+		name := r.XMLName.Local
+		name = strings.TrimPrefix(name, "clocks_throttle_reason_")
+		name = strings.TrimPrefix(name, "clocks_event_reason_")
+		if name == "display_clocks_setting" {
+			name = "display_clock_setting"
+		}
+		reasons = append(reasons, name)
+	}
+	return reasons
+}
+
+// nvidiaXMLCollector reads NVIDIA GPUs with nvidia-smi -q -x, which adds
+// MIG instances, retired pages and remapped rows to what --query-gpu has.
+type nvidiaXMLCollector struct{}
+
+func (nvidiaXMLCollector) vendor() string { return vendorNVIDIA }
+
+func (nvidiaXMLCollector) plan(host string) probePlan {
+	return probePlan{
+		sections: []probeSection{
+			{"gpu", "nvidia-smi -q -x"},
+			{"owners", processOwnersCommand},
+		},
+		parse: func(r probeResults) ([]GPU, error) {
+			out, err := r.output("gpu")
+			if err != nil {
+				return nil, err
+			}
+			gpus, err := parseNvsmiXML([]byte(out))
+			if err != nil {
+				return nil, err
+			}
+			var procs []GPUProcess
+			for _, g := range gpus {
+				procs = append(procs, g.Processes...)
+			}
+			applyProbedOwners(r, procs)
+			for i := range gpus {
+				gpus[i].Processes, procs = procs[:len(gpus[i].Processes)], procs[len(gpus[i].Processes):]
+			}
+			return gpus, nil
+		},
+	}
+}
+
+// parseNvsmiXML converts nvidia-smi -q -x output into GPUs. A GPU's index is
+// its minor number, which is nvidia-smi's index; drivers that report none
+// (Windows) list GPUs in the same PCI bus order nvidia-smi uses for indices.
+// Only compute processes are kept, matching the query collector.
+func parseNvsmiXML(raw []byte) ([]GPU, error) {
+	var log nvsmiLog
+	if err := xml.Unmarshal(raw, &log); err != nil {
+		return nil, fmt.Errorf("parse nvidia-smi XML: %w", err)
+	}
+	gpus := make([]GPU, 0, len(log.GPUs))
+	for i, x := range log.GPUs {
+		g := newGPU()
+		g.Vendor = vendorNVIDIA
+		g.Index = i
+		if minor := optionalInt(x.MinorNumber); minor >= 0 {
+			g.Index = minor
+		}
+		g.Name = strings.TrimSpace(x.ProductName)
+		g.DriverVersion = optionalString(log.DriverVersion)
+		g.CudaVersion = optionalString(log.CudaVersion)
+		g.UUID = optionalString(x.UUID)
+		g.PCIBusID = optionalString(x.PCI.BusID)
+		if g.PCIBusID == "" {
+			g.PCIBusID = x.ID
+		}
+		g.PState = optionalString(x.PState)
+		g.MigMode = optionalString(x.MigMode.Current)
+
+		// Required readings: a GPU without them is unusable. Under MIG the
+		// whole-GPU utilization is N/A and stays unknown.
+		var err error
+		if g.Temp, err = parseRequiredInt(xmlNumber(x.Temperature)); err != nil {
+			return nil, fmt.Errorf("gpu %d: parse temperature: %w", i, err)
+		}
+		if g.MemUsed, err = parseRequiredInt(xmlNumber(x.Memory.Used)); err != nil {
+			return nil, fmt.Errorf("gpu %d: parse memory used: %w", i, err)
+		}
+		if g.MemTotal, err = parseRequiredInt(xmlNumber(x.Memory.Total)); err != nil {
+			return nil, fmt.Errorf("gpu %d: parse memory total: %w", i, err)
+		}
+		if g.Util = optionalInt(xmlNumber(x.Utilization.GPU)); g.Util < 0 && g.MigMode != "Enabled" {
+			return nil, fmt.Errorf("gpu %d: parse utilization: missing value %q", i, x.Utilization.GPU)
+		}
+
+		power := x.Power
+		if x.GPUPower.Draw != "" {
+			power = x.GPUPower
+		}
+		g.FanSpeed = optionalInt(xmlNumber(x.FanSpeed))
+		g.PowerDraw = optionalInt(xmlNumber(power.Draw))
+		g.PowerLimit = optionalInt(xmlNumber(firstNonEmpty(power.CurrentLimit, power.Limit)))
+		g.ClockSM = optionalInt(xmlNumber(x.Clocks.SM))
+		g.ClockMem = optionalInt(xmlNumber(x.Clocks.Mem))
+		g.ClockMaxSM = optionalInt(xmlNumber(x.MaxClocks.SM))
+		g.ClockMaxMem = optionalInt(xmlNumber(x.MaxClocks.Mem))
+		g.MemReserved = optionalInt(xmlNumber(x.Memory.Reserved))
+		g.EncoderUtil = optionalInt(xmlNumber(x.Utilization.Encoder))
+		g.DecoderUtil = optionalInt(xmlNumber(x.Utilization.Decoder))
+		g.PCIeGen = optionalInt(xmlNumber(x.PCI.GenCurrent))
+		g.PCIeGenMax = optionalInt(xmlNumber(x.PCI.GenMax))
+		g.PCIeWidth = optionalInt(xmlNumber(x.PCI.WidthCurrent))
+		g.PCIeWidthMax = optionalInt(xmlNumber(x.PCI.WidthMax))
+
+		g.ThrottleReasons = x.ThrottleReasons.active()
+		if len(x.EventReasons.Reasons) > 0 {
+			g.ThrottleReasons = x.EventReasons.active()
+		}
+
+		// Pre-Ampere drivers report double-bit errors; newer ones split DRAM
+		// and SRAM.
+		g.EccUncorrected = optionalInt(xmlNumber(x.ECC.DoubleBit))
+		if dram, sram := optionalInt(xmlNumber(x.ECC.DRAM)), optionalInt(xmlNumber(x.ECC.SRAM)); dram >= 0 || sram >= 0 {
+			g.EccUncorrected = max(dram, 0) + max(sram, 0)
+		}
+		g.RetiredPagesSBE = optionalInt(xmlNumber(x.RetiredPages.SingleBit))
+		g.RetiredPagesDBE = optionalInt(xmlNumber(x.RetiredPages.DoubleBit))
+		g.RetiredPagesPending = xmlYes(firstNonEmpty(x.RetiredPages.Pending, x.RetiredPages.PendingBlacklist))
+		g.RemappedRowsUnc = optionalInt(xmlNumber(x.RemappedRows.Uncorrectable))
+		g.RemappedRowsPending = xmlYes(x.RemappedRows.Pending)
+
+		for _, m := range x.MigDevices {
+			g.MigDevices = append(g.MigDevices, MigDevice{
+				Index:             optionalInt(m.Index),
+				GPUInstanceID:     optionalInt(m.GPUInstanceID),
+				ComputeInstanceID: optionalInt(m.ComputeInstanceID),
+				SMCount:           optionalInt(m.SMCount),
+				MemUsed:           optionalInt(xmlNumber(m.Memory.Used)),
+				MemTotal:          optionalInt(xmlNumber(m.Memory.Total)),
+			})
+		}
+		for _, p := range x.Processes {
+			pid, err := parseRequiredInt(p.PID)
+			if err != nil || !p.compute() {
+				continue
+			}
+			g.Processes = append(g.Processes, GPUProcess{
+				GPUUUID:       g.UUID,
+				PID:           pid,
+				ProcessName:   strings.TrimSpace(p.Name),
+				UsedMemory:    optionalInt(xmlNumber(p.UsedMemory)),
+				GPUInstanceID: optionalInt(p.GPUInstanceID),
+			})
+		}
+		gpus = append(gpus, g)
+	}
+	return gpus, nil
+}
+
+// xmlNumber strips the unit from values such as "33 C", "62.18 W" or "16x".
+func xmlNumber(raw string) string {
+	raw = strings.TrimSpace(raw)
+	if i := strings.IndexByte(raw, ' '); i >= 0 {
+		raw = raw[:i]
+	}
+	return strings.TrimSuffix(raw, "x")
+}
+
+func xmlYes(raw string) bool {
+	return strings.EqualFold(strings.TrimSpace(raw), "yes")
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if strings.TrimSpace(v) != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func readXMLFixture(t *testing.T, name string) []GPU {
+	t.Helper()
+	raw, err := os.ReadFile(filepath.Join("testdata", "nvidia-smi", "xml", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gpus, err := parseNvsmiXML(raw)
+	if err != nil {
+		t.Fatalf("parseNvsmiXML returned error: %v", err)
+	}
+	return gpus
+}
+
+func TestParseNvsmiXMLConsumer(t *testing.T) {
+	gpus := readXMLFixture(t, "rtx4090-555.xml")
+	if len(gpus) != 1 {
+		t.Fatalf("expected 1 gpu, got %d", len(gpus))
+	}
+	g := gpus[0]
+	if g.Name != "NVIDIA GeForce RTX 4090" || g.Util != 12 || g.Temp != 44 || g.MemUsed != 1842 || g.MemTotal != 24564 {
+		t.Fatalf("unexpected core readings: %+v", g)
+	}
+	if g.FanSpeed != 30 || g.PowerDraw != 48 || g.PowerLimit != 450 || g.DriverVersion != "555.42.02" || g.CudaVersion != "12.5" {
+		t.Fatalf("unexpected optional readings: %+v", g)
+	}
+	if g.PCIeGen != 1 || g.PCIeGenMax != 4 || g.PCIeWidth != 16 || g.ClockMaxMem != 10501 || g.MemReserved != 346 || g.EncoderUtil != 3 {
+		t.Fatalf("unexpected extended readings: %+v", g)
+	}
+	if g.EccUncorrected != -1 || g.RetiredPagesSBE != -1 || g.RemappedRowsUnc != -1 || g.MigMode != "" || len(g.MigDevices) != 0 {
+		t.Fatalf("unsupported features should be unknown: %+v", g)
+	}
+	if strings.Join(g.ThrottleReasons, ",") != "gpu_idle" {
+		t.Fatalf("unexpected throttle reasons %v", g.ThrottleReasons)
+	}
+	// Xorg is a graphics process, which --query-compute-apps leaves out.
+	if len(g.Processes) != 1 || g.Processes[0].PID != 48811 || g.Processes[0].UsedMemory != 1290 ||
+		g.Processes[0].GPUUUID != g.UUID || g.Processes[0].GPUInstanceID != -1 {
+		t.Fatalf("unexpected processes: %+v", g.Processes)
+	}
+}
+
+func TestParseNvsmiXMLIndexAndComputeProcesses(t *testing.T) {
+	// Captured with -i 2,3 on a four-GPU workstation whose first card
+	// also drives the display.
+	gpus := readXMLFixture(t, "rtx-a6000-550-i23.xml")
+	if len(gpus) != 2 || gpus[0].Index != 2 || gpus[1].Index != 3 {
+		t.Fatalf("expected nvidia-smi indices 2 and 3, got %+v", gpus)
+	}
+	if p := gpus[0].Processes; len(p) != 1 || p[0].PID != 30412 || p[0].ProcessName != "/opt/blender/blender" {
+		t.Fatalf("expected only the C+G process on the display GPU, got %+v", p)
+	}
+	if p := gpus[1].Processes; len(p) != 1 || p[0].PID != 30977 {
+		t.Fatalf("unexpected processes on the compute GPU: %+v", p)
+	}
+}
+
+func TestParseNvsmiXMLDatacenter(t *testing.T) {
+	gpus := readXMLFixture(t, "v100-470.xml")
+	if len(gpus) != 2 || gpus[0].Index != 0 || gpus[1].Index != 1 {
+		t.Fatalf("unexpected gpus: %+v", gpus)
+	}
+	g := gpus[0]
+	if g.PowerDraw != 298 || g.PowerLimit != 300 || g.FanSpeed != -1 || g.ClockSM != 1312 {
+		t.Fatalf("unexpected readings: %+v", g)
+	}
+	if strings.Join(g.ThrottleReasons, ",") != "sw_power_cap,sw_thermal_slowdown" {
+		t.Fatalf("unexpected throttle reasons %v", g.ThrottleReasons)
+	}
+	if g.EccUncorrected != 2 || g.RetiredPagesSBE != 1 || g.RetiredPagesDBE != 2 || !g.RetiredPagesPending {
+		t.Fatalf("unexpected ECC state: %+v", g)
+	}
+	if len(g.Processes) != 1 || g.Processes[0].ProcessName != "python train.py" {
+		t.Fatalf("unexpected processes: %+v", g.Processes)
+	}
+	if gpus[1].Util != 0 || gpus[1].PCIBusID != "00000000:00:1F.0" || len(gpus[1].Processes) != 0 {
+		t.Fatalf("unexpected second gpu: %+v", gpus[1])
+	}
+}
+
+func TestParseNvsmiXMLMIG(t *testing.T) {
+	g := readXMLFixture(t, "a100-mig-535.xml")[0]
+	if g.MigMode != "Enabled" || g.Util != -1 || g.MemUsed != 20530 {
+		t.Fatalf("unexpected readings: %+v", g)
+	}
+	if len(g.MigDevices) != 2 {
+		t.Fatalf("expected 2 MIG devices, got %+v", g.MigDevices)
+	}
+	if m := g.MigDevices[0]; m.GPUInstanceID != 1 || m.ComputeInstanceID != 0 || m.SMCount != 42 || m.MemUsed != 20517 || m.MemTotal != 40192 {
+		t.Fatalf("unexpected MIG device: %+v", m)
+	}
+	if g.EccUncorrected != 1 || g.RemappedRowsUnc != 1 || !g.RemappedRowsPending || g.RetiredPagesDBE != -1 {
+		t.Fatalf("unexpected ECC state: %+v", g)
+	}
+	if len(g.Processes) != 1 || g.Processes[0].GPUInstanceID != 1 {
+		t.Fatalf("unexpected processes: %+v", g.Processes)
+	}
+}
+
+func TestParseNvsmiXMLErrors(t *testing.T) {
+	if _, err := parseNvsmiXML([]byte("NVIDIA-SMI has failed because it couldn't communicate with the NVIDIA driver.")); err == nil {
+		t.Fatal("expected error for non-XML output")
+	}
+	raw := `<nvidia_smi_log><gpu><product_name>X</product_name><temperature><gpu_temp>N/A</gpu_temp></temperature></gpu></nvidia_smi_log>`
+	if _, err := parseNvsmiXML([]byte(raw)); err == nil || !strings.Contains(err.Error(), "temperature") {
+		t.Fatalf("expected temperature error, got %v", err)
+	}
+}
+
+func TestCollectUsesProfileCollector(t *testing.T) {
+	a, _ := newTestApp(nil)
+	a.poll = func(target string, port int, req probeRequest) (probeSnapshot, error) {
+		return probeSnapshot{GPUs: []GPU{{Name: req.collector}}}, nil
+	}
+	p, err := a.SaveProfile(ConnectionProfile{Name: "box", Target: "box", Collector: collectorXML})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snap, _ := a.collect(p.ID, p.Target, p.Port); snap.GPUs[0].Name != collectorXML {
+		t.Fatalf("expected XML collector, got %q", snap.GPUs[0].Name)
+	}
+	if snap, _ := a.collect("unsaved", "box", 22); snap.GPUs[0].Name != "" {
+		t.Fatalf("expected default collector for unsaved connection, got %q", snap.GPUs[0].Name)
+	}
+	if _, err := a.SaveProfile(ConnectionProfile{Target: "box", Collector: "snmp"}); err == nil {
+		t.Fatal("expected error for unknown collector")
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import "time"
+
+const (
+	// lowBatteryPercent is the charge at or below which polling stops while
+	// on battery.
+	lowBatteryPercent = 20
+	// batteryCheckInterval is how often the battery is read. Sleep and wake
+	// arrive as OS notifications instead.
+	batteryCheckInterval = 30 * time.Second
+)
+
+// powerState is the sleep and battery state of the machine NVSmiBar runs on.
+type powerState struct {
+	asleep    bool
+	onBattery bool
+	// batteryPercent is the charge left, -1 when unknown.
+	batteryPercent int
+	// lowPowerMode is the OS battery saver, e.g. macOS Low Power Mode.
+	lowPowerMode bool
+}
+
+func (p powerState) lowBattery() bool {
+	if !p.onBattery {
+		return false
+	}
+	return p.lowPowerMode || (p.batteryPercent >= 0 && p.batteryPercent <= lowBatteryPercent)
+}
+
+// watchPower follows system sleep and the battery until the app shuts down,
+// rescheduling the pollers on every change.
+func (a *App) watchPower() {
+	go watchSystemSleep(a.setAsleep, a.stopCh)
+	go func() {
+		for {
+			a.setBattery(readBattery())
+			select {
+			case <-a.stopCh:
+				return
+			case <-time.After(batteryCheckInterval):
+			}
+		}
+	}()
+}
+
+func (a *App) setAsleep(asleep bool) {
+	a.mu.Lock()
+	changed := a.power.asleep != asleep
+	a.power.asleep = asleep
+	a.mu.Unlock()
+	if changed {
+		a.rescheduleWorkers()
+	}
+}
+
+// setBattery records a battery reading; b.asleep is ignored.
+func (a *App) setBattery(b powerState) {
+	a.mu.Lock()
+	was := a.power.lowBattery()
+	b.asleep = a.power.asleep
+	a.power = b
+	changed := a.power.lowBattery() != was
+	a.mu.Unlock()
+	if changed {
+		a.rescheduleWorkers()
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+/*
+#cgo LDFLAGS: -framework Cocoa -framework IOKit
+// Declarations only — definitions live in power_darwin.m
+extern void nvSmiBarWatchSleep(void);
+extern int nvSmiBarReadBattery(int *onBattery, int *percent, int *lowPowerMode);
+*/
+import "C"
+import "sync"
+
+var (
+	sleepMu       sync.Mutex
+	sleepOnChange func(asleep bool)
+)
+
+// goSystemSleep is called from ObjC on NSWorkspace's will-sleep and
+// did-wake notifications.
+//
+//export goSystemSleep
+func goSystemSleep(asleep C.int) {
+	sleepMu.Lock()
+	onChange := sleepOnChange
+	sleepMu.Unlock()
+	if onChange != nil {
+		go onChange(asleep != 0)
+	}
+}
+
+// watchSystemSleep registers for sleep and wake notifications. They stay
+// registered until the app exits.
+func watchSystemSleep(onChange func(asleep bool), stop <-chan struct{}) {
+	sleepMu.Lock()
+	sleepOnChange = onChange
+	sleepMu.Unlock()
+	C.nvSmiBarWatchSleep()
+}
+
+func readBattery() powerState {
+	var onBattery, percent, lowPowerMode C.int
+	if C.nvSmiBarReadBattery(&onBattery, &percent, &lowPowerMode) == 0 {
+		return powerState{batteryPercent: -1}
+	}
+	return powerState{onBattery: onBattery != 0, batteryPercent: int(percent), lowPowerMode: lowPowerMode != 0}
+}
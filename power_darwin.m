@@ -0,0 +1,53 @@
+#import <Cocoa/Cocoa.h>
+#include <IOKit/ps/IOPowerSources.h>
+#include <IOKit/ps/IOPSKeys.h>
+
+extern void goSystemSleep(int asleep);
+
+void nvSmiBarWatchSleep(void) {
+    dispatch_async(dispatch_get_main_queue(), ^{
+        NSNotificationCenter *center = [[NSWorkspace sharedWorkspace] notificationCenter];
+        [center addObserverForName:NSWorkspaceWillSleepNotification object:nil queue:nil
+                        usingBlock:^(NSNotification *note) { goSystemSleep(1); }];
+        [center addObserverForName:NSWorkspaceDidWakeNotification object:nil queue:nil
+                        usingBlock:^(NSNotification *note) { goSystemSleep(0); }];
+    });
+}
+
+// Returns 0 when the power source state cannot be read. percent is -1 when
+// there is no internal battery.
+int nvSmiBarReadBattery(int *onBattery, int *percent, int *lowPowerMode) {
+    *onBattery = 0;
+    *percent = -1;
+    *lowPowerMode = 0;
+    if (@available(macOS 12.0, *)) {
+        *lowPowerMode = [[NSProcessInfo processInfo] isLowPowerModeEnabled] ? 1 : 0;
+    }
+
+    CFTypeRef info = IOPSCopyPowerSourcesInfo();
+    if (info == NULL) return 0;
+    CFStringRef providing = IOPSGetProvidingPowerSourceType(info);
+    if (providing != NULL && CFStringCompare(providing, CFSTR(kIOPMBatteryPowerKey), 0) == kCFCompareEqualTo) {
+        *onBattery = 1;
+    }
+
+    CFArrayRef sources = IOPSCopyPowerSourcesList(info);
+    if (sources != NULL) {
+        for (CFIndex i = 0; i < CFArrayGetCount(sources); i++) {
+            CFDictionaryRef desc = IOPSGetPowerSourceDescription(info, CFArrayGetValueAtIndex(sources, i));
+            if (desc == NULL) continue;
+            CFStringRef type = CFDictionaryGetValue(desc, CFSTR(kIOPSTypeKey));
+            if (type == NULL || CFStringCompare(type, CFSTR(kIOPSInternalBatteryType), 0) != kCFCompareEqualTo) continue;
+            CFNumberRef cur = CFDictionaryGetValue(desc, CFSTR(kIOPSCurrentCapacityKey));
+            CFNumberRef max = CFDictionaryGetValue(desc, CFSTR(kIOPSMaxCapacityKey));
+            int c = 0, m = 0;
+            if (cur && max && CFNumberGetValue(cur, kCFNumberIntType, &c) && CFNumberGetValue(max, kCFNumberIntType, &m) && m > 0) {
+                *percent = c * 100 / m;
+            }
+            break;
+        }
+        CFRelease(sources);
+    }
+    CFRelease(info);
+    return 1;
+}
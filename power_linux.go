@@ -0,0 +1,91 @@
+//go:build linux
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/godbus/dbus/v5"
+)
+
+const (
+	powerSupplyRoot = "/sys/class/power_supply"
+	logindManager   = "org.freedesktop.login1.Manager"
+)
+
+func readBattery() powerState {
+	return readPowerSupplies(powerSupplyRoot)
+}
+
+// readPowerSupplies reads the system's batteries and AC adapters from
+// sysfs. Batteries of peripherals such as mice have scope "Device" and are
+// skipped.
+func readPowerSupplies(root string) powerState {
+	state := powerState{batteryPercent: -1}
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return state
+	}
+	acOnline, discharging := false, false
+	for _, e := range entries {
+		dir := filepath.Join(root, e.Name())
+		read := func(name string) string {
+			b, _ := os.ReadFile(filepath.Join(dir, name))
+			return strings.TrimSpace(string(b))
+		}
+		switch read("type") {
+		case "Mains":
+			if read("online") == "1" {
+				acOnline = true
+			}
+		case "Battery":
+			if read("scope") == "Device" {
+				continue
+			}
+			if read("status") == "Discharging" {
+				discharging = true
+			}
+			if pct, err := strconv.Atoi(read("capacity")); err == nil && (state.batteryPercent < 0 || pct < state.batteryPercent) {
+				state.batteryPercent = pct
+			}
+		}
+	}
+	state.onBattery = discharging && !acOnline
+	return state
+}
+
+// watchSystemSleep follows logind's PrepareForSleep signal, sent with true
+// before suspend and false after resume. Without a system bus it does
+// nothing.
+func watchSystemSleep(onChange func(asleep bool), stop <-chan struct{}) {
+	conn, err := dbus.ConnectSystemBus()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	err = conn.AddMatchSignal(dbus.WithMatchInterface(logindManager), dbus.WithMatchMember("PrepareForSleep"))
+	if err != nil {
+		return
+	}
+	signals := make(chan *dbus.Signal, 4)
+	conn.Signal(signals)
+	for {
+		select {
+		case <-stop:
+			return
+		case sig, ok := <-signals:
+			if !ok {
+				return
+			}
+			if sig.Name != logindManager+".PrepareForSleep" || len(sig.Body) != 1 {
+				continue
+			}
+			if asleep, ok := sig.Body[0].(bool); ok {
+				onChange(asleep)
+			}
+		}
+	}
+}
@@ -0,0 +1,44 @@
+//go:build linux
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writePowerSupply(t *testing.T, root, name string, files map[string]string) {
+	t.Helper()
+	dir := filepath.Join(root, name)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for f, v := range files {
+		if err := os.WriteFile(filepath.Join(dir, f), []byte(v+"\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestReadPowerSupplies(t *testing.T) {
+	root := t.TempDir()
+	writePowerSupply(t, root, "AC", map[string]string{"type": "Mains", "online": "0"})
+	writePowerSupply(t, root, "BAT0", map[string]string{"type": "Battery", "status": "Discharging", "capacity": "17"})
+	// A wireless mouse at 5% must not pause polling.
+	writePowerSupply(t, root, "hidpp_battery_0", map[string]string{"type": "Battery", "scope": "Device", "status": "Discharging", "capacity": "5"})
+
+	got := readPowerSupplies(root)
+	if !got.onBattery || got.batteryPercent != 17 || !got.lowBattery() {
+		t.Fatalf("unexpected state: %+v", got)
+	}
+
+	writePowerSupply(t, root, "AC", map[string]string{"online": "1"})
+	if got := readPowerSupplies(root); got.onBattery || got.lowBattery() {
+		t.Fatalf("expected AC power, got %+v", got)
+	}
+
+	if got := readPowerSupplies(filepath.Join(root, "missing")); got.onBattery || got.batteryPercent != -1 {
+		t.Fatalf("expected unknown state without sysfs, got %+v", got)
+	}
+}
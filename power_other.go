@@ -0,0 +1,9 @@
+//go:build !darwin && !linux
+
+package main
+
+func readBattery() powerState {
+	return powerState{batteryPercent: -1}
+}
+
+func watchSystemSleep(onChange func(asleep bool), stop <-chan struct{}) {}
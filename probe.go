@@ -0,0 +1,225 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// probeSection is one command of the remote probe script.
+type probeSection struct {
+	name string
+	cmd  string
+}
+
+// probeResult is one section's combined output and exit status. complete is
+// false when the output stopped before the section's end line, e.g. because
+// the connection dropped.
+type probeResult struct {
+	out      string
+	code     int
+	complete bool
+}
+
+// probeResults maps section names to their results.
+type probeResults map[string]probeResult
+
+// probeSectionError reports a section that did not finish successfully.
+type probeSectionError struct {
+	Section string
+	// Code is the section's exit status, or -1 when it is missing or
+	// truncated.
+	Code   int
+	Output string
+}
+
+func (e *probeSectionError) Error() string {
+	switch {
+	case e.Code >= 0 && e.Output != "":
+		return e.Output
+	case e.Code >= 0:
+		return fmt.Sprintf("%s exited with status %d", e.Section, e.Code)
+	case e.Output != "":
+		return fmt.Sprintf("%s output truncated: %s", e.Section, e.Output)
+	default:
+		return fmt.Sprintf("no %s output from remote host", e.Section)
+	}
+}
+
+// output returns a section's output when it ran to completion with status
+// 0, and a *probeSectionError otherwise.
+func (r probeResults) output(name string) (string, error) {
+	res, ok := r[name]
+	switch {
+	case !ok:
+		return "", &probeSectionError{Section: name, Code: -1}
+	case !res.complete:
+		return "", &probeSectionError{Section: name, Code: -1, Output: strings.TrimSpace(res.out)}
+	case res.code != 0:
+		return "", &probeSectionError{Section: name, Code: res.code, Output: strings.TrimSpace(res.out)}
+	}
+	return res.out, nil
+}
+
+// probePrelude frames each section with begin and end lines carrying $M,
+// the end line adding the exit status. Sections run in a subshell reading
+// /dev/null, so no command can swallow the rest of the script from stdin.
+// The newline before the end line keeps it on a line of its own; the parser
+// removes it again.
+const probePrelude = `nvsmibar_section() {
+	printf '%s begin %s\n' "$M" "$1"
+	(eval "$2") </dev/null 2>&1
+	printf '\n%s end %s %d\n' "$M" "$1" "$?"
+}
+`
+
+// probeScript builds the POSIX sh script that runs sections in order.
+func probeScript(mark string, sections []probeSection) string {
+	var b strings.Builder
+	// English messages from the remote tools keep classifyError reliable.
+	b.WriteString("LC_ALL=C; export LC_ALL\n")
+	b.WriteString("M=" + shellQuote(mark) + "\n")
+	b.WriteString(probePrelude)
+	for _, s := range sections {
+		b.WriteString("nvsmibar_section " + shellQuote(s.name) + " " + shellQuote(s.cmd) + "\n")
+	}
+	b.WriteString("exit 0\n")
+	return b.String()
+}
+
+// newProbeMark returns a frame marker no command output will contain by
+// accident.
+func newProbeMark() string {
+	return "@@nvsmibar-" + strconv.FormatUint(rand.Uint64(), 36)
+}
+
+// parseProbeOutput splits the probe script's output into sections. Lines
+// outside any section, such as a login banner, are ignored.
+func parseProbeOutput(raw, mark string) (probeResults, error) {
+	begin, end := mark+" begin ", mark+" end "
+	results := probeResults{}
+	name, open := "", false
+	var body strings.Builder
+	for _, line := range strings.SplitAfter(raw, "\n") {
+		text := strings.TrimRight(line, "\r\n")
+		switch {
+		case strings.HasPrefix(text, begin):
+			if open {
+				results[name] = probeResult{out: body.String()}
+			}
+			name, open = strings.TrimPrefix(text, begin), true
+			body.Reset()
+		case open && strings.HasPrefix(text, end+name+" "):
+			code, err := strconv.Atoi(strings.TrimPrefix(text, end+name+" "))
+			if err != nil {
+				return nil, fmt.Errorf("malformed probe end line %q", text)
+			}
+			results[name] = probeResult{out: strings.TrimSuffix(body.String(), "\n"), code: code, complete: true}
+			open = false
+		case open:
+			body.WriteString(line)
+		}
+	}
+	if open {
+		results[name] = probeResult{out: body.String()}
+	}
+	if len(results) == 0 {
+		msg := strings.TrimSpace(raw)
+		if len(msg) > 200 {
+			msg = msg[:200]
+		}
+		return nil, fmt.Errorf("unexpected probe output: %q", msg)
+	}
+	return results, nil
+}
+
+// runProbe runs sections on target in a single SSH round trip.
+func runProbe(target string, port int, sections []probeSection) (probeResults, error) {
+	mark := newProbeMark()
+	out, err := runSSHScript(target, port, probeScript(mark, sections))
+	if err != nil {
+		return nil, err
+	}
+	return parseProbeOutput(string(out), mark)
+}
+
+// probePlan is what a collector reads on one poll: the sections to run and
+// how to turn their results into GPUs.
+type probePlan struct {
+	sections []probeSection
+	parse    func(probeResults) ([]GPU, error)
+}
+
+// errProbeAgain asks probeHost to run a fresh plan, e.g. after nvidia-smi
+// rejected a query field.
+var errProbeAgain = errors.New("probe plan changed")
+
+// probeRequest selects what one poll reads besides the GPUs.
+type probeRequest struct {
+	// collector is the profile's collector; collectorXML forces the
+	// nvidia-smi -q -x collector instead of per-host detection.
+	collector string
+	// mounts are the df mounts for host metrics; nil skips host metrics.
+	mounts []string
+}
+
+// probeSnapshot is everything one poll read from a host.
+type probeSnapshot struct {
+	GPUs []GPU
+	// host is nil unless host metrics were requested and could be read.
+	host *hostSample
+}
+
+// probeHost reads the GPUs with collector, and host metrics when mounts is
+// non-nil, in one SSH round trip. Field probing against an older driver
+// costs extra round trips on the first poll only.
+func probeHost(target string, port int, collector gpuCollector, mounts []string) (probeSnapshot, error) {
+	if strings.TrimSpace(target) == "" {
+		return probeSnapshot{}, fmt.Errorf("empty target")
+	}
+	key := target + ":" + strconv.Itoa(port)
+	for {
+		plan := collector.plan(key)
+		sections := plan.sections
+		if mounts != nil {
+			sections = append(sections, probeSection{"host", hostStatsCommand(mounts)})
+		}
+		results, err := runProbe(target, port, sections)
+		if err != nil {
+			return probeSnapshot{}, err
+		}
+		gpus, err := plan.parse(results)
+		if errors.Is(err, errProbeAgain) {
+			continue
+		}
+		if err != nil {
+			return probeSnapshot{}, err
+		}
+		snap := probeSnapshot{GPUs: gpus}
+		// Host metrics are best effort: a host without /proc still polls.
+		if out, err := results.output("host"); mounts != nil && err == nil {
+			if s, err := parseHostSample(out); err == nil {
+				s.at = time.Now()
+				snap.host = &s
+			}
+		}
+		return snap, nil
+	}
+}
+
+// collect polls one connection with the collector and host metrics its
+// profile selects.
+func (a *App) collect(id, target string, port int) (probeSnapshot, error) {
+	var req probeRequest
+	cfg := a.store.snapshot()
+	if i, ok := findProfile(cfg.Profiles, id); ok {
+		req.collector = cfg.Profiles[i].Collector
+	}
+	if mounts, ok := a.hostMounts(id); ok {
+		req.mounts = mounts
+	}
+	return a.poll(target, port, req)
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"errors"
+	"os/exec"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestProbeScriptFramesSections(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("probe script requires a POSIX shell")
+	}
+	mark := newProbeMark()
+	cmd := exec.Command("sh", "-s")
+	cmd.Stdin = strings.NewReader(probeScript(mark, []probeSection{
+		{"ok", "echo hello; echo world"},
+		{"partial", "printf 'no newline'"},
+		{"fails", "echo boom >&2; exit 3"},
+		// A command reading stdin must not swallow the rest of the script.
+		{"stdin", "cat"},
+		{"quoted", `echo "it's $((1 + 1))"`},
+	}))
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("probe script failed: %v\n%s", err, out)
+	}
+	results, err := parseProbeOutput(string(out), mark)
+	if err != nil {
+		t.Fatalf("parseProbeOutput returned error: %v", err)
+	}
+	want := map[string]probeResult{
+		"ok":      {out: "hello\nworld\n", complete: true},
+		"partial": {out: "no newline", complete: true},
+		"fails":   {out: "boom\n", code: 3, complete: true},
+		"stdin":   {out: "", complete: true},
+		"quoted":  {out: "it's 2\n", complete: true},
+	}
+	if len(results) != len(want) {
+		t.Fatalf("expected %d sections, got %+v", len(want), results)
+	}
+	for name, w := range want {
+		if results[name] != w {
+			t.Errorf("section %s: got %+v, want %+v", name, results[name], w)
+		}
+	}
+}
+
+func TestParseProbeOutputPartialFailures(t *testing.T) {
+	const mark = "@@nvsmibar-test"
+	raw := "Welcome to gpu-box\n" +
+		mark + " begin gpu\n0, Tesla T4, 12, 40, 100, 15109\n\n" + mark + " end gpu 0\n" +
+		mark + " begin apps\nsh: 1: nvidia-smi: not found\n\n" + mark + " end apps 127\n" +
+		mark + " begin owners\n100 alice pyth"
+
+	results, err := parseProbeOutput(raw, mark)
+	if err != nil {
+		t.Fatalf("parseProbeOutput returned error: %v", err)
+	}
+	if out, err := results.output("gpu"); err != nil || out != "0, Tesla T4, 12, 40, 100, 15109\n" {
+		t.Fatalf("unexpected gpu section: %q %v", out, err)
+	}
+
+	var sectionErr *probeSectionError
+	_, err = results.output("apps")
+	if !errors.As(err, &sectionErr) || sectionErr.Code != 127 || err.Error() != "sh: 1: nvidia-smi: not found" {
+		t.Fatalf("unexpected apps error: %#v", err)
+	}
+	if code, _ := classifyConnectionError(err); code != "nvidia_smi_missing" {
+		t.Fatalf("failed section should classify like a failed command, got %q", code)
+	}
+	// The connection dropped inside owners.
+	if _, err := results.output("owners"); !errors.As(err, &sectionErr) || sectionErr.Code != -1 || results["owners"].out != "100 alice pyth" {
+		t.Fatalf("unexpected owners result: %+v %v", results["owners"], err)
+	}
+	if _, err := results.output("host"); !errors.As(err, &sectionErr) || !strings.Contains(err.Error(), "no host output") {
+		t.Fatalf("unexpected error for missing section: %v", err)
+	}
+
+	if _, err := parseProbeOutput("sh: not found\n", mark); err == nil {
+		t.Fatal("expected error when no section was printed")
+	}
+	if _, err := parseProbeOutput(mark+" begin gpu\n\n"+mark+" end gpu x\n", mark); err == nil {
+		t.Fatal("expected error for malformed end line")
+	}
+}
+
+func TestNvidiaPlanToleratesFailedSections(t *testing.T) {
+	prev := gpuFieldsCache
+	gpuFieldsCache = &gpuFieldCache{fields: map[string][]string{}}
+	defer func() { gpuFieldsCache = prev }()
+
+	fields := allGPUFieldNames[:6]
+	gpuFieldsCache.set("box:22", fields)
+	plan := nvidiaCollector{}.plan("box:22")
+	if len(plan.sections) != 3 || plan.sections[0].cmd != gpuQueryCommand(fields) {
+		t.Fatalf("unexpected sections: %+v", plan.sections)
+	}
+
+	// Process sections failing never discards the GPU readings.
+	gpus, err := plan.parse(probeResults{
+		"gpu":  {out: "0, Tesla T4, 12, 40, 100, 15109\n", complete: true},
+		"apps": {out: "NVIDIA-SMI has failed", code: 9, complete: true},
+	})
+	if err != nil || len(gpus) != 1 || gpus[0].Util != 12 || gpus[0].Processes == nil {
+		t.Fatalf("unexpected result: %+v %v", gpus, err)
+	}
+
+	full := nvidiaCollector{}.plan("fresh:22")
+	_, err = full.parse(probeResults{
+		"gpu": {out: `Field "mig.mode.current" is not a valid field to query.`, code: 2, complete: true},
+	})
+	if !errors.Is(err, errProbeAgain) {
+		t.Fatalf("expected errProbeAgain for a rejected field, got %v", err)
+	}
+	if got := gpuFieldsCache.get("fresh:22"); len(got) != len(allGPUFieldNames)-1 {
+		t.Fatalf("expected the rejected field to be dropped, got %v", got)
+	}
+
+	_, err = plan.parse(probeResults{"gpu": {out: "NVIDIA-SMI has failed because it couldn't communicate with the NVIDIA driver.", code: 9, complete: true}})
+	if err == nil || errors.Is(err, errProbeAgain) {
+		t.Fatalf("expected driver failure to surface, got %v", err)
+	}
+}
+
+func TestPollHostReadsHostMetricsInSameProbe(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("host metrics read the local /proc through the fake ssh")
+	}
+	sshLog, _ := writeFakeSSH(t)
+	if _, err := pollHost("gpu-box", 22, probeRequest{}); err != nil {
+		t.Fatalf("pollHost returned error: %v", err)
+	}
+	before := len(readLogLines(t, sshLog))
+
+	snap, err := pollHost("gpu-box", 22, probeRequest{mounts: []string{"/", "/does-not-exist"}})
+	if err != nil {
+		t.Fatalf("pollHost returned error: %v", err)
+	}
+	if len(snap.GPUs) != 1 || snap.host == nil || snap.host.stats.MemTotal <= 0 || len(snap.host.stats.Disks) != 1 {
+		t.Fatalf("unexpected snapshot: %+v %+v", snap.GPUs, snap.host)
+	}
+	if n := len(readLogLines(t, sshLog)) - before; n != 1 {
+		t.Fatalf("expected GPUs and host metrics in one ssh run, got %d", n)
+	}
+}
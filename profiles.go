@@ -0,0 +1,250 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ConnectionProfile is a saved SSH connection.
+type ConnectionProfile struct {
+	ID               string `json:"id"`
+	Name             string `json:"name"`
+	Target           string `json:"target"`
+	Port             int    `json:"port"`
+	Source           string `json:"source"`
+	LastUsedAt       int64  `json:"lastUsedAt"`
+	LastTestStatus   string `json:"lastTestStatus"`
+	LastErrorCode    string `json:"lastErrorCode"`
+	LastErrorMessage string `json:"lastErrorMessage"`
+	// Collector selects how GPUs are read: "query" (default) or "xml".
+	Collector string `json:"collector"`
+	// HostMetrics adds CPU, memory, disk and network stats to every poll;
+	// Mounts selects the filesystems reported, "/" when empty.
+	HostMetrics bool     `json:"hostMetrics"`
+	Mounts      []string `json:"mounts"`
+	// PollIntervalSec is the time between polls, one second when 0.
+	// AdaptivePolling slows down to idlePollInterval while the window is
+	// hidden and the metrics are steady, and pauses on low battery.
+	PollIntervalSec int  `json:"pollIntervalSec"`
+	AdaptivePolling bool `json:"adaptivePolling"`
+}
+
+// profileTouchInterval limits how often a healthy connection rewrites its
+// lastUsedAt timestamp to disk.
+const profileTouchInterval = time.Minute
+
+func newProfileID() string {
+	suffix := strconv.FormatUint(rand.Uint64(), 36)
+	if len(suffix) > 7 {
+		suffix = suffix[:7]
+	}
+	return fmt.Sprintf("conn_%d_%s", time.Now().UnixMilli(), suffix)
+}
+
+func findProfile(profiles []ConnectionProfile, id string) (int, bool) {
+	for i, p := range profiles {
+		if p.ID == id {
+			return i, true
+		}
+	}
+	return -1, false
+}
+
+// ListProfiles returns all saved connection profiles.
+func (a *App) ListProfiles() []ConnectionProfile {
+	return a.store.snapshot().Profiles
+}
+
+// GetActiveProfileID returns the ID of the profile currently shown, if any.
+func (a *App) GetActiveProfileID() string {
+	return a.store.snapshot().ActiveProfileID
+}
+
+// SaveProfile creates or updates a profile and returns the stored copy.
+func (a *App) SaveProfile(profile ConnectionProfile) (ConnectionProfile, error) {
+	profile.Target = strings.TrimSpace(profile.Target)
+	if profile.Target == "" {
+		return ConnectionProfile{}, fmt.Errorf("host is required")
+	}
+	if !validCollector(profile.Collector) {
+		return ConnectionProfile{}, fmt.Errorf("unknown collector %q", profile.Collector)
+	}
+	mounts, err := normalizeMounts(profile.Mounts)
+	if err != nil {
+		return ConnectionProfile{}, err
+	}
+	profile.Mounts = mounts
+	if err := validPollInterval(profile.PollIntervalSec); err != nil {
+		return ConnectionProfile{}, err
+	}
+	if profile.ID == "" {
+		profile.ID = newProfileID()
+	}
+	if profile.Name == "" {
+		profile.Name = profile.Target
+	}
+	if profile.Port <= 0 {
+		profile.Port = 22
+	}
+	if profile.Source == "" {
+		profile.Source = "manual"
+	}
+	if profile.LastTestStatus == "" {
+		profile.LastTestStatus = "never"
+	}
+
+	err = a.store.update(func(cfg *appConfig) {
+		if i, ok := findProfile(cfg.Profiles, profile.ID); ok {
+			cfg.Profiles[i] = profile
+		} else {
+			cfg.Profiles = append([]ConnectionProfile{profile}, cfg.Profiles...)
+		}
+	})
+	if err != nil {
+		return ConnectionProfile{}, err
+	}
+	a.WatchConnection(profile.ID, profile.Target, profile.Port)
+	return profile, nil
+}
+
+// DeleteProfile removes a profile and stops polling it.
+func (a *App) DeleteProfile(id string) error {
+	err := a.store.update(func(cfg *appConfig) {
+		if i, ok := findProfile(cfg.Profiles, id); ok {
+			cfg.Profiles = append(cfg.Profiles[:i], cfg.Profiles[i+1:]...)
+		}
+		if cfg.ActiveProfileID == id {
+			cfg.ActiveProfileID = ""
+		}
+	})
+	a.UnwatchConnection(id)
+	a.history.forget(id)
+	return err
+}
+
+// SetActiveProfile switches the polled profile. An empty id disconnects.
+func (a *App) SetActiveProfile(id string) error {
+	cfg := a.store.snapshot()
+	var profile ConnectionProfile
+	if id != "" {
+		i, ok := findProfile(cfg.Profiles, id)
+		if !ok {
+			return fmt.Errorf("unknown profile %q", id)
+		}
+		profile = cfg.Profiles[i]
+	}
+
+	// Every saved profile keeps polling; switching only changes which one
+	// the popup and tray show. Store the new active profile before its
+	// worker starts so the tray picks up its first status.
+	err := a.store.update(func(cfg *appConfig) {
+		cfg.ActiveProfileID = id
+		if i, ok := findProfile(cfg.Profiles, id); ok {
+			cfg.Profiles[i].LastUsedAt = time.Now().UnixMilli()
+		}
+	})
+	if id != "" {
+		a.WatchConnection(profile.ID, profile.Target, profile.Port)
+	}
+	a.showActiveInTray()
+	return err
+}
+
+// ImportLegacyProfiles migrates profiles the frontend kept in localStorage
+// into the Go store. Profiles whose ID already exists are left untouched.
+// It returns the number of profiles imported.
+func (a *App) ImportLegacyProfiles(rawProfiles string, activeID string) (int, error) {
+	var profiles interface{}
+	if err := json.Unmarshal([]byte(rawProfiles), &profiles); err != nil {
+		return 0, fmt.Errorf("parse legacy profiles: %w", err)
+	}
+	doc, err := json.Marshal(map[string]interface{}{
+		"profiles":        profiles,
+		"activeProfileId": activeID,
+	})
+	if err != nil {
+		return 0, err
+	}
+	legacy, _, err := decodeConfig(doc)
+	if err != nil {
+		return 0, err
+	}
+
+	imported := 0
+	activate := ""
+	err = a.store.update(func(cfg *appConfig) {
+		for _, p := range legacy.Profiles {
+			if _, exists := findProfile(cfg.Profiles, p.ID); exists {
+				continue
+			}
+			cfg.Profiles = append(cfg.Profiles, p)
+			imported++
+		}
+		if cfg.ActiveProfileID == "" && legacy.ActiveProfileID != "" {
+			if _, ok := findProfile(cfg.Profiles, legacy.ActiveProfileID); ok {
+				activate = legacy.ActiveProfileID
+			}
+		}
+	})
+	if err != nil {
+		return imported, err
+	}
+	a.watchProfiles()
+	if activate != "" {
+		return imported, a.SetActiveProfile(activate)
+	}
+	return imported, nil
+}
+
+// watchProfiles polls every saved profile, so history, alerts and the free
+// GPU finder cover all hosts and the tray updates even if the popup is never
+// opened. Profiles already watched keep their worker.
+func (a *App) watchProfiles() {
+	for _, p := range a.store.snapshot().Profiles {
+		a.WatchConnection(p.ID, p.Target, p.Port)
+	}
+}
+
+// recordProfileStatus persists the outcome of polls for profile-backed
+// connections. Writes only happen when the status flips or lastUsedAt is
+// more than profileTouchInterval old, not on every tick.
+func (a *App) recordProfileStatus(id string, meta ConnectionMeta) {
+	var status string
+	switch meta.Status {
+	case "live":
+		status = "success"
+	case "error":
+		status = "failed"
+	default:
+		return
+	}
+
+	cfg := a.store.snapshot()
+	i, ok := findProfile(cfg.Profiles, id)
+	if !ok {
+		return
+	}
+	p := cfg.Profiles[i]
+	now := time.Now()
+	touch := status == "success" && now.Sub(time.UnixMilli(p.LastUsedAt)) >= profileTouchInterval
+	if p.LastTestStatus == status && p.LastErrorCode == meta.ErrorCode && !touch {
+		return
+	}
+
+	_ = a.store.update(func(cfg *appConfig) {
+		i, ok := findProfile(cfg.Profiles, id)
+		if !ok {
+			return
+		}
+		cfg.Profiles[i].LastTestStatus = status
+		cfg.Profiles[i].LastErrorCode = meta.ErrorCode
+		cfg.Profiles[i].LastErrorMessage = meta.ErrorMessage
+		if status == "success" {
+			cfg.Profiles[i].LastUsedAt = now.UnixMilli()
+		}
+	})
+}
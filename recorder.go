@@ -0,0 +1,464 @@
+package main
+
+import (
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultRecorderRetentionDays = 30
+	defaultRecorderMaxMiB        = 512
+
+	// Samples are buffered and appended as one gzip member per flush, which
+	// keeps compression reasonable without rewriting segment files.
+	recorderFlushInterval = time.Minute
+	recorderFlushSamples  = 1000
+	// recorderMaxPending bounds the buffer while flushes keep failing, e.g.
+	// on a full disk; the oldest samples are dropped first.
+	recorderMaxPending = 100 * recorderFlushSamples
+
+	recorderSegmentPrefix = "samples-"
+	recorderSegmentSuffix = ".csv.gz"
+)
+
+var recorderHeader = []string{
+	"ts", "connection", "target", "index", "name", "uuid",
+	"util", "temp", "memUsed", "memTotal", "fanSpeed", "powerDraw", "powerLimit",
+	"driverVersion", "cudaVersion",
+}
+
+// RecorderConfig controls on-disk recording of polled samples.
+type RecorderConfig struct {
+	Enabled       bool `json:"enabled"`
+	RetentionDays int  `json:"retentionDays"`
+	MaxMiB        int  `json:"maxMiB"`
+}
+
+// RecordedSample is one GPU reading as stored by the recorder.
+type RecordedSample struct {
+	Ts           int64  `json:"ts"`
+	ConnectionID string `json:"connectionId"`
+	Target       string `json:"target"`
+	GPU          GPU    `json:"gpu"`
+}
+
+// recorder appends samples to daily gzip'd CSV segments in dir and enforces
+// retention by age and total size.
+type recorder struct {
+	mu        sync.Mutex
+	dir       string
+	now       func() time.Time
+	cfg       RecorderConfig
+	pending   []RecordedSample
+	lastFlush time.Time
+}
+
+func newRecorder(dir string, now func() time.Time) *recorder {
+	return &recorder{dir: dir, now: now, cfg: normalizeRecorderConfig(RecorderConfig{})}
+}
+
+func defaultRecorderDir() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "NVSmiBar", "recordings")
+}
+
+func normalizeRecorderConfig(cfg RecorderConfig) RecorderConfig {
+	if cfg.RetentionDays <= 0 {
+		cfg.RetentionDays = defaultRecorderRetentionDays
+	}
+	if cfg.MaxMiB <= 0 {
+		cfg.MaxMiB = defaultRecorderMaxMiB
+	}
+	return cfg
+}
+
+func (r *recorder) configure(cfg RecorderConfig) error {
+	r.mu.Lock()
+	wasEnabled := r.cfg.Enabled
+	r.cfg = normalizeRecorderConfig(cfg)
+	r.mu.Unlock()
+	if wasEnabled && !cfg.Enabled {
+		return r.flush()
+	}
+	return nil
+}
+
+func (r *recorder) record(connectionID, target string, gpus []GPU) {
+	r.mu.Lock()
+	if !r.cfg.Enabled || r.dir == "" {
+		r.mu.Unlock()
+		return
+	}
+	now := r.now()
+	if r.lastFlush.IsZero() {
+		r.lastFlush = now
+	}
+	for _, g := range gpus {
+		r.pending = append(r.pending, RecordedSample{Ts: now.Unix(), ConnectionID: connectionID, Target: target, GPU: g})
+	}
+	if n := len(r.pending); n > recorderMaxPending {
+		r.pending = append([]RecordedSample(nil), r.pending[n-recorderMaxPending:]...)
+	}
+	due := len(r.pending) >= recorderFlushSamples || now.Sub(r.lastFlush) >= recorderFlushInterval
+	r.mu.Unlock()
+
+	if due {
+		if err := r.flush(); err != nil {
+			println("recorder:", err.Error())
+		}
+	}
+}
+
+// flush writes buffered samples to their day segments and prunes old data.
+func (r *recorder) flush() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.lastFlush = r.now()
+	if len(r.pending) == 0 || r.dir == "" {
+		return nil
+	}
+	if err := os.MkdirAll(r.dir, 0o700); err != nil {
+		return err
+	}
+
+	byDay := map[string][]RecordedSample{}
+	for _, s := range r.pending {
+		name := recorderSegmentName(time.Unix(s.Ts, 0))
+		byDay[name] = append(byDay[name], s)
+	}
+	names := make([]string, 0, len(byDay))
+	for name := range byDay {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for i, name := range names {
+		if err := appendSegment(filepath.Join(r.dir, name), byDay[name]); err != nil {
+			// Keep only the days not yet written, so a retry never appends
+			// a day twice.
+			r.pending = nil
+			for _, rest := range names[i:] {
+				r.pending = append(r.pending, byDay[rest]...)
+			}
+			return err
+		}
+	}
+	r.pending = nil
+	return r.pruneLocked()
+}
+
+func recorderSegmentName(t time.Time) string {
+	return recorderSegmentPrefix + t.UTC().Format("20060102") + recorderSegmentSuffix
+}
+
+func appendSegment(path string, samples []RecordedSample) error {
+	_, statErr := os.Stat(path)
+	isNew := os.IsNotExist(statErr)
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	gz := gzip.NewWriter(f)
+	w := csv.NewWriter(gz)
+	if isNew {
+		w.Write(recorderHeader)
+	}
+	for _, s := range samples {
+		w.Write(sampleToRecord(s))
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func sampleToRecord(s RecordedSample) []string {
+	g := s.GPU
+	itoa := strconv.Itoa
+	return []string{
+		strconv.FormatInt(s.Ts, 10), s.ConnectionID, s.Target, itoa(g.Index), g.Name, g.UUID,
+		itoa(g.Util), itoa(g.Temp), itoa(g.MemUsed), itoa(g.MemTotal), itoa(g.FanSpeed), itoa(g.PowerDraw), itoa(g.PowerLimit),
+		g.DriverVersion, g.CudaVersion,
+	}
+}
+
+func recordToSample(rec []string) (RecordedSample, error) {
+	if len(rec) != len(recorderHeader) {
+		return RecordedSample{}, fmt.Errorf("expected %d columns, got %d", len(recorderHeader), len(rec))
+	}
+	ts, err := strconv.ParseInt(rec[0], 10, 64)
+	if err != nil {
+		return RecordedSample{}, fmt.Errorf("parse ts: %w", err)
+	}
+	// Columns of index, util, temp, memUsed, memTotal, fanSpeed, powerDraw
+	// and powerLimit.
+	cols := []int{3, 6, 7, 8, 9, 10, 11, 12}
+	ints := make([]int, len(cols))
+	for i, col := range cols {
+		n, err := strconv.Atoi(rec[col])
+		if err != nil {
+			return RecordedSample{}, fmt.Errorf("parse %s: %w", recorderHeader[col], err)
+		}
+		ints[i] = n
+	}
+	return RecordedSample{
+		Ts:           ts,
+		ConnectionID: rec[1],
+		Target:       rec[2],
+		GPU: GPU{
+			Index:         ints[0],
+			Name:          rec[4],
+			UUID:          rec[5],
+			Util:          ints[1],
+			Temp:          ints[2],
+			MemUsed:       ints[3],
+			MemTotal:      ints[4],
+			FanSpeed:      ints[5],
+			PowerDraw:     ints[6],
+			PowerLimit:    ints[7],
+			DriverVersion: rec[13],
+			CudaVersion:   rec[14],
+			Processes:     []GPUProcess{},
+		},
+	}, nil
+}
+
+type segmentInfo struct {
+	name string
+	day  time.Time
+	size int64
+}
+
+func (r *recorder) segments() ([]segmentInfo, error) {
+	entries, err := os.ReadDir(r.dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var out []segmentInfo
+	for _, e := range entries {
+		name := e.Name()
+		if !strings.HasPrefix(name, recorderSegmentPrefix) || !strings.HasSuffix(name, recorderSegmentSuffix) {
+			continue
+		}
+		day, err := time.Parse("20060102", strings.TrimSuffix(strings.TrimPrefix(name, recorderSegmentPrefix), recorderSegmentSuffix))
+		if err != nil {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		out = append(out, segmentInfo{name: name, day: day, size: info.Size()})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].day.Before(out[j].day) })
+	return out, nil
+}
+
+// pruneLocked deletes segments older than the retention window, then the
+// oldest remaining segments until the total size fits the limit. The
+// current day's segment is never deleted.
+func (r *recorder) pruneLocked() error {
+	segs, err := r.segments()
+	if err != nil {
+		return err
+	}
+	today := recorderSegmentName(r.now())
+	cutoff := r.now().UTC().Truncate(24*time.Hour).AddDate(0, 0, -r.cfg.RetentionDays)
+	var total int64
+	kept := segs[:0]
+	for _, s := range segs {
+		if s.day.Before(cutoff) && s.name != today {
+			if err := os.Remove(filepath.Join(r.dir, s.name)); err != nil {
+				return err
+			}
+			continue
+		}
+		kept = append(kept, s)
+		total += s.size
+	}
+	maxBytes := int64(r.cfg.MaxMiB) * 1024 * 1024
+	for _, s := range kept {
+		if total <= maxBytes || s.name == today {
+			break
+		}
+		if err := os.Remove(filepath.Join(r.dir, s.name)); err != nil {
+			return err
+		}
+		total -= s.size
+	}
+	return nil
+}
+
+// read returns recorded samples with from <= ts <= to, oldest first.
+func (r *recorder) read(from, to time.Time) ([]RecordedSample, error) {
+	if err := r.flush(); err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	segs, err := r.segments()
+	if err != nil {
+		return nil, err
+	}
+	firstDay := from.UTC().Truncate(24 * time.Hour)
+	samples := []RecordedSample{}
+	for _, s := range segs {
+		if s.day.Before(firstDay) || s.day.After(to) {
+			continue
+		}
+		got, err := readSegment(filepath.Join(r.dir, s.name), from.Unix(), to.Unix())
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", s.name, err)
+		}
+		samples = append(samples, got...)
+	}
+	sort.SliceStable(samples, func(i, j int) bool { return samples[i].Ts < samples[j].Ts })
+	return samples, nil
+}
+
+func readSegment(path string, from, to int64) ([]RecordedSample, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+
+	reader := csv.NewReader(gz)
+	reader.FieldsPerRecord = -1
+	var out []RecordedSample
+	for {
+		rec, err := reader.Read()
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			// A crash mid-flush can truncate the last gzip member; keep what
+			// was readable before it.
+			break
+		}
+		if err != nil {
+			return out, err
+		}
+		if len(rec) > 0 && rec[0] == recorderHeader[0] {
+			continue
+		}
+		s, err := recordToSample(rec)
+		if err != nil {
+			// Skipping the row would leave a silent hole in exports.
+			line, _ := reader.FieldPos(0)
+			return out, fmt.Errorf("line %d: %w", line, err)
+		}
+		if s.Ts >= from && s.Ts <= to {
+			out = append(out, s)
+		}
+	}
+	return out, nil
+}
+
+func writeSamplesCSV(w io.Writer, samples []RecordedSample) error {
+	cw := csv.NewWriter(w)
+	cw.Write(recorderHeader)
+	for _, s := range samples {
+		cw.Write(sampleToRecord(s))
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func writeSamplesJSON(w io.Writer, samples []RecordedSample) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(samples)
+}
+
+func exportDir() string {
+	if home, err := os.UserHomeDir(); err == nil {
+		downloads := filepath.Join(home, "Downloads")
+		if info, err := os.Stat(downloads); err == nil && info.IsDir() {
+			return downloads
+		}
+	}
+	return os.TempDir()
+}
+
+// GetRecorderConfig returns the on-disk recorder settings.
+func (a *App) GetRecorderConfig() RecorderConfig {
+	return normalizeRecorderConfig(a.store.snapshot().Recorder)
+}
+
+// SetRecorderConfig enables or disables recording and sets retention limits.
+func (a *App) SetRecorderConfig(cfg RecorderConfig) error {
+	cfg = normalizeRecorderConfig(cfg)
+	if err := a.recorder.configure(cfg); err != nil {
+		return err
+	}
+	return a.store.update(func(c *appConfig) {
+		c.Recorder = cfg
+	})
+}
+
+// ExportHistory writes recorded samples between two Unix timestamps to a
+// CSV or JSON file and returns its path.
+func (a *App) ExportHistory(from int64, to int64, format string) (string, error) {
+	if to <= 0 {
+		to = time.Now().Unix()
+	}
+	if from > to {
+		return "", fmt.Errorf("invalid range: from is after to")
+	}
+	format = strings.ToLower(strings.TrimSpace(format))
+	var write func(io.Writer, []RecordedSample) error
+	switch format {
+	case "csv":
+		write = writeSamplesCSV
+	case "json":
+		write = writeSamplesJSON
+	default:
+		return "", fmt.Errorf("unsupported export format %q", format)
+	}
+
+	samples, err := a.recorder.read(time.Unix(from, 0), time.Unix(to, 0))
+	if err != nil {
+		return "", err
+	}
+	name := fmt.Sprintf("nvsmibar-%s-%s.%s",
+		time.Unix(from, 0).Format("20060102-150405"),
+		time.Unix(to, 0).Format("20060102-150405"),
+		format)
+	path := filepath.Join(exportDir(), name)
+	f, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	if err := write(f, samples); err != nil {
+		f.Close()
+		return "", err
+	}
+	return path, f.Close()
+}
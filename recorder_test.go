@@ -0,0 +1,195 @@
+package main
+
+import (
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+type fakeClock struct{ t time.Time }
+
+func (c *fakeClock) now() time.Time          { return c.t }
+func (c *fakeClock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func newTestRecorder(t *testing.T, start time.Time) (*recorder, *fakeClock) {
+	t.Helper()
+	clock := &fakeClock{t: start}
+	r := newRecorder(t.TempDir(), clock.now)
+	r.configure(RecorderConfig{Enabled: true, RetentionDays: 2})
+	return r, clock
+}
+
+func TestRecorderRotatesDailyAndReadsRange(t *testing.T) {
+	start := time.Date(2024, 3, 1, 23, 58, 0, 0, time.UTC)
+	r, clock := newTestRecorder(t, start)
+
+	for i := 0; i < 6; i++ {
+		r.record("conn_a", "box-a", []GPU{{Index: 0, Name: "A100", UUID: "GPU-a", Util: i * 10, Temp: 60, FanSpeed: -1}})
+		clock.advance(time.Minute)
+	}
+	if err := r.flush(); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+
+	for _, name := range []string{"samples-20240301.csv.gz", "samples-20240302.csv.gz"} {
+		if _, err := os.Stat(filepath.Join(r.dir, name)); err != nil {
+			t.Fatalf("expected segment %s: %v", name, err)
+		}
+	}
+
+	all, err := r.read(start, clock.now())
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if len(all) != 6 {
+		t.Fatalf("expected 6 samples, got %d", len(all))
+	}
+	if got := all[5].GPU; got.Util != 50 || got.FanSpeed != -1 || got.UUID != "GPU-a" || all[5].Target != "box-a" {
+		t.Fatalf("unexpected sample: %+v", all[5])
+	}
+
+	some, err := r.read(start.Add(2*time.Minute), start.Add(3*time.Minute))
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if len(some) != 2 || some[0].GPU.Util != 20 {
+		t.Fatalf("unexpected range result: %+v", some)
+	}
+}
+
+func TestRecorderFlushFailureKeepsOnlyUnwrittenDays(t *testing.T) {
+	start := time.Date(2024, 3, 1, 23, 59, 45, 0, time.UTC)
+	r, clock := newTestRecorder(t, start)
+	// The second day's segment cannot be created.
+	blocked := filepath.Join(r.dir, "samples-20240302.csv.gz")
+	if err := os.MkdirAll(blocked, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	r.record("conn_a", "box-a", []GPU{{Index: 0, Util: 1}})
+	clock.advance(30 * time.Second)
+	r.record("conn_a", "box-a", []GPU{{Index: 0, Util: 2}})
+	if err := r.flush(); err == nil {
+		t.Fatal("expected flush to fail")
+	}
+	if len(r.pending) != 1 || r.pending[0].GPU.Util != 2 {
+		t.Fatalf("expected only the unwritten day to stay pending, got %+v", r.pending)
+	}
+	if err := os.Remove(blocked); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.flush(); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+	all, err := r.read(start, clock.now())
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if len(all) != 2 {
+		t.Fatalf("expected each sample once, got %d", len(all))
+	}
+}
+
+func TestRecordToSampleNamesBadColumn(t *testing.T) {
+	rec := sampleToRecord(RecordedSample{Ts: 1, GPU: GPU{Index: 0}})
+	rec[6] = "x"
+	if _, err := recordToSample(rec); err == nil || !strings.HasPrefix(err.Error(), "parse util:") {
+		t.Fatalf("expected a util parse error, got %v", err)
+	}
+}
+
+func TestRecorderReadReportsBadRow(t *testing.T) {
+	start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	r, clock := newTestRecorder(t, start)
+	r.record("conn_a", "box-a", []GPU{{Index: 0, Util: 10}})
+	if err := r.flush(); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+
+	// Append a gzip member with a damaged row, as a bad write would leave.
+	path := filepath.Join(r.dir, "samples-20240301.csv.gz")
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := sampleToRecord(RecordedSample{Ts: start.Unix(), GPU: GPU{Index: 0}})
+	rec[6] = "x"
+	gz := gzip.NewWriter(f)
+	cw := csv.NewWriter(gz)
+	cw.Write(rec)
+	cw.Flush()
+	gz.Close()
+	f.Close()
+
+	_, err = r.read(start, clock.now())
+	if err == nil || !strings.Contains(err.Error(), "samples-20240301.csv.gz: line 3: parse util:") {
+		t.Fatalf("expected an error naming the file, row and column, got %v", err)
+	}
+}
+
+func TestRecorderDisabledWritesNothing(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(1700000000, 0)}
+	r := newRecorder(t.TempDir(), clock.now)
+	r.record("conn_a", "box-a", []GPU{{Index: 0}})
+	if err := r.flush(); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+	if entries, _ := os.ReadDir(r.dir); len(entries) != 0 {
+		t.Fatalf("expected no files, got %d", len(entries))
+	}
+}
+
+func TestRecorderRetention(t *testing.T) {
+	start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	r, clock := newTestRecorder(t, start)
+
+	for day := 0; day < 5; day++ {
+		r.record("conn_a", "box-a", []GPU{{Index: 0, Util: day}})
+		if err := r.flush(); err != nil {
+			t.Fatalf("flush: %v", err)
+		}
+		clock.advance(24 * time.Hour)
+	}
+
+	segs, err := r.segments()
+	if err != nil {
+		t.Fatalf("segments: %v", err)
+	}
+	var names []string
+	for _, s := range segs {
+		names = append(names, s.name)
+	}
+	want := "samples-20240303.csv.gz,samples-20240304.csv.gz,samples-20240305.csv.gz"
+	if strings.Join(names, ",") != want {
+		t.Fatalf("unexpected segments after retention: %v", names)
+	}
+}
+
+func TestExportSamples(t *testing.T) {
+	samples := []RecordedSample{{Ts: 1700000000, ConnectionID: "conn_a", Target: "box-a", GPU: GPU{Index: 1, Name: "RTX, 4090", Util: 42}}}
+
+	var csvOut strings.Builder
+	if err := writeSamplesCSV(&csvOut, samples); err != nil {
+		t.Fatalf("csv: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(csvOut.String()), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], "ts,connection,target,index") || !strings.Contains(lines[1], `"RTX, 4090"`) {
+		t.Fatalf("unexpected csv:\n%s", csvOut.String())
+	}
+
+	var jsonOut strings.Builder
+	if err := writeSamplesJSON(&jsonOut, samples); err != nil {
+		t.Fatalf("json: %v", err)
+	}
+	var decoded []RecordedSample
+	if err := json.Unmarshal([]byte(jsonOut.String()), &decoded); err != nil {
+		t.Fatalf("decode json: %v", err)
+	}
+	if len(decoded) != 1 || decoded[0].GPU.Util != 42 || decoded[0].ConnectionID != "conn_a" {
+		t.Fatalf("unexpected json: %+v", decoded)
+	}
+}
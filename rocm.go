@@ -0,0 +1,321 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// jsonReading decodes the shapes the AMD and Intel tools use for one reading:
+// a bare number, a string such as "35.0" or "N/A", or
+// {"value": 35, "unit": "C"}.
+type jsonReading struct {
+	value float64
+	unit  string
+	ok    bool
+}
+
+func (v *jsonReading) UnmarshalJSON(data []byte) error {
+	*v = jsonReading{}
+	data = bytes.TrimSpace(data)
+	switch {
+	case len(data) == 0 || bytes.Equal(data, []byte("null")):
+		return nil
+	case data[0] == '{':
+		var obj struct {
+			Value json.RawMessage `json:"value"`
+			Unit  string          `json:"unit"`
+		}
+		if err := json.Unmarshal(data, &obj); err != nil {
+			return nil
+		}
+		if err := v.UnmarshalJSON(obj.Value); err != nil {
+			return err
+		}
+		v.unit = obj.Unit
+		return nil
+	case data[0] == '"':
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return nil
+		}
+		v.parse(s)
+		return nil
+	default:
+		v.parse(string(data))
+		return nil
+	}
+}
+
+// parse reads "35", "35.0" or "35 C"; anything else leaves v unknown.
+func (v *jsonReading) parse(s string) {
+	fields := strings.Fields(s)
+	if len(fields) == 0 {
+		return
+	}
+	f, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+		return
+	}
+	v.value, v.ok = f, true
+	if len(fields) > 1 {
+		v.unit = fields[1]
+	}
+}
+
+// int returns the reading rounded, or -1 when unknown.
+func (v jsonReading) int() int {
+	if !v.ok {
+		return -1
+	}
+	return int(math.Round(v.value))
+}
+
+// mib returns a memory reading in MiB. amd-smi reports "MB" that are really
+// MiB; rocm-smi reports bytes.
+func (v jsonReading) mib() int {
+	if !v.ok {
+		return -1
+	}
+	switch strings.ToUpper(v.unit) {
+	case "B":
+		return int(v.value / (1 << 20))
+	case "KB", "KIB":
+		return int(v.value / 1024)
+	case "GB", "GIB":
+		return int(v.value * 1024)
+	}
+	return int(math.Round(v.value))
+}
+
+// amdSMICollector reads AMD GPUs with amd-smi (ROCm 6 and later).
+type amdSMICollector struct{}
+
+func (amdSMICollector) vendor() string { return vendorAMD }
+
+func (amdSMICollector) plan(host string) probePlan {
+	return probePlan{
+		sections: []probeSection{
+			{"static", "amd-smi static --asic --bus --driver --limit --json"},
+			{"metric", "amd-smi metric --usage --power --clock --temperature --fan --mem-usage --json"},
+		},
+		parse: func(r probeResults) ([]GPU, error) {
+			static, err := r.output("static")
+			if err != nil {
+				return nil, err
+			}
+			metric, err := r.output("metric")
+			if err != nil {
+				return nil, err
+			}
+			return parseAMDSMI([]byte(static), []byte(metric))
+		},
+	}
+}
+
+type amdSMIStatic struct {
+	GPU  int `json:"gpu"`
+	ASIC struct {
+		MarketName string `json:"market_name"`
+	} `json:"asic"`
+	Bus struct {
+		BDF      string      `json:"bdf"`
+		MaxWidth jsonReading `json:"max_pcie_width"`
+	} `json:"bus"`
+	Driver struct {
+		Version string `json:"version"`
+	} `json:"driver"`
+	Limit struct {
+		MaxPower jsonReading `json:"max_power"`
+	} `json:"limit"`
+}
+
+type amdSMIMetric struct {
+	GPU   int `json:"gpu"`
+	Usage struct {
+		GFX jsonReading `json:"gfx_activity"`
+	} `json:"usage"`
+	Power struct {
+		Socket jsonReading `json:"socket_power"`
+	} `json:"power"`
+	Clock       map[string]amdClock `json:"clock"`
+	Temperature struct {
+		Edge    jsonReading `json:"edge"`
+		Hotspot jsonReading `json:"hotspot"`
+	} `json:"temperature"`
+	Fan struct {
+		Usage jsonReading `json:"usage"`
+	} `json:"fan"`
+	Memory struct {
+		Total jsonReading `json:"total_vram"`
+		Used  jsonReading `json:"used_vram"`
+	} `json:"mem_usage"`
+}
+
+type amdClock struct {
+	Clk    jsonReading `json:"clk"`
+	MaxClk jsonReading `json:"max_clk"`
+}
+
+// decodeAMDList accepts both the bare list amd-smi printed before ROCm 6.3
+// and the newer {"gpu_data": [...]} wrapper.
+func decodeAMDList(raw []byte, v interface{}) error {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) > 0 && raw[0] == '{' {
+		var wrapped struct {
+			GPUData json.RawMessage `json:"gpu_data"`
+		}
+		if err := json.Unmarshal(raw, &wrapped); err != nil {
+			return err
+		}
+		raw = wrapped.GPUData
+	}
+	return json.Unmarshal(raw, v)
+}
+
+func parseAMDSMI(staticRaw, metricRaw []byte) ([]GPU, error) {
+	var statics []amdSMIStatic
+	if err := decodeAMDList(staticRaw, &statics); err != nil {
+		return nil, fmt.Errorf("parse amd-smi static: %w", err)
+	}
+	var metrics []amdSMIMetric
+	if err := decodeAMDList(metricRaw, &metrics); err != nil {
+		return nil, fmt.Errorf("parse amd-smi metric: %w", err)
+	}
+	byGPU := map[int]amdSMIStatic{}
+	for _, s := range statics {
+		byGPU[s.GPU] = s
+	}
+
+	gpus := make([]GPU, 0, len(metrics))
+	for _, m := range metrics {
+		s := byGPU[m.GPU]
+		g := newGPU()
+		g.Vendor = vendorAMD
+		g.Index = m.GPU
+		g.Name = strings.TrimSpace(s.ASIC.MarketName)
+		if g.Name == "" {
+			g.Name = "AMD GPU"
+		}
+		g.PCIBusID = s.Bus.BDF
+		g.DriverVersion = optionalString(s.Driver.Version)
+		g.PCIeWidthMax = s.Bus.MaxWidth.int()
+
+		g.Util = m.Usage.GFX.int()
+		g.Temp = firstKnown(m.Temperature.Edge, m.Temperature.Hotspot).int()
+		g.MemUsed = m.Memory.Used.mib()
+		g.MemTotal = m.Memory.Total.mib()
+		if g.Util < 0 || g.Temp < 0 || g.MemUsed < 0 || g.MemTotal < 0 {
+			return nil, fmt.Errorf("amd-smi gpu %d: missing utilization, temperature or memory", m.GPU)
+		}
+		g.PowerDraw = m.Power.Socket.int()
+		g.PowerLimit = s.Limit.MaxPower.int()
+		g.FanSpeed = m.Fan.Usage.int()
+		// Clocks are reported per domain (gfx_0 … gfx_7 on multi-XCD parts);
+		// the first graphics and memory domains stand in for the GPU.
+		if c, ok := m.Clock["gfx_0"]; ok {
+			g.ClockSM, g.ClockMaxSM = c.Clk.int(), c.MaxClk.int()
+		}
+		if c, ok := m.Clock["mem_0"]; ok {
+			g.ClockMem, g.ClockMaxMem = c.Clk.int(), c.MaxClk.int()
+		}
+		gpus = append(gpus, g)
+	}
+	sort.Slice(gpus, func(i, j int) bool { return gpus[i].Index < gpus[j].Index })
+	return gpus, nil
+}
+
+func firstKnown(values ...jsonReading) jsonReading {
+	for _, v := range values {
+		if v.ok {
+			return v
+		}
+	}
+	return jsonReading{}
+}
+
+// rocmSMICollector reads AMD GPUs with the older rocm-smi.
+type rocmSMICollector struct{}
+
+func (rocmSMICollector) vendor() string { return vendorAMD }
+
+func (rocmSMICollector) plan(host string) probePlan {
+	return probePlan{
+		sections: []probeSection{
+			{"gpu", "rocm-smi --showproductname --showuse --showtemp --showmeminfo vram --showpower --showmaxpower --showfan --showbus --showdriverversion --json"},
+		},
+		parse: func(r probeResults) ([]GPU, error) {
+			out, err := r.output("gpu")
+			if err != nil {
+				return nil, err
+			}
+			return parseROCmSMI([]byte(out))
+		},
+	}
+}
+
+// parseROCmSMI parses rocm-smi --json, which keys each card's readings by
+// their human-readable labels. Labels moved between releases, so each
+// reading lists the spellings seen in the wild.
+func parseROCmSMI(raw []byte) ([]GPU, error) {
+	var doc map[string]map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return nil, fmt.Errorf("parse rocm-smi output: %w", err)
+	}
+	text := func(values map[string]json.RawMessage, keys ...string) string {
+		for _, k := range keys {
+			var s string
+			if json.Unmarshal(values[k], &s) == nil && optionalString(s) != "" {
+				return strings.TrimSpace(s)
+			}
+		}
+		return ""
+	}
+	driver := text(doc["system"], "Driver version")
+
+	gpus := []GPU{}
+	for card, values := range doc {
+		index, err := strconv.Atoi(strings.TrimPrefix(card, "card"))
+		if !strings.HasPrefix(card, "card") || err != nil {
+			continue
+		}
+		reading := func(keys ...string) jsonReading {
+			for _, k := range keys {
+				var v jsonReading
+				if raw, ok := values[k]; ok && json.Unmarshal(raw, &v) == nil && v.ok {
+					return v
+				}
+			}
+			return jsonReading{}
+		}
+
+		g := newGPU()
+		g.Vendor = vendorAMD
+		g.Index = index
+		g.Name = text(values, "Device Name", "Card Series", "Card series", "Card model")
+		if g.Name == "" {
+			g.Name = "AMD GPU"
+		}
+		g.PCIBusID = text(values, "PCI Bus")
+		g.DriverVersion = optionalString(driver)
+		g.Util = reading("GPU use (%)").int()
+		g.Temp = reading("Temperature (Sensor edge) (C)", "Temperature (Sensor junction) (C)").int()
+		// rocm-smi puts the unit in the label, so tag the bytes for mib.
+		used, total := reading("VRAM Total Used Memory (B)"), reading("VRAM Total Memory (B)")
+		used.unit, total.unit = "B", "B"
+		g.MemUsed, g.MemTotal = used.mib(), total.mib()
+		if g.Util < 0 || g.Temp < 0 || g.MemUsed < 0 || g.MemTotal < 0 {
+			return nil, fmt.Errorf("rocm-smi %s: missing utilization, temperature or memory", card)
+		}
+		g.PowerDraw = reading("Average Graphics Package Power (W)", "Current Socket Graphics Package Power (W)").int()
+		g.PowerLimit = reading("Max Graphics Package Power (W)").int()
+		g.FanSpeed = reading("Fan speed (%)").int()
+		gpus = append(gpus, g)
+	}
+	sort.Slice(gpus, func(i, j int) bool { return gpus[i].Index < gpus[j].Index })
+	return gpus, nil
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func readFixture(t *testing.T, parts ...string) []byte {
+	t.Helper()
+	raw, err := os.ReadFile(filepath.Join(append([]string{"testdata"}, parts...)...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
+
+func TestParseAMDSMIList(t *testing.T) {
+	gpus, err := parseAMDSMI(readFixture(t, "amd-smi", "mi250-static.json"), readFixture(t, "amd-smi", "mi250-metric.json"))
+	if err != nil {
+		t.Fatalf("parseAMDSMI returned error: %v", err)
+	}
+	if len(gpus) != 2 {
+		t.Fatalf("expected 2 gpus, got %d", len(gpus))
+	}
+	g := gpus[0]
+	if g.Vendor != vendorAMD || g.Name != "AMD Instinct MI250X" || g.PCIBusID != "0000:c1:00.0" || g.DriverVersion != "6.3.6" {
+		t.Fatalf("unexpected identity: %+v", g)
+	}
+	if g.Util != 97 || g.Temp != 52 || g.MemUsed != 48211 || g.MemTotal != 65520 || g.PowerDraw != 402 || g.PowerLimit != 560 {
+		t.Fatalf("unexpected readings: %+v", g)
+	}
+	if g.ClockSM != 1700 || g.ClockMaxMem != 1600 || g.FanSpeed != -1 || g.PCIeWidthMax != 16 {
+		t.Fatalf("unexpected optional readings: %+v", g)
+	}
+	// The second GCD has no edge sensor and no power reading.
+	if g := gpus[1]; g.Temp != 39 || g.PowerDraw != -1 || g.PowerLimit != -1 || g.ClockMem != -1 {
+		t.Fatalf("unexpected second gpu: %+v", g)
+	}
+}
+
+func TestParseAMDSMIWrapped(t *testing.T) {
+	gpus, err := parseAMDSMI(readFixture(t, "amd-smi", "mi300x-static.json"), readFixture(t, "amd-smi", "mi300x-metric.json"))
+	if err != nil {
+		t.Fatalf("parseAMDSMI returned error: %v", err)
+	}
+	if len(gpus) != 1 || gpus[0].Name != "AMD Instinct MI300X" || gpus[0].MemTotal != 196592 || gpus[0].Temp != 44 || gpus[0].PowerLimit != 750 {
+		t.Fatalf("unexpected gpus: %+v", gpus)
+	}
+}
+
+func TestParseROCmSMI(t *testing.T) {
+	gpus, err := parseROCmSMI(readFixture(t, "rocm-smi", "mi250-5.7.json"))
+	if err != nil {
+		t.Fatalf("parseROCmSMI returned error: %v", err)
+	}
+	if len(gpus) != 2 || gpus[0].Index != 0 || gpus[1].Index != 1 {
+		t.Fatalf("unexpected gpus: %+v", gpus)
+	}
+	g := gpus[0]
+	if g.Vendor != vendorAMD || g.Name != "AMD Instinct MI250X/MI250" || g.DriverVersion != "6.2.4" || g.PCIBusID != "0000:C1:00.0" {
+		t.Fatalf("unexpected identity: %+v", g)
+	}
+	if g.Util != 97 || g.Temp != 52 || g.MemUsed != 48211 || g.MemTotal != 65520 || g.PowerDraw != 402 || g.PowerLimit != 560 {
+		t.Fatalf("unexpected readings: %+v", g)
+	}
+	if g := gpus[1]; g.Temp != 39 || g.MemUsed != 10 || g.PowerDraw != -1 || g.FanSpeed != -1 {
+		t.Fatalf("unexpected second gpu: %+v", g)
+	}
+
+	gpus, err = parseROCmSMI(readFixture(t, "rocm-smi", "rx7900-6.1.json"))
+	if err != nil {
+		t.Fatalf("parseROCmSMI returned error: %v", err)
+	}
+	if g := gpus[0]; g.Name != "Radeon RX 7900 XTX" || g.PowerDraw != 31 || g.FanSpeed != 24 || g.MemTotal != 24560 {
+		t.Fatalf("unexpected gpu: %+v", g)
+	}
+}
+
+func TestParseROCmSMIMissingReadings(t *testing.T) {
+	if _, err := parseROCmSMI([]byte(`{"card0": {"GPU use (%)": "N/A"}}`)); err == nil {
+		t.Fatal("expected error when required readings are missing")
+	}
+	if _, err := parseROCmSMI([]byte("rocm-smi: ERROR: GPU[0] : Unable to get")); err == nil {
+		t.Fatal("expected error for non-JSON output")
+	}
+}
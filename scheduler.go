@@ -0,0 +1,205 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	// defaultPollInterval is used by profiles that set no interval and by
+	// the legacy default connection.
+	defaultPollInterval = time.Second
+	maxPollIntervalSec  = 300
+
+	// idlePollInterval is how often an adaptive profile polls while the
+	// window is hidden and the metrics are steady.
+	idlePollInterval = 15 * time.Second
+	// adaptiveSettle is how long an adaptive profile keeps polling fast after
+	// the metrics last changed.
+	adaptiveSettle = 30 * time.Second
+
+	// A GPU changed when any of these moved at least this much between polls.
+	utilChangePct   = 5
+	tempChangeC     = 3
+	memChangeFrac   = 0.02
+	powerChangeFrac = 0.05
+)
+
+// clock is the worker's time source, swapped out in tests.
+type clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// Poll states reported in ConnectionMeta.PollState.
+const (
+	pollFast    = "fast"
+	pollIdle    = "idle"
+	pollBackoff = "backoff"
+	pollPaused  = "paused"
+)
+
+// pollEnv is what the scheduler needs to know about the machine NVSmiBar
+// runs on.
+type pollEnv struct {
+	visible    bool
+	asleep     bool
+	lowBattery bool
+}
+
+// pollScheduler decides when a worker polls next. It only sees the times it
+// is given, so it is tested without a running worker.
+type pollScheduler struct {
+	interval time.Duration
+	adaptive bool
+
+	lastPoll   time.Time
+	lastChange time.Time
+	prev       []GPU
+
+	failures  int
+	retryable bool
+}
+
+func newPollScheduler(interval time.Duration, adaptive bool) *pollScheduler {
+	s := &pollScheduler{}
+	s.configure(interval, adaptive)
+	return s
+}
+
+// configure applies a profile's settings; they take effect from the next
+// call to next.
+func (s *pollScheduler) configure(interval time.Duration, adaptive bool) {
+	if interval <= 0 {
+		interval = defaultPollInterval
+	}
+	s.interval, s.adaptive = interval, adaptive
+}
+
+// succeeded records a poll that read gpus at now.
+func (s *pollScheduler) succeeded(now time.Time, gpus []GPU) {
+	if s.prev == nil || gpusChanged(s.prev, gpus) {
+		s.lastChange = now
+	}
+	s.prev = gpus
+	s.lastPoll = now
+	s.failures = 0
+}
+
+// failed records a failed poll at now.
+func (s *pollScheduler) failed(now time.Time, retryable bool) {
+	s.lastPoll = now
+	s.failures++
+	s.retryable = retryable
+}
+
+// next returns the state the worker is in and when it should poll next.
+// due is zero while paused: the worker waits for the environment to change.
+// A due time in the past means poll now.
+func (s *pollScheduler) next(now time.Time, env pollEnv) (state string, due time.Time) {
+	// Polls could not run during sleep anyway, and a low battery is worth
+	// more than fresh readings. On wake the overdue poll runs at once.
+	if env.asleep || env.lowBattery {
+		return pollPaused, time.Time{}
+	}
+	if s.lastPoll.IsZero() {
+		return pollFast, now
+	}
+	if s.failures > 0 {
+		return pollBackoff, s.lastPoll.Add(max(retryDelay(s.failures, s.retryable), s.interval))
+	}
+	if s.adaptive && !env.visible && now.Sub(s.lastChange) >= adaptiveSettle {
+		return pollIdle, s.lastPoll.Add(max(idlePollInterval, s.interval))
+	}
+	return pollFast, s.lastPoll.Add(s.interval)
+}
+
+// gpusChanged reports whether cur differs from prev by more than sensor
+// noise: a GPU came or went, its load, memory, temperature or power moved,
+// or its processes changed.
+func gpusChanged(prev, cur []GPU) bool {
+	if len(prev) != len(cur) {
+		return true
+	}
+	for i := range cur {
+		p, c := prev[i], cur[i]
+		switch {
+		case p.UUID != c.UUID,
+			abs(c.Util-p.Util) >= utilChangePct,
+			abs(c.Temp-p.Temp) >= tempChangeC,
+			float64(abs(c.MemUsed-p.MemUsed)) >= memChangeFrac*float64(c.MemTotal),
+			c.PowerLimit > 0 && float64(abs(c.PowerDraw-p.PowerDraw)) >= powerChangeFrac*float64(c.PowerLimit),
+			processesChanged(p.Processes, c.Processes):
+			return true
+		}
+	}
+	return false
+}
+
+func processesChanged(prev, cur []GPUProcess) bool {
+	if len(prev) != len(cur) {
+		return true
+	}
+	pids := make(map[int]bool, len(prev))
+	for _, p := range prev {
+		pids[p.PID] = true
+	}
+	for _, p := range cur {
+		if !pids[p.PID] {
+			return true
+		}
+	}
+	return false
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// pollSettings returns connection id's poll interval and whether it polls
+// adaptively. Connections without a profile poll every second.
+func (a *App) pollSettings(id string) (time.Duration, bool) {
+	cfg := a.store.snapshot()
+	i, ok := findProfile(cfg.Profiles, id)
+	if !ok {
+		return defaultPollInterval, false
+	}
+	p := cfg.Profiles[i]
+	interval := defaultPollInterval
+	if p.PollIntervalSec > 0 {
+		interval = time.Duration(p.PollIntervalSec) * time.Second
+	}
+	return interval, p.AdaptivePolling
+}
+
+func validPollInterval(sec int) error {
+	if sec < 0 || sec > maxPollIntervalSec {
+		return fmt.Errorf("poll interval must be 0 (default) or between 1 and %d seconds", maxPollIntervalSec)
+	}
+	return nil
+}
+
+// pollEnv returns the window and power state the schedulers run under.
+func (a *App) pollEnv() pollEnv {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return pollEnv{visible: a.visible, asleep: a.power.asleep, lowBattery: a.power.lowBattery()}
+}
+
+// rescheduleWorkers makes every worker re-plan its next poll after the
+// window or power state changed.
+func (a *App) rescheduleWorkers() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, w := range a.workers {
+		w.reschedule()
+	}
+}
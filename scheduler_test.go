@@ -0,0 +1,210 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// manualClock only moves when the test advances it.
+type manualClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []manualTimer
+	waits  []time.Duration
+}
+
+type manualTimer struct {
+	at time.Time
+	ch chan time.Time
+}
+
+func newManualClock() *manualClock {
+	return &manualClock{now: time.Unix(1_700_000_000, 0)}
+}
+
+func (c *manualClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *manualClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ch := make(chan time.Time, 1)
+	c.timers = append(c.timers, manualTimer{at: c.now.Add(d), ch: ch})
+	c.waits = append(c.waits, d)
+	return ch
+}
+
+func (c *manualClock) advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	pending := c.timers[:0]
+	for _, t := range c.timers {
+		if t.at.After(c.now) {
+			pending = append(pending, t)
+			continue
+		}
+		t.ch <- c.now
+	}
+	c.timers = pending
+}
+
+// lastWait is the duration of the most recent After call, 0 if none.
+func (c *manualClock) lastWait() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.waits) == 0 {
+		return 0
+	}
+	return c.waits[len(c.waits)-1]
+}
+
+func TestPollSchedulerStates(t *testing.T) {
+	t0 := time.Unix(1_700_000_000, 0)
+	gpus := []GPU{{UUID: "GPU-a", Util: 40, Temp: 60, MemUsed: 1000, MemTotal: 80000}}
+	hidden, visible := pollEnv{}, pollEnv{visible: true}
+
+	s := newPollScheduler(0, true)
+	if state, due := s.next(t0, hidden); state != pollFast || !due.Equal(t0) {
+		t.Fatalf("first poll should be immediate, got %s at %s", state, due)
+	}
+	s.succeeded(t0, gpus)
+	if state, due := s.next(t0, hidden); state != pollFast || due.Sub(t0) != time.Second {
+		t.Fatalf("expected fast poll after 1s, got %s after %s", state, due.Sub(t0))
+	}
+
+	// Steady metrics while hidden: back off once the settle time passed.
+	now := t0.Add(adaptiveSettle)
+	s.succeeded(now, gpus)
+	if state, due := s.next(now, hidden); state != pollIdle || due.Sub(now) != idlePollInterval {
+		t.Fatalf("expected idle poll after %s, got %s after %s", idlePollInterval, state, due.Sub(now))
+	}
+	if state, due := s.next(now, visible); state != pollFast || due.Sub(now) != time.Second {
+		t.Fatalf("visible window should poll fast, got %s after %s", state, due.Sub(now))
+	}
+
+	// A job starting up counts as change and restores the fast rate.
+	now = now.Add(idlePollInterval)
+	busy := []GPU{gpus[0]}
+	busy[0].Util = 97
+	s.succeeded(now, busy)
+	if state, _ := s.next(now, hidden); state != pollFast {
+		t.Fatalf("changing metrics should poll fast, got %s", state)
+	}
+
+	if state, due := s.next(now, pollEnv{asleep: true}); state != pollPaused || !due.IsZero() {
+		t.Fatalf("expected pause during sleep, got %s at %s", state, due)
+	}
+	if state, _ := s.next(now, pollEnv{lowBattery: true}); state != pollPaused {
+		t.Fatalf("expected pause on low battery, got %s", state)
+	}
+
+	// Failures back off, never faster than the interval, and waking up
+	// from a pause polls at once.
+	s.configure(10*time.Second, false)
+	if state, _ := s.next(now, pollEnv{lowBattery: true}); state != pollPaused {
+		t.Fatalf("fixed-interval profiles should pause on low battery too, got %s", state)
+	}
+	s.failed(now, true)
+	if state, due := s.next(now, hidden); state != pollBackoff || due.Sub(now) != 10*time.Second {
+		t.Fatalf("expected backoff of the 10s interval, got %s after %s", state, due.Sub(now))
+	}
+	s.failed(now, false)
+	if _, due := s.next(now, hidden); due.Sub(now) != nonRetryableDelay {
+		t.Fatalf("expected %s backoff for a non-retryable error, got %s", nonRetryableDelay, due.Sub(now))
+	}
+	s.succeeded(now, busy)
+	later := now.Add(time.Hour)
+	if state, due := s.next(later, hidden); state != pollFast || due.After(later) {
+		t.Fatalf("expected an overdue poll after a long pause, got %s at %s", state, due)
+	}
+}
+
+func TestGPUsChanged(t *testing.T) {
+	base := GPU{UUID: "GPU-a", Util: 50, Temp: 60, MemUsed: 1000, MemTotal: 10000, PowerDraw: 200, PowerLimit: 400}
+	noise := base
+	noise.Util, noise.Temp, noise.MemUsed, noise.PowerDraw = 53, 61, 1100, 210
+	if gpusChanged([]GPU{base}, []GPU{noise}) {
+		t.Fatal("sensor noise should not count as change")
+	}
+	for name, mod := range map[string]func(*GPU){
+		"util":      func(g *GPU) { g.Util = 56 },
+		"temp":      func(g *GPU) { g.Temp = 64 },
+		"memory":    func(g *GPU) { g.MemUsed = 1300 },
+		"power":     func(g *GPU) { g.PowerDraw = 230 },
+		"processes": func(g *GPU) { g.Processes = []GPUProcess{{PID: 42}} },
+	} {
+		g := base
+		mod(&g)
+		if !gpusChanged([]GPU{base}, []GPU{g}) {
+			t.Errorf("%s change not detected", name)
+		}
+	}
+	if !gpusChanged([]GPU{base}, nil) {
+		t.Error("a GPU going away should count as change")
+	}
+}
+
+func TestWorkerAdaptivePolling(t *testing.T) {
+	var polls atomic.Int32
+	a, _ := newTestApp(func(target string, port int) ([]GPU, error) {
+		polls.Add(1)
+		return []GPU{{UUID: "GPU-a", Util: 3, MemTotal: 80000}}, nil
+	})
+	defer stopTestWorkers(a)
+	clk := newManualClock()
+	a.clock = clk
+
+	if _, err := a.SaveProfile(ConnectionProfile{Target: "box", AdaptivePolling: true}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.SaveProfile(ConnectionProfile{Target: "box", PollIntervalSec: maxPollIntervalSec + 1}); err == nil {
+		t.Fatal("expected error for an out-of-range interval")
+	}
+	pollState := func() string {
+		snaps := a.GetConnectionSnapshots()
+		if len(snaps) != 1 {
+			return ""
+		}
+		return snaps[0].Meta.PollState
+	}
+
+	// Saving the profile started polling it.
+	waitFor(t, func() bool { return polls.Load() == 1 && clk.lastWait() == time.Second })
+	// Results are stamped with the worker's clock, not the wall clock.
+	id := a.ListProfiles()[0].ID
+	if pts := a.history.recent(id, 0, 1); len(pts) != 1 || pts[0].Ts != clk.Now().Unix() {
+		t.Fatalf("expected history at %d, got %+v", clk.Now().Unix(), pts)
+	}
+
+	// Hidden with steady metrics: after the settle time, poll every 15s.
+	clk.advance(adaptiveSettle)
+	waitFor(t, func() bool { return polls.Load() == 2 && clk.lastWait() == idlePollInterval })
+	if got := pollState(); got != pollIdle {
+		t.Fatalf("expected idle poll state, got %q", got)
+	}
+
+	// Opening the popup re-plans at the fast rate without waiting out 15s.
+	a.mu.Lock()
+	a.visible = true
+	a.mu.Unlock()
+	a.rescheduleWorkers()
+	waitFor(t, func() bool { return clk.lastWait() == time.Second })
+	clk.advance(time.Second)
+	waitFor(t, func() bool { return polls.Load() == 3 })
+
+	// Low battery pauses polling until the charger is plugged back in.
+	a.setBattery(powerState{onBattery: true, batteryPercent: 10})
+	waitFor(t, func() bool { return pollState() == pollPaused })
+	clk.advance(time.Minute)
+	if n := polls.Load(); n != 3 {
+		t.Fatalf("expected no polls while paused, got %d", n)
+	}
+	a.setBattery(powerState{batteryPercent: 80})
+	waitFor(t, func() bool { return polls.Load() == 4 && pollState() == pollFast })
+}
@@ -1,14 +1,21 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"math"
+	"os"
 	"os/exec"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
 type GPU struct {
+	// Vendor is "nvidia", "amd" or "intel".
+	Vendor        string `json:"vendor"`
 	Index         int    `json:"index"`
 	Name          string `json:"name"`
 	Util          int    `json:"util"`
@@ -20,110 +27,457 @@ type GPU struct {
 	PowerLimit    int    `json:"powerLimit"`
 	DriverVersion string `json:"driverVersion"`
 	CudaVersion   string `json:"cudaVersion"`
+
+	UUID        string `json:"uuid"`
+	PCIBusID    string `json:"pciBusId"`
+	PState      string `json:"pstate"`
+	ClockSM     int    `json:"clockSm"`
+	ClockMem    int    `json:"clockMem"`
+	ClockMaxSM  int    `json:"clockMaxSm"`
+	ClockMaxMem int    `json:"clockMaxMem"`
+	// ThrottleReasons names the active clock throttle reasons, empty when
+	// clocks are not held back.
+	ThrottleReasons []string `json:"throttleReasons"`
+	EccUncorrected  int      `json:"eccUncorrected"`
+	PCIeGen         int      `json:"pcieGen"`
+	PCIeGenMax      int      `json:"pcieGenMax"`
+	PCIeWidth       int      `json:"pcieWidth"`
+	PCIeWidthMax    int      `json:"pcieWidthMax"`
+	EncoderUtil     int      `json:"encoderUtil"`
+	DecoderUtil     int      `json:"decoderUtil"`
+	MemReserved     int      `json:"memReserved"`
+	MigMode         string   `json:"migMode"`
+
+	// The fields below are only reported by the XML collector.
+	MigDevices          []MigDevice `json:"migDevices"`
+	RetiredPagesSBE     int         `json:"retiredPagesSbe"`
+	RetiredPagesDBE     int         `json:"retiredPagesDbe"`
+	RetiredPagesPending bool        `json:"retiredPagesPending"`
+	RemappedRowsUnc     int         `json:"remappedRowsUnc"`
+	RemappedRowsPending bool        `json:"remappedRowsPending"`
+
+	Processes []GPUProcess `json:"processes"`
 }
 
-func queryGPUs(target string, port int) ([]GPU, error) {
-	if strings.TrimSpace(target) == "" {
-		return nil, fmt.Errorf("empty target")
-	}
+// MigDevice is one MIG instance carved out of a GPU.
+type MigDevice struct {
+	Index             int `json:"index"`
+	GPUInstanceID     int `json:"gpuInstanceId"`
+	ComputeInstanceID int `json:"computeInstanceId"`
+	SMCount           int `json:"smCount"`
+	MemUsed           int `json:"memUsed"`
+	MemTotal          int `json:"memTotal"`
+}
 
-	fullQuery := "nvidia-smi --query-gpu=index,name,utilization.gpu,temperature.gpu,memory.used,memory.total,fan.speed,power.draw,power.limit,driver_version,cuda_version --format=csv,noheader,nounits"
-	out, err := runSSHCommand(target, port, fullQuery)
-	if err != nil {
-		// CUDA query support varies by host driver stack. Retry without it.
-		if strings.Contains(strings.ToLower(err.Error()), "cuda_version") {
-			fallback := "nvidia-smi --query-gpu=index,name,utilization.gpu,temperature.gpu,memory.used,memory.total,fan.speed,power.draw,power.limit,driver_version --format=csv,noheader,nounits"
-			out, err = runSSHCommand(target, port, fallback)
+// GPUProcess is a compute process running on a GPU, as reported by
+// nvidia-smi --query-compute-apps and enriched with remote ps output.
+type GPUProcess struct {
+	GPUUUID     string `json:"gpuUuid"`
+	PID         int    `json:"pid"`
+	ProcessName string `json:"processName"`
+	UsedMemory  int    `json:"usedMemory"`
+	User        string `json:"user"`
+	Command     string `json:"command"`
+	// GPUInstanceID is the MIG GPU instance the process runs in, -1 when
+	// unknown or MIG is off.
+	GPUInstanceID int `json:"gpuInstanceId"`
+}
+
+const processSectionMarker = "--nvsmibar-apps--"
+
+// computeAppsCommand lists GPU UUIDs by index, then the compute processes
+// keyed by UUID.
+const computeAppsCommand = "nvidia-smi --query-gpu=index,uuid --format=csv,noheader,nounits" +
+	" && echo " + processSectionMarker +
+	" && nvidia-smi --query-compute-apps=gpu_uuid,pid,process_name,used_memory --format=csv,noheader,nounits"
+
+// processOwnersCommand prints user and command line of every compute
+// process. It lists the PIDs itself so the probe needs no second round trip.
+const processOwnersCommand = `pids=$(nvidia-smi --query-compute-apps=pid --format=csv,noheader,nounits | tr -d ' ' | paste -sd, -)` +
+	`; [ -z "$pids" ] || ps -o pid=,user=,args= -p "$pids"`
+
+// nvidiaCollector reads NVIDIA GPUs with nvidia-smi --query-gpu, dropping
+// the optional fields the host's driver rejects.
+type nvidiaCollector struct{}
+
+func (nvidiaCollector) vendor() string { return vendorNVIDIA }
+
+func (nvidiaCollector) plan(host string) probePlan {
+	fields := gpuFieldsCache.get(host)
+	return probePlan{
+		sections: []probeSection{
+			{"gpu", gpuQueryCommand(fields)},
+			{"apps", computeAppsCommand},
+			{"owners", processOwnersCommand},
+		},
+		parse: func(r probeResults) ([]GPU, error) {
+			out, err := r.output("gpu")
 			if err != nil {
+				// Field support varies by driver. Drop what this nvidia-smi
+				// rejects and probe again instead of failing the whole query.
+				if reduced, ok := dropRejectedGPUFields(fields, err.Error()); ok {
+					gpuFieldsCache.set(host, reduced)
+					return nil, errProbeAgain
+				}
 				return nil, err
 			}
-			return parseOutput(string(out), false)
-		}
-		return nil, err
+			gpuFieldsCache.set(host, fields)
+			gpus, err := parseOutput(out, fields)
+			if err != nil {
+				return nil, err
+			}
+			attachGPUProcesses(r, gpus)
+			return gpus, nil
+		},
 	}
-	return parseOutput(string(out), true)
 }
 
-func runSSHCommand(target string, port int, remoteCmd string) ([]byte, error) {
-	args := []string{
-		"-o", "BatchMode=yes",
-		"-o", "ConnectTimeout=3",
+// queryGPUs reads a host's NVIDIA GPUs without tool detection.
+func queryGPUs(target string, port int) ([]GPU, error) {
+	snap, err := probeHost(target, port, nvidiaCollector{}, nil)
+	return snap.GPUs, err
+}
+
+// attachGPUProcesses fills in UUIDs and per-GPU process lists from the apps
+// and owners sections. Process data is best effort: a failure here never
+// discards the GPU readings themselves.
+func attachGPUProcesses(r probeResults, gpus []GPU) {
+	for i := range gpus {
+		gpus[i].Processes = []GPUProcess{}
 	}
-	if port > 0 {
-		args = append(args, "-p", strconv.Itoa(port))
+	out, err := r.output("apps")
+	if err != nil {
+		return
 	}
-	args = append(args, target, remoteCmd)
-
-	cmd := exec.Command("ssh", args...)
-	out, err := cmd.CombinedOutput()
+	uuids, procs, err := parseComputeApps(out)
 	if err != nil {
-		msg := strings.TrimSpace(string(out))
-		if msg == "" {
-			msg = err.Error()
-		}
-		return nil, fmt.Errorf("ssh: %s", msg)
+		return
 	}
-	return out, nil
+	applyProbedOwners(r, procs)
+	joinGPUProcesses(gpus, uuids, procs)
 }
 
-func parseOutput(raw string, hasCuda bool) ([]GPU, error) {
-	var gpus []GPU
-	lines := strings.Split(strings.TrimSpace(raw), "\n")
-	for _, line := range lines {
+// applyProbedOwners fills in user and command line from the owners section,
+// best effort. ps exits non-zero when a process ended in between, so its
+// output is used regardless of status.
+func applyProbedOwners(r probeResults, procs []GPUProcess) {
+	if res, ok := r["owners"]; ok && len(procs) > 0 {
+		applyProcessOwners(procs, parsePSOutput(res.out))
+	}
+}
+
+// parseComputeApps parses the combined index/uuid and compute-apps output
+// produced by computeAppsCommand.
+func parseComputeApps(raw string) (map[int]string, []GPUProcess, error) {
+	uuidPart, appsPart, found := strings.Cut(raw, processSectionMarker)
+	if !found {
+		return nil, nil, fmt.Errorf("unexpected compute-apps output: %q", strings.TrimSpace(raw))
+	}
+
+	uuids := map[int]string{}
+	for _, line := range strings.Split(strings.TrimSpace(uuidPart), "\n") {
 		line = strings.TrimSpace(line)
 		if line == "" {
 			continue
 		}
 		parts := strings.Split(line, ",")
-		if len(parts) < 6 {
-			return nil, fmt.Errorf("unexpected nvidia-smi output: %q", line)
+		if len(parts) < 2 {
+			return nil, nil, fmt.Errorf("unexpected gpu uuid output: %q", line)
 		}
 		index, err := parseRequiredInt(parts[0])
 		if err != nil {
-			return nil, fmt.Errorf("parse index: %w", err)
+			return nil, nil, fmt.Errorf("parse index: %w", err)
 		}
-		name := strings.TrimSpace(parts[1])
-		util, err := parseRequiredInt(parts[2])
-		if err != nil {
-			return nil, fmt.Errorf("parse util: %w", err)
+		uuids[index] = strings.TrimSpace(parts[1])
+	}
+
+	procs := []GPUProcess{}
+	for _, line := range strings.Split(strings.TrimSpace(appsPart), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(strings.ToLower(line), "no running") {
+			continue
 		}
-		temp, err := parseRequiredInt(parts[3])
-		if err != nil {
-			return nil, fmt.Errorf("parse temp: %w", err)
+		parts := strings.Split(line, ",")
+		if len(parts) < 4 {
+			return nil, nil, fmt.Errorf("unexpected compute-apps output: %q", line)
 		}
-		memUsed, err := parseRequiredInt(parts[4])
+		pid, err := parseRequiredInt(parts[1])
 		if err != nil {
-			return nil, fmt.Errorf("parse memUsed: %w", err)
+			return nil, nil, fmt.Errorf("parse pid: %w", err)
 		}
-		memTotal, err := parseRequiredInt(parts[5])
+		// Process names may themselves contain commas; memory is always last.
+		last := len(parts) - 1
+		procs = append(procs, GPUProcess{
+			GPUUUID:       strings.TrimSpace(parts[0]),
+			PID:           pid,
+			ProcessName:   strings.TrimSpace(strings.Join(parts[2:last], ",")),
+			UsedMemory:    parseOptionalInt(parts, last),
+			GPUInstanceID: -1,
+		})
+	}
+	return uuids, procs, nil
+}
+
+type processOwner struct {
+	user    string
+	command string
+}
+
+func parsePSOutput(raw string) map[int]processOwner {
+	owners := map[int]processOwner{}
+	for _, line := range strings.Split(raw, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		pid, err := strconv.Atoi(fields[0])
 		if err != nil {
-			return nil, fmt.Errorf("parse memTotal: %w", err)
+			continue
 		}
+		owners[pid] = processOwner{
+			user:    fields[1],
+			command: strings.Join(fields[2:], " "),
+		}
+	}
+	return owners
+}
 
-		fanSpeed := parseOptionalInt(parts, 6)
-		powerDraw := parseOptionalInt(parts, 7)
-		powerLimit := parseOptionalInt(parts, 8)
-		driverVersion := parseOptionalString(parts, 9)
-		cudaVersion := ""
-		if hasCuda {
-			cudaVersion = parseOptionalString(parts, 10)
+func applyProcessOwners(procs []GPUProcess, owners map[int]processOwner) {
+	for i := range procs {
+		if owner, ok := owners[procs[i].PID]; ok {
+			procs[i].User = owner.user
+			procs[i].Command = owner.command
 		}
+	}
+}
 
-		gpus = append(gpus, GPU{
-			Index:         index,
-			Name:          name,
-			Util:          util,
-			Temp:          temp,
-			MemUsed:       memUsed,
-			MemTotal:      memTotal,
-			FanSpeed:      fanSpeed,
-			PowerDraw:     powerDraw,
-			PowerLimit:    powerLimit,
-			DriverVersion: driverVersion,
-			CudaVersion:   cudaVersion,
-		})
+func joinGPUProcesses(gpus []GPU, uuids map[int]string, procs []GPUProcess) {
+	for i := range gpus {
+		if uuid := uuids[gpus[i].Index]; uuid != "" {
+			gpus[i].UUID = uuid
+		}
+		gpus[i].Processes = []GPUProcess{}
+		if gpus[i].UUID == "" {
+			continue
+		}
+		for _, p := range procs {
+			if p.GPUUUID == gpus[i].UUID {
+				gpus[i].Processes = append(gpus[i].Processes, p)
+			}
+		}
+	}
+}
+
+// sshBinary is the ssh executable used for all remote commands. Tests point
+// it at a fake script that emits canned output.
+var sshBinary = "ssh"
+
+// controlPersist is how long an idle multiplexed master connection survives
+// after the last command finishes. Poll ticks arrive far more often, so in
+// practice the master stays up for as long as the host is watched.
+const controlPersist = "60"
+
+// sshMultiplexer tracks the ControlMaster sockets owned by the app so every
+// poll tick reuses one authenticated TCP connection per host instead of
+// performing a fresh handshake.
+type sshMultiplexer struct {
+	mu  sync.Mutex
+	dir string
+	// targets holds every target and port a master may run for; the same
+	// host on two ports has two masters.
+	targets map[muxTarget]bool
+}
+
+type muxTarget struct {
+	target string
+	port   int
+}
+
+var sshMux = &sshMultiplexer{targets: map[muxTarget]bool{}}
+
+// controlDir returns the directory holding control sockets, creating it on
+// first use. Unix socket paths are limited to ~104 bytes on macOS, so fall
+// back to /tmp when the cache dir would make the path too long.
+func (m *sshMultiplexer) controlDir() (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.dir != "" {
+		return m.dir, nil
+	}
+	dir := ""
+	if cache, err := os.UserCacheDir(); err == nil {
+		dir = filepath.Join(cache, "NVSmiBar", "ssh")
+	}
+	// "/cm-" plus the 40-character %C hash.
+	if dir == "" || len(dir)+44 > 100 {
+		dir = filepath.Join("/tmp", "nvsmibar-"+strconv.Itoa(os.Getuid()))
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", err
+	}
+	m.dir = dir
+	return dir, nil
+}
+
+// args returns the ssh options enabling multiplexing for target, or nil when
+// no socket directory is available (ssh then falls back to one-shot mode).
+func (m *sshMultiplexer) args(target string, port int) []string {
+	dir, err := m.controlDir()
+	if err != nil {
+		return nil
+	}
+	m.mu.Lock()
+	m.targets[muxTarget{target, port}] = true
+	m.mu.Unlock()
+	return []string{
+		"-o", "ControlMaster=auto",
+		"-o", "ControlPath=" + filepath.Join(dir, "cm-%C"),
+		"-o", "ControlPersist=" + controlPersist,
 	}
-	return gpus, nil
+}
+
+// closeAll asks every master connection started by the app to exit.
+func (m *sshMultiplexer) closeAll() {
+	m.mu.Lock()
+	dir := m.dir
+	targets := m.targets
+	m.targets = map[muxTarget]bool{}
+	m.mu.Unlock()
+	if dir == "" {
+		return
+	}
+	for t := range targets {
+		args := []string{"-o", "ControlPath=" + filepath.Join(dir, "cm-%C"), "-O", "exit"}
+		if t.port > 0 {
+			args = append(args, "-p", strconv.Itoa(t.port))
+		}
+		args = append(args, t.target)
+		_ = exec.Command(sshBinary, args...).Run()
+	}
+}
+
+// sshTransport runs a command on a remote host, feeding it stdin, and
+// returns its combined output. Implementations are safe for concurrent use.
+type sshTransport interface {
+	run(target string, port int, remoteCmd string, stdin string) ([]byte, error)
+	close()
+}
+
+const (
+	transportExec   = "exec"
+	transportNative = "native"
+)
+
+var (
+	transportMu     sync.Mutex
+	activeTransport sshTransport = execTransport{}
+)
+
+func newSSHTransport(name string) (sshTransport, error) {
+	switch name {
+	case "", transportExec:
+		return execTransport{}, nil
+	case transportNative:
+		return newNativeTransport(), nil
+	default:
+		return nil, fmt.Errorf("unknown ssh transport %q", name)
+	}
+}
+
+func currentTransport() sshTransport {
+	transportMu.Lock()
+	defer transportMu.Unlock()
+	return activeTransport
+}
+
+// setSSHTransport swaps the transport used by runSSHCommand and closes the
+// previous one's pooled connections.
+func setSSHTransport(t sshTransport) {
+	transportMu.Lock()
+	prev := activeTransport
+	activeTransport = t
+	transportMu.Unlock()
+	if prev != nil {
+		prev.close()
+	}
+}
+
+func closeSSHTransport() {
+	currentTransport().close()
+}
+
+func runSSHCommand(target string, port int, remoteCmd string) ([]byte, error) {
+	return currentTransport().run(target, port, remoteCmd, "")
+}
+
+// runSSHScript runs a POSIX sh script on the remote host. The script goes
+// over stdin, so its size and quoting never depend on the remote login shell.
+func runSSHScript(target string, port int, script string) ([]byte, error) {
+	return currentTransport().run(target, port, "sh -s", script)
+}
+
+// sshTransportStatus is the exit status ssh uses for its own failures, as
+// opposed to the remote command's.
+const sshTransportStatus = 255
+
+// sshExitError is a run that exited non-zero. Output is the combined
+// output. Transport marks errors from the exec transport, where status 255
+// means ssh itself failed; otherwise Status is the remote command's.
+type sshExitError struct {
+	Status    int
+	Output    string
+	Transport bool
+}
+
+func (e *sshExitError) Error() string {
+	if e.Output == "" {
+		return fmt.Sprintf("ssh: exit status %d", e.Status)
+	}
+	return "ssh: " + e.Output
+}
+
+// execTransport shells out to the system ssh binary, so ssh_config, agents
+// and ProxyJump behave exactly as in a terminal.
+type execTransport struct{}
+
+func (execTransport) close() {
+	sshMux.closeAll()
+}
+
+func (execTransport) run(target string, port int, remoteCmd string, stdin string) ([]byte, error) {
+	args := []string{
+		"-o", "BatchMode=yes",
+		"-o", "ConnectTimeout=3",
+	}
+	args = append(args, sshMux.args(target, port)...)
+	if port > 0 {
+		args = append(args, "-p", strconv.Itoa(port))
+	}
+	args = append(args, target, remoteCmd)
+
+	cmd := exec.Command(sshBinary, args...)
+	// ssh's diagnostics embed strerror text; keep them in English so
+	// classifySSHOutput can read them.
+	cmd.Env = append(os.Environ(), "LC_ALL=C")
+	// A freshly forked ControlPersist master may briefly hold our output
+	// pipes open; don't let that stall the poll loop.
+	cmd.WaitDelay = time.Second
+	if stdin != "" {
+		cmd.Stdin = strings.NewReader(stdin)
+	}
+	out, err := cmd.CombinedOutput()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return nil, &sshExitError{Status: exitErr.ExitCode(), Output: strings.TrimSpace(string(out)), Transport: true}
+	}
+	if err != nil {
+		msg := strings.TrimSpace(string(out))
+		if msg == "" {
+			msg = err.Error()
+		}
+		return nil, fmt.Errorf("ssh: %s", msg)
+	}
+	return out, nil
 }
 
 func parseRequiredInt(raw string) (int, error) {
@@ -141,6 +495,9 @@ func parseRequiredInt(raw string) (int, error) {
 	if err != nil {
 		return 0, err
 	}
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return 0, fmt.Errorf("invalid numeric value %q", raw)
+	}
 	return int(math.Round(f)), nil
 }
 
@@ -148,7 +505,11 @@ func parseOptionalInt(parts []string, index int) int {
 	if index >= len(parts) {
 		return -1
 	}
-	raw := strings.TrimSpace(parts[index])
+	return optionalInt(parts[index])
+}
+
+func optionalInt(raw string) int {
+	raw = strings.TrimSpace(raw)
 	if raw == "" || strings.EqualFold(raw, "n/a") || strings.EqualFold(raw, "[not supported]") {
 		return -1
 	}
@@ -156,18 +517,15 @@ func parseOptionalInt(parts []string, index int) int {
 		return n
 	}
 	f, err := strconv.ParseFloat(raw, 64)
-	if err != nil {
+	if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
 		return -1
 	}
 	return int(math.Round(f))
 }
 
-func parseOptionalString(parts []string, index int) string {
-	if index >= len(parts) {
-		return ""
-	}
-	raw := strings.TrimSpace(parts[index])
-	if raw == "" || strings.EqualFold(raw, "n/a") || strings.EqualFold(raw, "[not supported]") {
+func optionalString(raw string) string {
+	raw = strings.TrimSpace(raw)
+	if raw == "" || strings.EqualFold(raw, "n/a") || strings.EqualFold(raw, "[n/a]") || strings.EqualFold(raw, "[not supported]") {
 		return ""
 	}
 	return raw
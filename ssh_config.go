@@ -3,60 +3,100 @@ package main
 import (
 	"bufio"
 	"os"
+	"os/user"
 	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
 )
 
+// SSHConfigConnection is a concrete Host alias from ~/.ssh/config together
+// with the settings ssh will actually use for it.
 type SSHConfigConnection struct {
 	Name   string `json:"name"`
 	Target string `json:"target"`
 	Port   int    `json:"port"`
 	Source string `json:"source"`
+
+	HostName      string   `json:"hostName"`
+	User          string   `json:"user"`
+	ProxyJump     string   `json:"proxyJump"`
+	IdentityFiles []string `json:"identityFiles"`
+}
+
+// sshConfig is a parsed ssh_config: its Host and Match blocks in file order,
+// with Include directives expanded in place as OpenSSH does.
+type sshConfig struct {
+	blocks []*sshConfigBlock
+	home   string
+}
+
+// sshConfigBlock holds the options following one Host or Match line. Options
+// before the first Host line live in an implicit "Host *" block.
+type sshConfigBlock struct {
+	hostPatterns []string
+	match        []sshMatchCriterion
+	isMatch      bool
+	options      []sshOption
+}
+
+type sshMatchCriterion struct {
+	negate   bool
+	keyword  string
+	patterns string
+}
+
+type sshOption struct {
+	key   string
+	value string
 }
 
-type hostBlock struct {
-	patterns []string
-	hostName string
-	user     string
-	port     int
+// sshHostConfig is the effective configuration for one destination.
+type sshHostConfig struct {
+	HostName      string
+	User          string
+	Port          int
+	ProxyJump     string
+	IdentityFiles []string
 }
 
 func discoverSSHConfigConnections() ([]SSHConfigConnection, error) {
-	home, err := os.UserHomeDir()
+	cfg, err := loadUserSSHConfig()
 	if err != nil {
 		return []SSHConfigConnection{}, err
 	}
+	return cfg.connections(), nil
+}
+
+// loadUserSSHConfig parses ~/.ssh/config. A missing file yields an empty
+// config so every host resolves to ssh's defaults.
+func loadUserSSHConfig() (*sshConfig, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return &sshConfig{}, err
+	}
 	root := filepath.Join(home, ".ssh", "config")
 	if _, err := os.Stat(root); err != nil {
 		if os.IsNotExist(err) {
-			return []SSHConfigConnection{}, nil
+			return &sshConfig{home: home}, nil
 		}
-		return []SSHConfigConnection{}, err
+		return &sshConfig{home: home}, err
 	}
+	return loadSSHConfig(root, home)
+}
 
-	visited := map[string]bool{}
-	seen := map[string]bool{}
-	connections := []SSHConfigConnection{}
-	if err := parseSSHConfigFile(root, home, visited, seen, &connections); err != nil {
-		return []SSHConfigConnection{}, err
+func loadSSHConfig(path string, home string) (*sshConfig, error) {
+	cfg := &sshConfig{home: home}
+	global := &sshConfigBlock{hostPatterns: []string{"*"}}
+	cfg.blocks = append(cfg.blocks, global)
+	current := global
+	if err := cfg.parseFile(path, map[string]bool{}, &current); err != nil {
+		return cfg, err
 	}
-
-	sort.Slice(connections, func(i, j int) bool {
-		if connections[i].Name != connections[j].Name {
-			return connections[i].Name < connections[j].Name
-		}
-		if connections[i].Target != connections[j].Target {
-			return connections[i].Target < connections[j].Target
-		}
-		return connections[i].Port < connections[j].Port
-	})
-
-	return connections, nil
+	return cfg, nil
 }
 
-func parseSSHConfigFile(path string, home string, visited map[string]bool, seen map[string]bool, out *[]SSHConfigConnection) error {
+func (c *sshConfig) parseFile(path string, visited map[string]bool, current **sshConfigBlock) error {
 	resolved, err := filepath.Abs(path)
 	if err != nil {
 		resolved = path
@@ -73,86 +113,289 @@ func parseSSHConfigFile(path string, home string, visited map[string]bool, seen
 	defer file.Close()
 
 	scanner := bufio.NewScanner(file)
-	var block *hostBlock
 	fileDir := filepath.Dir(resolved)
+	for scanner.Scan() {
+		line := strings.TrimSpace(stripSSHComments(scanner.Text()))
+		if line == "" {
+			continue
+		}
 
-	flush := func() {
-		if block == nil {
-			return
+		key, value := splitSSHDirective(line)
+		if key == "" {
+			continue
 		}
-		for _, pattern := range block.patterns {
-			if pattern == "" || pattern == "*" || strings.HasPrefix(pattern, "!") {
-				continue
-			}
-			if strings.ContainsAny(pattern, "*?") {
-				continue
-			}
 
-			target := pattern
-			if block.hostName != "" {
-				target = block.hostName
+		switch strings.ToLower(key) {
+		case "include":
+			// Included files continue the current block until they open
+			// their own Host or Match block.
+			for _, pattern := range splitSSHArgs(value) {
+				for _, includePath := range resolveIncludePaths(pattern, fileDir, c.home) {
+					_ = c.parseFile(includePath, visited, current)
+				}
 			}
-			if block.user != "" {
-				target = block.user + "@" + target
+		case "host":
+			block := &sshConfigBlock{hostPatterns: splitSSHArgs(value)}
+			c.blocks = append(c.blocks, block)
+			*current = block
+		case "match":
+			block := &sshConfigBlock{isMatch: true, match: parseSSHMatch(value)}
+			c.blocks = append(c.blocks, block)
+			*current = block
+		default:
+			(*current).options = append((*current).options, sshOption{key: strings.ToLower(key), value: value})
+		}
+	}
+	return scanner.Err()
+}
+
+func parseSSHMatch(value string) []sshMatchCriterion {
+	args := splitSSHArgs(value)
+	var criteria []sshMatchCriterion
+	for i := 0; i < len(args); i++ {
+		keyword := strings.ToLower(args[i])
+		negate := strings.HasPrefix(keyword, "!")
+		keyword = strings.TrimPrefix(keyword, "!")
+		crit := sshMatchCriterion{negate: negate, keyword: keyword}
+		switch keyword {
+		case "all", "canonical", "final":
+		default:
+			if i+1 < len(args) {
+				i++
+				crit.patterns = args[i]
 			}
+		}
+		criteria = append(criteria, crit)
+	}
+	return criteria
+}
 
-			key := pattern + "|" + target + "|" + strconv.Itoa(block.port)
-			if seen[key] {
+// resolve evaluates the config for alias the way ssh -G does: blocks are
+// checked in order and the first value obtained for each option wins, except
+// IdentityFile which accumulates. userOverride is a user given on the command
+// line (user@alias) and takes precedence over User directives.
+func (c *sshConfig) resolve(alias string, userOverride string) sshHostConfig {
+	localUser := currentUserName()
+	values := map[string]string{}
+	var identityFiles []string
+
+	for _, block := range c.blocks {
+		hostName := alias
+		if v, ok := values["hostname"]; ok {
+			hostName = expandSSHTokens(v, map[byte]string{'h': alias})
+		}
+		targetUser := userOverride
+		if targetUser == "" {
+			targetUser = values["user"]
+		}
+		if targetUser == "" {
+			targetUser = localUser
+		}
+		if !block.matches(alias, hostName, targetUser, localUser) {
+			continue
+		}
+		for _, opt := range block.options {
+			if opt.key == "identityfile" {
+				identityFiles = append(identityFiles, trimSSHValue(opt.value))
 				continue
 			}
-			seen[key] = true
-
-			*out = append(*out, SSHConfigConnection{
-				Name:   pattern,
-				Target: target,
-				Port:   block.port,
-				Source: "ssh_config",
-			})
+			if _, ok := values[opt.key]; !ok {
+				values[opt.key] = trimSSHValue(opt.value)
+			}
 		}
-		block = nil
 	}
 
-	for scanner.Scan() {
-		line := strings.TrimSpace(stripSSHComments(scanner.Text()))
-		if line == "" {
+	out := sshHostConfig{HostName: alias, User: localUser, Port: 22}
+	if v, ok := values["hostname"]; ok && v != "" {
+		out.HostName = expandSSHTokens(v, map[byte]string{'h': alias})
+	}
+	if v := values["user"]; v != "" {
+		out.User = v
+	}
+	if userOverride != "" {
+		out.User = userOverride
+	}
+	if p, err := strconv.Atoi(values["port"]); err == nil && p > 0 {
+		out.Port = p
+	}
+	if v := values["proxyjump"]; !strings.EqualFold(v, "none") {
+		out.ProxyJump = v
+	}
+
+	tokens := map[byte]string{
+		'd': c.home,
+		'h': out.HostName,
+		'n': alias,
+		'p': strconv.Itoa(out.Port),
+		'r': out.User,
+		'u': localUser,
+	}
+	out.IdentityFiles = []string{}
+	for _, f := range identityFiles {
+		if strings.EqualFold(f, "none") {
 			continue
 		}
+		f = expandSSHTokens(f, tokens)
+		if strings.HasPrefix(f, "~/") && c.home != "" {
+			f = filepath.Join(c.home, f[2:])
+		}
+		out.IdentityFiles = append(out.IdentityFiles, f)
+	}
+	return out
+}
 
-		key, value := splitSSHDirective(line)
-		if key == "" {
+func (b *sshConfigBlock) matches(alias, hostName, targetUser, localUser string) bool {
+	if !b.isMatch {
+		return matchSSHPatternList(b.hostPatterns, alias)
+	}
+	if len(b.match) == 0 {
+		return false
+	}
+	for _, crit := range b.match {
+		var ok bool
+		patterns := strings.Split(crit.patterns, ",")
+		switch crit.keyword {
+		case "all":
+			ok = true
+		case "host":
+			ok = matchSSHPatternList(patterns, hostName)
+		case "originalhost":
+			ok = matchSSHPatternList(patterns, alias)
+		case "user":
+			ok = matchSSHPatternList(patterns, targetUser)
+		case "localuser":
+			ok = matchSSHPatternList(patterns, localUser)
+		default:
+			// exec, localnetwork, canonical, final and tagged depend on state
+			// we do not model; treat the block as not applying.
+			return false
+		}
+		if ok == crit.negate {
+			return false
+		}
+	}
+	return true
+}
+
+// matchSSHPatternList reports whether value matches any pattern and none of
+// the negated (!pattern) entries.
+func matchSSHPatternList(patterns []string, value string) bool {
+	matched := false
+	for _, p := range patterns {
+		p = strings.TrimSpace(p)
+		if p == "" {
 			continue
 		}
+		if strings.HasPrefix(p, "!") {
+			if matchSSHPattern(p[1:], value) {
+				return false
+			}
+			continue
+		}
+		if matchSSHPattern(p, value) {
+			matched = true
+		}
+	}
+	return matched
+}
 
-		switch strings.ToLower(key) {
-		case "include":
-			patterns := strings.Fields(value)
-			for _, pattern := range patterns {
-				for _, includePath := range resolveIncludePaths(pattern, fileDir, home) {
-					_ = parseSSHConfigFile(includePath, home, visited, seen, out)
+// matchSSHPattern implements ssh's case-insensitive '*' and '?' wildcards.
+func matchSSHPattern(pattern, value string) bool {
+	pattern = strings.ToLower(pattern)
+	value = strings.ToLower(value)
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			pattern = strings.TrimLeft(pattern, "*")
+			if pattern == "" {
+				return true
+			}
+			for i := 0; i <= len(value); i++ {
+				if matchSSHPattern(pattern, value[i:]) {
+					return true
 				}
 			}
-		case "host":
-			flush()
-			block = &hostBlock{patterns: strings.Fields(value)}
-		case "hostname":
-			if block != nil {
-				block.hostName = trimSSHValue(value)
+			return false
+		case '?':
+			if value == "" {
+				return false
 			}
-		case "user":
-			if block != nil {
-				block.user = trimSSHValue(value)
+		default:
+			if value == "" || pattern[0] != value[0] {
+				return false
 			}
-		case "port":
-			if block != nil {
-				if p, err := strconv.Atoi(strings.TrimSpace(value)); err == nil {
-					block.port = p
-				}
+		}
+		pattern, value = pattern[1:], value[1:]
+	}
+	return value == ""
+}
+
+func expandSSHTokens(s string, tokens map[byte]string) string {
+	if !strings.Contains(s, "%") {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '%' || i+1 == len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+		if s[i] == '%' {
+			b.WriteByte('%')
+		} else if v, ok := tokens[s[i]]; ok {
+			b.WriteString(v)
+		} else {
+			b.WriteByte('%')
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String()
+}
+
+// connections lists every concrete Host alias with its resolved settings.
+// Wildcard and negated patterns are only used for inheritance.
+func (c *sshConfig) connections() []SSHConfigConnection {
+	seen := map[string]bool{}
+	connections := []SSHConfigConnection{}
+	for _, block := range c.blocks[1:] {
+		if block.isMatch {
+			continue
+		}
+		for _, pattern := range block.hostPatterns {
+			if pattern == "" || strings.HasPrefix(pattern, "!") || strings.ContainsAny(pattern, "*?") {
+				continue
 			}
+			if seen[pattern] {
+				continue
+			}
+			seen[pattern] = true
+
+			resolved := c.resolve(pattern, "")
+			connections = append(connections, SSHConfigConnection{
+				Name:          pattern,
+				Target:        pattern,
+				Port:          resolved.Port,
+				Source:        "ssh_config",
+				HostName:      resolved.HostName,
+				User:          resolved.User,
+				ProxyJump:     resolved.ProxyJump,
+				IdentityFiles: resolved.IdentityFiles,
+			})
 		}
 	}
-	flush()
 
-	return scanner.Err()
+	sort.Slice(connections, func(i, j int) bool {
+		return connections[i].Name < connections[j].Name
+	})
+	return connections
+}
+
+func currentUserName() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return os.Getenv("USER")
 }
 
 func stripSSHComments(line string) string {
@@ -178,15 +421,42 @@ func stripSSHComments(line string) string {
 }
 
 func splitSSHDirective(line string) (string, string) {
-	idx := strings.IndexAny(line, " \t")
+	idx := strings.IndexAny(line, " \t=")
 	if idx < 0 {
 		return strings.TrimSpace(line), ""
 	}
 	key := strings.TrimSpace(line[:idx])
 	value := strings.TrimSpace(line[idx:])
+	value = strings.TrimSpace(strings.TrimPrefix(value, "="))
 	return key, value
 }
 
+// splitSSHArgs splits a directive value on whitespace, honouring double
+// quotes.
+func splitSSHArgs(value string) []string {
+	var args []string
+	var b strings.Builder
+	inQuote := false
+	flush := func() {
+		if b.Len() > 0 {
+			args = append(args, b.String())
+			b.Reset()
+		}
+	}
+	for _, r := range value {
+		switch {
+		case r == '"':
+			inQuote = !inQuote
+		case (r == ' ' || r == '\t') && !inQuote:
+			flush()
+		default:
+			b.WriteRune(r)
+		}
+	}
+	flush()
+	return args
+}
+
 func trimSSHValue(value string) string {
 	value = strings.TrimSpace(value)
 	value = strings.TrimPrefix(value, "\"")
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func writeSSHConfig(t *testing.T, files map[string]string) (root string, home string) {
+	t.Helper()
+	home = t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(home, ".ssh", name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+			t.Fatalf("mkdir: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+	return filepath.Join(home, ".ssh", "config"), home
+}
+
+func TestSSHConfigResolveFirstMatchWins(t *testing.T) {
+	root, home := writeSSHConfig(t, map[string]string{
+		"config": `
+User fallback
+Include conf.d/*
+
+Host gpu-*  !gpu-bastion
+    HostName %h.cluster.example
+    ProxyJump gpu-bastion
+    IdentityFile ~/.ssh/id_%r_%h
+
+Host gpu-a
+    # Too late: gpu-* already set HostName and User is set globally.
+    HostName ignored.example
+    Port 2201
+
+Host gpu-bastion
+    HostName bastion.example
+    User jump
+
+Host *
+    Port 2222
+    IdentityFile ~/.ssh/id_default
+`,
+		"conf.d/extra": `
+Host gpu-b
+    User bob
+`,
+	})
+	cfg, err := loadSSHConfig(root, home)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	got := cfg.resolve("gpu-a", "")
+	want := sshHostConfig{
+		HostName:  "gpu-a.cluster.example",
+		User:      "fallback",
+		Port:      2201,
+		ProxyJump: "gpu-bastion",
+		IdentityFiles: []string{
+			filepath.Join(home, ".ssh", "id_fallback_gpu-a.cluster.example"),
+			filepath.Join(home, ".ssh", "id_default"),
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("gpu-a:\n got %+v\nwant %+v", got, want)
+	}
+
+	// User from the top-level block comes first, so the included Host gpu-b
+	// block cannot override it; a command-line user always wins.
+	if got := cfg.resolve("gpu-b", ""); got.User != "fallback" || got.Port != 2222 {
+		t.Fatalf("gpu-b: unexpected %+v", got)
+	}
+	if got := cfg.resolve("gpu-b", "carol"); got.User != "carol" || got.IdentityFiles[0] != filepath.Join(home, ".ssh", "id_carol_gpu-b.cluster.example") {
+		t.Fatalf("gpu-b as carol: unexpected %+v", got)
+	}
+
+	bastion := cfg.resolve("gpu-bastion", "")
+	if bastion.HostName != "bastion.example" || bastion.ProxyJump != "" || bastion.User != "fallback" {
+		t.Fatalf("negated pattern should exclude bastion: %+v", bastion)
+	}
+}
+
+func TestSSHConfigMatchBlocks(t *testing.T) {
+	root, home := writeSSHConfig(t, map[string]string{
+		"config": `
+Host lab
+    HostName node7.lab.internal
+
+Match host *.lab.internal !user root
+    User researcher
+    ProxyJump gw.lab.internal:2200
+
+Match originalhost prod exec "test -f /nonexistent"
+    User never
+
+Match all
+    Port 2022
+`,
+	})
+	cfg, err := loadSSHConfig(root, home)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	lab := cfg.resolve("lab", "alice")
+	if lab.HostName != "node7.lab.internal" || lab.User != "alice" || lab.ProxyJump != "gw.lab.internal:2200" || lab.Port != 2022 {
+		t.Fatalf("lab: unexpected %+v", lab)
+	}
+	if root := cfg.resolve("lab", "root"); root.ProxyJump != "" || root.User != "root" {
+		t.Fatalf("negated user criterion should skip block: %+v", root)
+	}
+	if prod := cfg.resolve("prod", ""); prod.User == "never" || prod.HostName != "prod" {
+		t.Fatalf("unsupported exec criterion should not match: %+v", prod)
+	}
+}
+
+func TestSSHConfigConnections(t *testing.T) {
+	root, home := writeSSHConfig(t, map[string]string{
+		"config": `
+Host *.example web-?
+    User ops
+Host db "build box" !nope
+    HostName 10.0.0.5
+    ProxyJump none
+Host db
+    Port 2200
+`,
+	})
+	cfg, err := loadSSHConfig(root, home)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	conns := cfg.connections()
+	if len(conns) != 2 || conns[0].Name != "build box" || conns[1].Name != "db" {
+		t.Fatalf("unexpected connections: %+v", conns)
+	}
+	db := conns[1]
+	if db.Target != "db" || db.HostName != "10.0.0.5" || db.Port != 2200 || db.ProxyJump != "" || db.Source != "ssh_config" {
+		t.Fatalf("unexpected db connection: %+v", db)
+	}
+}
+
+func TestMatchSSHPattern(t *testing.T) {
+	cases := []struct {
+		pattern, value string
+		want           bool
+	}{
+		{"*", "anything", true},
+		{"gpu-?", "gpu-1", true},
+		{"gpu-?", "gpu-10", false},
+		{"*.EXAMPLE.com", "a.example.COM", true},
+		{"a*b*c", "axxbyyc", true},
+		{"a*b*c", "axxbyy", false},
+	}
+	for _, tc := range cases {
+		if got := matchSSHPattern(tc.pattern, tc.value); got != tc.want {
+			t.Errorf("matchSSHPattern(%q, %q) = %v, want %v", tc.pattern, tc.value, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,418 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// sshErrorKind says which stage of a native SSH connection failed.
+type sshErrorKind int
+
+const (
+	sshErrDial sshErrorKind = iota + 1
+	sshErrTimeout
+	sshErrAuth
+	sshErrHostKey
+)
+
+// sshError is returned by the native transport for connection-level
+// failures, so classification never depends on the wording of the message.
+type sshError struct {
+	Kind sshErrorKind
+	Addr string
+	// Jump is set when the failing hop is a ProxyJump host, or the jump
+	// host could not reach the next hop.
+	Jump bool
+	Err  error
+}
+
+func (e *sshError) Error() string {
+	return fmt.Sprintf("ssh: %s: %v", e.Addr, e.Err)
+}
+
+func (e *sshError) Unwrap() error {
+	return e.Err
+}
+
+const (
+	nativeDialTimeout    = 3 * time.Second
+	nativeCommandTimeout = 30 * time.Second
+)
+
+// defaultIdentityFiles are tried in order, like ssh does without IdentityFile.
+var defaultIdentityFiles = []string{"id_ed25519", "id_ecdsa", "id_rsa"}
+
+// nativeTransport talks SSH directly via golang.org/x/crypto/ssh, keeping one
+// authenticated client per host open between polls. Hosts are resolved with
+// ~/.ssh/config, re-read on every run like the ssh binary does;
+// authentication uses the ssh-agent and unencrypted identity files, and host
+// keys are checked against known_hosts from sshDir.
+type nativeTransport struct {
+	mu      sync.Mutex
+	clients map[string]*ssh.Client
+
+	sshDir         string
+	loadConfig     func() (*sshConfig, error)
+	dialTimeout    time.Duration
+	commandTimeout time.Duration
+}
+
+func newNativeTransport() *nativeTransport {
+	dir := ""
+	if home, err := os.UserHomeDir(); err == nil {
+		dir = filepath.Join(home, ".ssh")
+	}
+	return &nativeTransport{
+		clients:        map[string]*ssh.Client{},
+		sshDir:         dir,
+		loadConfig:     loadUserSSHConfig,
+		dialTimeout:    nativeDialTimeout,
+		commandTimeout: nativeCommandTimeout,
+	}
+}
+
+// nativeHop is one SSH connection on the way to a target.
+type nativeHop struct {
+	user          string
+	addr          string
+	identityFiles []string
+}
+
+func (h nativeHop) key() string {
+	return h.user + "@" + h.addr
+}
+
+// route resolves a target as accepted by the exec transport (alias,
+// user@host, user@host:port for jump hosts) into the hops to dial, ending
+// with the target itself. port overrides the configured port when set.
+func (t *nativeTransport) route(target string, port int) ([]nativeHop, error) {
+	cfg, err := t.loadConfig()
+	if err != nil {
+		return nil, fmt.Errorf("ssh config: %w", err)
+	}
+	userName, alias, found := strings.Cut(target, "@")
+	if !found {
+		userName, alias = "", target
+	}
+	resolved := cfg.resolve(alias, userName)
+	if port <= 0 {
+		port = resolved.Port
+	}
+	final := nativeHop{
+		user:          resolved.User,
+		addr:          net.JoinHostPort(resolved.HostName, strconv.Itoa(port)),
+		identityFiles: resolved.IdentityFiles,
+	}
+
+	var hops []nativeHop
+	if resolved.ProxyJump != "" {
+		for _, spec := range strings.Split(resolved.ProxyJump, ",") {
+			jumpTarget, jumpPort := strings.TrimSpace(spec), 0
+			if host, p, err := net.SplitHostPort(jumpTarget); err == nil {
+				jumpTarget = host
+				jumpPort, _ = strconv.Atoi(p)
+			}
+			// Jump hosts use their own config, but not their own ProxyJump.
+			userName, alias, found := strings.Cut(jumpTarget, "@")
+			if !found {
+				userName, alias = "", jumpTarget
+			}
+			jump := cfg.resolve(alias, userName)
+			if jumpPort <= 0 {
+				jumpPort = jump.Port
+			}
+			hops = append(hops, nativeHop{
+				user:          jump.User,
+				addr:          net.JoinHostPort(jump.HostName, strconv.Itoa(jumpPort)),
+				identityFiles: jump.IdentityFiles,
+			})
+		}
+	}
+	return append(hops, final), nil
+}
+
+func (t *nativeTransport) run(target string, port int, remoteCmd string, stdin string) ([]byte, error) {
+	hops, err := t.route(target, port)
+	if err != nil {
+		return nil, err
+	}
+	addr := hops[len(hops)-1].addr
+
+	for attempt := 0; ; attempt++ {
+		client, err := t.client(hops)
+		if err != nil {
+			return nil, err
+		}
+		session, err := client.NewSession()
+		if err != nil {
+			// The pooled connection went away between polls; redial once.
+			t.drop(hopsKey(hops), client)
+			if attempt == 0 {
+				continue
+			}
+			return nil, &sshError{Kind: sshErrDial, Addr: addr, Err: err}
+		}
+		if stdin != "" {
+			session.Stdin = strings.NewReader(stdin)
+		}
+		out, err := t.runSession(session, addr, remoteCmd)
+		var exitErr *sshExitError
+		if err != nil && !errors.As(err, &exitErr) {
+			// The command timed out or the connection broke under it;
+			// the client may be wedged, so the next poll dials afresh.
+			t.drop(hopsKey(hops), client)
+		}
+		return out, err
+	}
+}
+
+func hopsKey(hops []nativeHop) string {
+	keys := make([]string, len(hops))
+	for i, h := range hops {
+		keys[i] = h.key()
+	}
+	return strings.Join(keys, ",")
+}
+
+func (t *nativeTransport) runSession(session *ssh.Session, addr string, remoteCmd string) ([]byte, error) {
+	defer session.Close()
+
+	type result struct {
+		out []byte
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		out, err := session.CombinedOutput(remoteCmd)
+		done <- result{out, err}
+	}()
+
+	timer := time.NewTimer(t.commandTimeout)
+	defer timer.Stop()
+	select {
+	case r := <-done:
+		var exitErr *ssh.ExitError
+		if errors.As(r.err, &exitErr) {
+			return nil, &sshExitError{Status: exitErr.ExitStatus(), Output: strings.TrimSpace(string(r.out))}
+		}
+		if r.err != nil {
+			msg := strings.TrimSpace(string(r.out))
+			if msg == "" {
+				msg = r.err.Error()
+			}
+			return nil, fmt.Errorf("ssh: %s", msg)
+		}
+		return r.out, nil
+	case <-timer.C:
+		return nil, &sshError{Kind: sshErrTimeout, Addr: addr, Err: fmt.Errorf("command timed out after %s", t.commandTimeout)}
+	}
+}
+
+// client returns a pooled client for the last hop, dialing it through the
+// (also pooled) client for the preceding hops.
+func (t *nativeTransport) client(hops []nativeHop) (*ssh.Client, error) {
+	key := hopsKey(hops)
+	t.mu.Lock()
+	client, ok := t.clients[key]
+	t.mu.Unlock()
+	if ok {
+		return client, nil
+	}
+
+	var via *ssh.Client
+	if len(hops) > 1 {
+		var err error
+		if via, err = t.client(hops[:len(hops)-1]); err != nil {
+			var sshErr *sshError
+			if errors.As(err, &sshErr) {
+				sshErr.Jump = true
+			}
+			return nil, err
+		}
+	}
+	client, err := t.dial(via, hops[len(hops)-1])
+	if err != nil {
+		return nil, err
+	}
+	t.mu.Lock()
+	if existing, ok := t.clients[key]; ok {
+		// Another worker dialed the same host concurrently.
+		t.mu.Unlock()
+		client.Close()
+		return existing, nil
+	}
+	t.clients[key] = client
+	t.mu.Unlock()
+
+	go func() {
+		client.Wait()
+		t.drop(key, client)
+	}()
+	return client, nil
+}
+
+func (t *nativeTransport) drop(key string, client *ssh.Client) {
+	t.mu.Lock()
+	if t.clients[key] == client {
+		delete(t.clients, key)
+	}
+	t.mu.Unlock()
+	client.Close()
+}
+
+func (t *nativeTransport) close() {
+	t.mu.Lock()
+	clients := t.clients
+	t.clients = map[string]*ssh.Client{}
+	t.mu.Unlock()
+	for _, c := range clients {
+		c.Close()
+	}
+}
+
+func (t *nativeTransport) dial(via *ssh.Client, hop nativeHop) (*ssh.Client, error) {
+	addr := hop.addr
+	checkHostKey, err := t.hostKeyCallback()
+	if err != nil {
+		return nil, &sshError{Kind: sshErrHostKey, Addr: addr, Err: err}
+	}
+	auth, closeAgent := t.authMethods(hop.identityFiles)
+	defer closeAgent()
+	if len(auth) == 0 {
+		return nil, &sshError{Kind: sshErrAuth, Addr: addr, Err: errors.New("no ssh-agent or unencrypted identity file available")}
+	}
+
+	// Failures are classified by the handshake stage they occur in: the
+	// host key callback runs after key exchange and before authentication.
+	var hostKeyErr error
+	hostKeyChecked := false
+	config := &ssh.ClientConfig{
+		User: hop.user,
+		Auth: auth,
+		HostKeyCallback: func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+			hostKeyErr = checkHostKey(hostname, remote, key)
+			hostKeyChecked = hostKeyErr == nil
+			return hostKeyErr
+		},
+		HostKeyAlgorithms: knownHostAlgorithms(checkHostKey, addr),
+		Timeout:           t.dialTimeout,
+	}
+
+	var conn net.Conn
+	if via != nil {
+		conn, err = via.Dial("tcp", addr)
+	} else {
+		conn, err = net.DialTimeout("tcp", addr, t.dialTimeout)
+	}
+	if err != nil {
+		kind := sshErrDial
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			kind = sshErrTimeout
+		}
+		return nil, &sshError{Kind: kind, Addr: addr, Jump: via != nil, Err: err}
+	}
+	_ = conn.SetDeadline(time.Now().Add(t.dialTimeout))
+	c, chans, reqs, err := ssh.NewClientConn(conn, addr, config)
+	if err != nil {
+		conn.Close()
+		var netErr net.Error
+		switch {
+		case hostKeyErr != nil:
+			return nil, &sshError{Kind: sshErrHostKey, Addr: addr, Err: hostKeyErr}
+		case errors.As(err, &netErr) && netErr.Timeout():
+			return nil, &sshError{Kind: sshErrTimeout, Addr: addr, Err: err}
+		case hostKeyChecked:
+			return nil, &sshError{Kind: sshErrAuth, Addr: addr, Err: err}
+		default:
+			return nil, &sshError{Kind: sshErrDial, Addr: addr, Err: err}
+		}
+	}
+	_ = conn.SetDeadline(time.Time{})
+	return ssh.NewClient(c, chans, reqs), nil
+}
+
+// authMethods offers the ssh-agent first, then unencrypted identity files:
+// those configured for the host, or ssh's defaults when none are.
+// Passphrase-protected keys are skipped; they need the agent.
+func (t *nativeTransport) authMethods(identityFiles []string) ([]ssh.AuthMethod, func()) {
+	var methods []ssh.AuthMethod
+	closeAgent := func() {}
+	if sock := os.Getenv("SSH_AUTH_SOCK"); sock != "" {
+		if conn, err := net.Dial("unix", sock); err == nil {
+			methods = append(methods, ssh.PublicKeysCallback(agent.NewClient(conn).Signers))
+			closeAgent = func() { conn.Close() }
+		}
+	}
+
+	if len(identityFiles) == 0 {
+		for _, name := range defaultIdentityFiles {
+			identityFiles = append(identityFiles, filepath.Join(t.sshDir, name))
+		}
+	}
+	var signers []ssh.Signer
+	for _, path := range identityFiles {
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		signer, err := ssh.ParsePrivateKey(raw)
+		if err != nil {
+			continue
+		}
+		signers = append(signers, signer)
+	}
+	if len(signers) > 0 {
+		methods = append(methods, ssh.PublicKeys(signers...))
+	}
+	return methods, closeAgent
+}
+
+func (t *nativeTransport) hostKeyCallback() (ssh.HostKeyCallback, error) {
+	var files []string
+	for _, name := range []string{"known_hosts", "known_hosts2"} {
+		path := filepath.Join(t.sshDir, name)
+		if _, err := os.Stat(path); err == nil {
+			files = append(files, path)
+		}
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no known_hosts file in %s", t.sshDir)
+	}
+	return knownhosts.New(files...)
+}
+
+// knownHostAlgorithms restricts negotiation to the key types recorded for
+// addr. Without it the server may present a key type we have no entry for
+// and verification fails even though the host is known.
+func knownHostAlgorithms(check ssh.HostKeyCallback, addr string) []string {
+	probe, err := ssh.NewPublicKey(ed25519.PublicKey(make([]byte, ed25519.PublicKeySize)))
+	if err != nil {
+		return nil
+	}
+	var keyErr *knownhosts.KeyError
+	if !errors.As(check(addr, &net.TCPAddr{}, probe), &keyErr) {
+		return nil
+	}
+	var algos []string
+	for _, known := range keyErr.Want {
+		keyType := known.Key.Type()
+		if keyType == ssh.KeyAlgoRSA {
+			algos = append(algos, ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256)
+		}
+		algos = append(algos, keyType)
+	}
+	return algos
+}
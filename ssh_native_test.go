@@ -0,0 +1,310 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// testSSHServer is an in-process SSH server that runs exec requests with the
+// local sh against the fake GPU tools.
+type testSSHServer struct {
+	addr    string
+	hostKey ssh.Signer
+	tools   string
+	conns   atomic.Int32
+}
+
+func newTestSigner(t *testing.T) (ssh.Signer, []byte) {
+	t.Helper()
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	signer, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatalf("signer: %v", err)
+	}
+	block, err := ssh.MarshalPrivateKey(priv, "")
+	if err != nil {
+		t.Fatalf("marshal key: %v", err)
+	}
+	return signer, pem.EncodeToMemory(block)
+}
+
+func startTestSSHServer(t *testing.T, authorized ssh.PublicKey) *testSSHServer {
+	t.Helper()
+	hostKey, _ := newTestSigner(t)
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(_ ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if bytes.Equal(key.Marshal(), authorized.Marshal()) {
+				return nil, nil
+			}
+			return nil, errors.New("unauthorized key")
+		},
+	}
+	config.AddHostKey(hostKey)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	s := &testSSHServer{addr: ln.Addr().String(), hostKey: hostKey, tools: writeFakeGPUTools(t)}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			s.conns.Add(1)
+			go s.serve(conn, config)
+		}
+	}()
+	return s
+}
+
+func (s *testSSHServer) serve(conn net.Conn, config *ssh.ServerConfig) {
+	_, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+	for newCh := range chans {
+		if newCh.ChannelType() != "session" {
+			newCh.Reject(ssh.UnknownChannelType, "unsupported")
+			continue
+		}
+		ch, requests, err := newCh.Accept()
+		if err != nil {
+			continue
+		}
+		go func() {
+			defer ch.Close()
+			for req := range requests {
+				if req.Type != "exec" {
+					req.Reply(false, nil)
+					continue
+				}
+				var payload struct{ Command string }
+				ssh.Unmarshal(req.Payload, &payload)
+				req.Reply(true, nil)
+				cmd := exec.Command("sh", "-c", payload.Command)
+				cmd.Env = append(os.Environ(), "PATH="+s.tools+string(os.PathListSeparator)+os.Getenv("PATH"))
+				cmd.Stdin = ch
+				cmd.WaitDelay = time.Second
+				out, _ := cmd.CombinedOutput()
+				ch.Write(out)
+				status := uint32(0)
+				if cmd.ProcessState != nil {
+					status = uint32(cmd.ProcessState.ExitCode())
+				}
+				ch.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{status}))
+				return
+			}
+		}()
+	}
+}
+
+// writeSSHDir writes an identity file and a known_hosts entry for server.
+func writeSSHDir(t *testing.T, identity []byte, addr string, hostKey ssh.PublicKey) string {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "id_ed25519"), identity, 0o600); err != nil {
+		t.Fatalf("write identity: %v", err)
+	}
+	line := knownhosts.Line([]string{knownhosts.Normalize(addr)}, hostKey)
+	if err := os.WriteFile(filepath.Join(dir, "known_hosts"), []byte(line+"\n"), 0o600); err != nil {
+		t.Fatalf("write known_hosts: %v", err)
+	}
+	return dir
+}
+
+func newTestNativeTransport(sshDir string) *nativeTransport {
+	tr := newNativeTransport()
+	tr.sshDir = sshDir
+	tr.loadConfig = func() (*sshConfig, error) { return &sshConfig{}, nil }
+	tr.dialTimeout = 2 * time.Second
+	return tr
+}
+
+func splitTestAddr(t *testing.T, addr string) (string, int) {
+	t.Helper()
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		t.Fatalf("split addr: %v", err)
+	}
+	port, _ := strconv.Atoi(portStr)
+	return host, port
+}
+
+func TestNativeTransportQueriesGPUs(t *testing.T) {
+	t.Setenv("SSH_AUTH_SOCK", "")
+	clientKey, identity := newTestSigner(t)
+	server := startTestSSHServer(t, clientKey.PublicKey())
+	tr := newTestNativeTransport(writeSSHDir(t, identity, server.addr, server.hostKey.PublicKey()))
+	defer tr.close()
+
+	prev := currentTransport()
+	setSSHTransport(tr)
+	defer setSSHTransport(prev)
+
+	host, port := splitTestAddr(t, server.addr)
+	for i := 0; i < 3; i++ {
+		gpus, err := queryGPUs("tester@"+host, port)
+		if err != nil {
+			t.Fatalf("queryGPUs returned error: %v", err)
+		}
+		if len(gpus) != 1 || gpus[0].Util != 97 || gpus[0].UUID != "GPU-aaa" {
+			t.Fatalf("unexpected gpus: %+v", gpus)
+		}
+	}
+	if n := server.conns.Load(); n != 1 {
+		t.Fatalf("expected one pooled connection, got %d", n)
+	}
+
+	_, err := tr.run("tester@"+host, port, "nvidia-smi-missing", "")
+	if code, _ := classifyConnectionError(err); code != "nvidia_smi_missing" {
+		t.Fatalf("expected nvidia_smi_missing for %v, got %q", err, code)
+	}
+}
+
+func TestNativeTransportRedialsAfterTimeout(t *testing.T) {
+	t.Setenv("SSH_AUTH_SOCK", "")
+	clientKey, identity := newTestSigner(t)
+	server := startTestSSHServer(t, clientKey.PublicKey())
+	tr := newTestNativeTransport(writeSSHDir(t, identity, server.addr, server.hostKey.PublicKey()))
+	tr.commandTimeout = 200 * time.Millisecond
+	defer tr.close()
+
+	host, port := splitTestAddr(t, server.addr)
+	_, err := tr.run("tester@"+host, port, "sleep 1", "")
+	if code, _ := classifyConnectionError(err); code != "timeout" {
+		t.Fatalf("expected timeout for %v, got %q", err, code)
+	}
+	if _, err := tr.run("tester@"+host, port, "true", ""); err != nil {
+		t.Fatalf("run after timeout returned error: %v", err)
+	}
+	if n := server.conns.Load(); n != 2 {
+		t.Fatalf("expected a fresh connection after the timeout, got %d", n)
+	}
+}
+
+func TestNativeTransportTypedErrors(t *testing.T) {
+	t.Setenv("SSH_AUTH_SOCK", "")
+	clientKey, identity := newTestSigner(t)
+	server := startTestSSHServer(t, clientKey.PublicKey())
+	host, port := splitTestAddr(t, server.addr)
+	otherKey, otherIdentity := newTestSigner(t)
+
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	_, closedPort := splitTestAddr(t, closed.Addr().String())
+	closed.Close()
+
+	silent, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer silent.Close()
+	go func() {
+		for {
+			conn, err := silent.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+	_, silentPort := splitTestAddr(t, silent.Addr().String())
+
+	cases := []struct {
+		name   string
+		sshDir string
+		port   int
+		kind   sshErrorKind
+		code   string
+	}{
+		{"host key mismatch", writeSSHDir(t, identity, server.addr, otherKey.PublicKey()), port, sshErrHostKey, "host_key"},
+		{"wrong identity", writeSSHDir(t, otherIdentity, server.addr, server.hostKey.PublicKey()), port, sshErrAuth, "auth_failed"},
+		{"refused", writeSSHDir(t, identity, server.addr, server.hostKey.PublicKey()), closedPort, sshErrDial, "refused"},
+		{"handshake timeout", writeSSHDir(t, identity, server.addr, server.hostKey.PublicKey()), silentPort, sshErrTimeout, "timeout"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			tr := newTestNativeTransport(tc.sshDir)
+			tr.dialTimeout = 300 * time.Millisecond
+			defer tr.close()
+
+			_, err := tr.run("tester@"+host, tc.port, "nvidia-smi --query-gpu=index", "")
+			var sshErr *sshError
+			if !errors.As(err, &sshErr) {
+				t.Fatalf("expected *sshError, got %T: %v", err, err)
+			}
+			if sshErr.Kind != tc.kind {
+				t.Fatalf("expected kind %d, got %d (%v)", tc.kind, sshErr.Kind, err)
+			}
+			if code, _ := classifyConnectionError(err); code != tc.code {
+				t.Fatalf("expected code %q, got %q", tc.code, code)
+			}
+		})
+	}
+}
+
+func TestNativeTransportRouteUsesSSHConfig(t *testing.T) {
+	root, home := writeSSHConfig(t, map[string]string{
+		"config": `
+Host gpu
+    HostName 10.1.2.3
+    User alice
+    Port 2201
+    ProxyJump ops@bastion:2200,relay
+    IdentityFile ~/.ssh/id_gpu
+Host relay
+    HostName relay.example
+`,
+	})
+	tr := newTestNativeTransport(t.TempDir())
+	tr.loadConfig = func() (*sshConfig, error) { return loadSSHConfig(root, home) }
+
+	hops, err := tr.route("gpu", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hops) != 3 {
+		t.Fatalf("expected 3 hops, got %+v", hops)
+	}
+	if got := hopsKey(hops); got != "ops@bastion:2200,"+currentUserName()+"@relay.example:22,alice@10.1.2.3:2201" {
+		t.Fatalf("unexpected route %q", got)
+	}
+	if len(hops[2].identityFiles) != 1 || hops[2].identityFiles[0] != filepath.Join(home, ".ssh", "id_gpu") {
+		t.Fatalf("unexpected identity files %v", hops[2].identityFiles)
+	}
+	if hops, _ := tr.route("bob@gpu", 22); hops[2].key() != "bob@10.1.2.3:22" {
+		t.Fatalf("explicit user and port should win, got %q", hops[2].key())
+	}
+
+	// Edits to ~/.ssh/config apply from the next run, without a restart.
+	if err := os.WriteFile(root, []byte("Host gpu\n    HostName 10.9.9.9\n    User alice\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if hops, _ := tr.route("gpu", 0); len(hops) != 1 || hops[0].key() != "alice@10.9.9.9:22" {
+		t.Fatalf("expected the edited config, got %+v", hops)
+	}
+}
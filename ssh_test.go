@@ -1,10 +1,17 @@
 package main
 
-import "testing"
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+	"testing"
+)
 
 func TestParseOutputExtendedFields(t *testing.T) {
 	raw := "0, NVIDIA RTX 4090, 78, 66, 10240, 24576, 45, 210.3, 450.0, 550.54.14, 12.4"
-	gpus, err := parseOutput(raw, true)
+	gpus, err := parseOutput(raw, allGPUFieldNames[:11])
 	if err != nil {
 		t.Fatalf("parseOutput returned error: %v", err)
 	}
@@ -25,7 +32,7 @@ func TestParseOutputExtendedFields(t *testing.T) {
 
 func TestParseOutputWithNAFallbacks(t *testing.T) {
 	raw := "1, NVIDIA T4, 22, 55, 1024, 15360, N/A, N/A, 70.0, 535.12.01"
-	gpus, err := parseOutput(raw, false)
+	gpus, err := parseOutput(raw, allGPUFieldNames[:10])
 	if err != nil {
 		t.Fatalf("parseOutput returned error: %v", err)
 	}
@@ -44,31 +51,330 @@ func TestParseOutputWithNAFallbacks(t *testing.T) {
 	}
 }
 
+func TestParseOutputRichFields(t *testing.T) {
+	fields := []string{"index", "name", "utilization.gpu", "temperature.gpu", "memory.used", "memory.total",
+		"pci.bus_id", "pstate", "clocks.sm", "clocks.max.sm", "clocks_throttle_reasons.active",
+		"ecc.errors.uncorrected.volatile.total", "pcie.link.gen.current", "pcie.link.width.current",
+		"utilization.encoder", "memory.reserved", "mig.mode.current"}
+	raw := "0, NVIDIA H100, 88, 70, 60000, 81559, 00000000:1B:00.0, P0, 1755, 1980, 0x0000000000000044, 0, 5, 16, [N/A], 512, Disabled"
+	gpus, err := parseOutput(raw, fields)
+	if err != nil {
+		t.Fatalf("parseOutput returned error: %v", err)
+	}
+	gpu := gpus[0]
+	if gpu.PCIBusID != "00000000:1B:00.0" || gpu.PState != "P0" || gpu.MigMode != "Disabled" {
+		t.Fatalf("unexpected string fields: %+v", gpu)
+	}
+	if gpu.ClockSM != 1755 || gpu.ClockMaxSM != 1980 || gpu.EccUncorrected != 0 || gpu.PCIeGen != 5 || gpu.PCIeWidth != 16 || gpu.MemReserved != 512 {
+		t.Fatalf("unexpected numeric fields: %+v", gpu)
+	}
+	if gpu.EncoderUtil != -1 || gpu.ClockMem != -1 || gpu.FanSpeed != -1 {
+		t.Fatalf("expected unqueried and N/A fields to be -1: %+v", gpu)
+	}
+	if got := strings.Join(gpu.ThrottleReasons, ","); got != "sw_power_cap,hw_thermal_slowdown" {
+		t.Fatalf("unexpected throttle reasons %q", got)
+	}
+}
+
+func TestDropRejectedGPUFields(t *testing.T) {
+	fields := []string{"index", "name", "utilization.gpu", "temperature.gpu", "memory.used", "memory.total", "cuda_version", "pstate"}
+
+	got, ok := dropRejectedGPUFields(fields, `ssh: Field "cuda_version" is not a valid field to query.`)
+	if !ok || strings.Join(got, ",") != "index,name,utilization.gpu,temperature.gpu,memory.used,memory.total,pstate" {
+		t.Fatalf("unexpected fields after named rejection: %v %v", got, ok)
+	}
+	got, ok = dropRejectedGPUFields(fields, "ssh: Field is not a valid field to query.")
+	if !ok || len(got) != requiredGPUFieldCount {
+		t.Fatalf("expected only required fields, got %v %v", got, ok)
+	}
+	if _, ok := dropRejectedGPUFields(got, "ssh: Field is not a valid field to query."); ok {
+		t.Fatal("required fields must never be dropped")
+	}
+	if _, ok := dropRejectedGPUFields(fields, "ssh: Connection refused"); ok {
+		t.Fatal("unrelated errors must not drop fields")
+	}
+}
+
+// sshFailure is what the exec transport returns when ssh itself fails.
+func sshFailure(output string) error {
+	return &sshExitError{Status: sshTransportStatus, Output: output, Transport: true}
+}
+
 func TestClassifyConnectionError(t *testing.T) {
 	tests := []struct {
-		name string
-		err  string
-		code string
+		name      string
+		err       error
+		code      string
+		retryable bool
 	}{
-		{name: "auth", err: "ssh: Permission denied (publickey)", code: "auth_failed"},
-		{name: "host key", err: "ssh: Host key verification failed", code: "host_key"},
-		{name: "dns", err: "ssh: Could not resolve hostname foo", code: "dns"},
-		{name: "timeout", err: "ssh: Connection timed out", code: "timeout"},
-		{name: "refused", err: "ssh: connect to host foo port 22: Connection refused", code: "refused"},
-		{name: "nvidia", err: "ssh: bash: nvidia-smi: command not found", code: "nvidia_smi_missing"},
-		{name: "unknown", err: "ssh: unexpected", code: "unknown"},
+		{"auth", sshFailure("user@box: Permission denied (publickey)."), "auth_failed", false},
+		{"too many keys", sshFailure("Received disconnect from 10.0.0.5 port 22:2: Too many authentication failures\nDisconnected from 10.0.0.5 port 22"), "auth_too_many", false},
+		{"host key", sshFailure("Host key verification failed."), "host_key", false},
+		{"dns", sshFailure("ssh: Could not resolve hostname foo: Name or service not known"), "dns", true},
+		{"timeout", sshFailure("ssh: connect to host foo port 22: Connection timed out"), "timeout", true},
+		{"refused", sshFailure("ssh: connect to host foo port 22: Connection refused"), "refused", true},
+		{"reset", sshFailure("kex_exchange_identification: read: Connection reset by peer"), "reset", true},
+		{"no route", sshFailure("ssh: connect to host 10.9.0.4 port 22: No route to host"), "no_route", true},
+		{"jump auth", sshFailure("ops@bastion: Permission denied (publickey).\nConnection closed by UNKNOWN port 65535"), "jump_auth_failed", false},
+		{"jump dial", sshFailure("channel 0: open failed: connect failed: No route to host\nstdio forwarding failed"), "jump_failed", true},
+		// ssh exited 255 with text we do not know: still a transport failure.
+		{"transport", sshFailure("ssh: connect to host foo port 22: Connexion refusée"), "unreachable", true},
+		// 127 means command not found whatever the remote locale.
+		{"tool missing", &sshExitError{Status: 127, Output: "bash: nvidia-smi : commande introuvable"}, "nvidia_smi_missing", false},
+		{"section missing", &probeSectionError{Section: "gpu", Code: 127, Output: "sh: 1: nvidia-smi: not found"}, "nvidia_smi_missing", false},
+		{"driver", &probeSectionError{Section: "gpu", Code: 9, Output: "NVIDIA-SMI has failed because it couldn't communicate with the NVIDIA driver. Make sure that the latest NVIDIA driver is installed and running."}, "driver_failed", false},
+		{"mismatch", &sshExitError{Status: 18, Output: "Failed to initialize NVML: Driver/library version mismatch"}, "driver_failed", false},
+		{"remote", &sshExitError{Status: 2, Output: "Insufficient Permissions"}, "remote_failed", true},
+		// Over the native transport 255 is the remote command's own status.
+		{"native remote 255", &sshExitError{Status: sshTransportStatus, Output: "Connection refused"}, "remote_failed", true},
+		{"truncated", &probeSectionError{Section: "gpu", Code: -1, Output: "0, Tesla"}, "interrupted", true},
+		{"native reset", &sshError{Kind: sshErrDial, Addr: "box:22", Err: syscall.ECONNRESET}, "reset", true},
+		{"native jump auth", &sshError{Kind: sshErrAuth, Addr: "bastion:22", Jump: true, Err: testErr("unable to authenticate")}, "jump_auth_failed", false},
+		{"native jump", &sshError{Kind: sshErrDial, Addr: "bastion:22", Jump: true, Err: syscall.ECONNREFUSED}, "jump_failed", true},
+		{"unknown", testErr("ssh: unexpected"), "unknown", true},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, _ := classifyConnectionError(testErr(tt.err))
-			if got != tt.code {
-				t.Fatalf("expected code %q, got %q", tt.code, got)
+			e := classifyError(tt.err)
+			if e.Code != tt.code || e.Retryable != tt.retryable {
+				t.Fatalf("expected %q (retryable %v), got %q (retryable %v)", tt.code, tt.retryable, e.Code, e.Retryable)
+			}
+			if e.Message == "" {
+				t.Fatal("expected a user message")
 			}
 		})
 	}
+
+	if e := classifyError(&sshExitError{Status: 2, Output: "Insufficient Permissions\nmore"}); e.Message != "GPU query failed on remote host. Insufficient Permissions" {
+		t.Fatalf("unexpected remote failure message %q", e.Message)
+	}
+}
+
+func TestRetryDelayBacksOffNonRetryable(t *testing.T) {
+	if d := retryDelay(1, true); d != retrySchedule[0] {
+		t.Fatalf("expected %s, got %s", retrySchedule[0], d)
+	}
+	if d := retryDelay(100, true); d != retrySchedule[len(retrySchedule)-1] {
+		t.Fatalf("expected schedule to cap, got %s", d)
+	}
+	if d := retryDelay(1, false); d != nonRetryableDelay {
+		t.Fatalf("expected %s for a non-retryable error, got %s", nonRetryableDelay, d)
+	}
 }
 
 type testErr string
 
 func (e testErr) Error() string { return string(e) }
+
+func TestParseComputeAppsJoinsByUUID(t *testing.T) {
+	raw := "0, GPU-aaa\n1, GPU-bbb\n" + processSectionMarker + "\n" +
+		"GPU-bbb, 4242, python, 10240\n" +
+		"GPU-bbb, 4343, /usr/bin/my,app, 512\n"
+	uuids, procs, err := parseComputeApps(raw)
+	if err != nil {
+		t.Fatalf("parseComputeApps returned error: %v", err)
+	}
+	if len(procs) != 2 {
+		t.Fatalf("expected 2 processes, got %d", len(procs))
+	}
+	if procs[1].ProcessName != "/usr/bin/my,app" || procs[1].UsedMemory != 512 {
+		t.Fatalf("unexpected process with comma in name: %+v", procs[1])
+	}
+
+	applyProcessOwners(procs, parsePSOutput("  4242 alice    python train.py --epochs 10\n 4343 bob /usr/bin/my,app\n"))
+	gpus := []GPU{{Index: 0}, {Index: 1}}
+	joinGPUProcesses(gpus, uuids, procs)
+
+	if gpus[0].UUID != "GPU-aaa" || len(gpus[0].Processes) != 0 {
+		t.Fatalf("unexpected gpu 0: %+v", gpus[0])
+	}
+	if gpus[1].UUID != "GPU-bbb" || len(gpus[1].Processes) != 2 {
+		t.Fatalf("unexpected gpu 1: %+v", gpus[1])
+	}
+	if p := gpus[1].Processes[0]; p.User != "alice" || p.Command != "python train.py --epochs 10" {
+		t.Fatalf("unexpected process owner: %+v", p)
+	}
+}
+
+func TestParseComputeAppsNoProcesses(t *testing.T) {
+	raw := "0, GPU-aaa\n" + processSectionMarker + "\n"
+	uuids, procs, err := parseComputeApps(raw)
+	if err != nil {
+		t.Fatalf("parseComputeApps returned error: %v", err)
+	}
+	if len(procs) != 0 || uuids[0] != "GPU-aaa" {
+		t.Fatalf("unexpected result: %v %+v", uuids, procs)
+	}
+}
+
+// writeFakeGPUTools writes fake nvidia-smi and ps executables with canned
+// output into a new directory and returns it. nvidia-smi appends its
+// arguments to nvidia-smi.log there and, like older drivers, rejects
+// mig.mode.current.
+func writeFakeGPUTools(t *testing.T) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("fake GPU tools require a POSIX shell")
+	}
+	dir := t.TempDir()
+	nvidiaSMI := `#!/bin/sh
+echo "$@" >> "` + filepath.Join(dir, "nvidia-smi.log") + `"
+for arg; do
+  case "$arg" in
+  --query-gpu=*) fields=${arg#--query-gpu=} ;;
+  --query-compute-apps=pid) echo 100; exit 0 ;;
+  --query-compute-apps=*) echo "GPU-aaa, 100, python, 2048"; exit 0 ;;
+  esac
+done
+if [ -z "$fields" ]; then
+  echo "nvidia-smi: unsupported arguments: $*"
+  exit 2
+fi
+case ",$fields," in
+*,mig.mode.current,*)
+  echo 'Field "mig.mode.current" is not a valid field to query.'
+  exit 2
+  ;;
+esac
+line=""
+IFS=,
+for f in $fields; do
+  case "$f" in
+  index) v=0 ;;
+  uuid) v=GPU-aaa ;;
+  name) v="NVIDIA A100" ;;
+  utilization.gpu) v=97 ;;
+  temperature.gpu) v=71 ;;
+  memory.used) v=30000 ;;
+  memory.total) v=40960 ;;
+  power.draw) v=250.5 ;;
+  power.limit) v=400.0 ;;
+  driver_version) v=550.54.14 ;;
+  cuda_version) v=12.4 ;;
+  clocks.sm) v=1410 ;;
+  clocks_throttle_reasons.active) v=0x0000000000000004 ;;
+  pcie.link.gen.current) v=4 ;;
+  *) v="[N/A]" ;;
+  esac
+  line="$line${line:+, }$v"
+done
+echo "$line"
+`
+	ps := `#!/bin/sh
+echo "100 alice python train.py"
+`
+	for name, script := range map[string]string{"nvidia-smi": nvidiaSMI, "ps": ps} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(script), 0o755); err != nil {
+			t.Fatalf("write fake %s: %v", name, err)
+		}
+	}
+	return dir
+}
+
+// writeFakeSSH installs a fake ssh executable that records its arguments in
+// sshLog and runs the remote command locally, stdin included, against the
+// fake GPU tools. toolLog records every nvidia-smi invocation.
+func writeFakeSSH(t *testing.T) (sshLog, toolLog string) {
+	t.Helper()
+	tools := writeFakeGPUTools(t)
+	dir := t.TempDir()
+	sshLog = filepath.Join(dir, "args.log")
+	script := `#!/bin/sh
+echo "$@" >> "` + sshLog + `"
+case "$*" in
+*"-O exit"*) exit 0 ;;
+esac
+for last; do :; done
+PATH="` + tools + `:$PATH" exec sh -c "$last"
+`
+	path := filepath.Join(dir, "ssh")
+	if err := os.WriteFile(path, []byte(script), 0o755); err != nil {
+		t.Fatalf("write fake ssh: %v", err)
+	}
+
+	prevBinary, prevMux, prevFields, prevCollectors := sshBinary, sshMux, gpuFieldsCache, gpuCollectorsCache
+	sshBinary = path
+	sshMux = &sshMultiplexer{dir: filepath.Join(dir, "cm"), targets: map[muxTarget]bool{}}
+	gpuFieldsCache = &gpuFieldCache{fields: map[string][]string{}}
+	gpuCollectorsCache = &gpuCollectorCache{collectors: map[string]gpuCollector{}}
+	t.Cleanup(func() {
+		sshBinary, sshMux, gpuFieldsCache, gpuCollectorsCache = prevBinary, prevMux, prevFields, prevCollectors
+	})
+	return sshLog, filepath.Join(tools, "nvidia-smi.log")
+}
+
+func readLogLines(t *testing.T, path string) []string {
+	t.Helper()
+	logged, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read %s: %v", path, err)
+	}
+	return strings.Split(strings.TrimSpace(string(logged)), "\n")
+}
+
+func TestQueryGPUsAgainstFakeSSH(t *testing.T) {
+	sshLog, toolLog := writeFakeSSH(t)
+
+	gpus, err := queryGPUs("gpu-box", 2222)
+	if err != nil {
+		t.Fatalf("queryGPUs returned error: %v", err)
+	}
+	if len(gpus) != 1 || gpus[0].Util != 97 || gpus[0].CudaVersion != "12.4" || gpus[0].UUID != "GPU-aaa" {
+		t.Fatalf("unexpected gpus: %+v", gpus)
+	}
+	if len(gpus[0].Processes) != 1 || gpus[0].Processes[0].User != "alice" {
+		t.Fatalf("unexpected processes: %+v", gpus[0].Processes)
+	}
+	if gpus[0].ClockSM != 1410 || gpus[0].PCIeGen != 4 || gpus[0].EncoderUtil != -1 || gpus[0].MigMode != "" ||
+		strings.Join(gpus[0].ThrottleReasons, ",") != "sw_power_cap" {
+		t.Fatalf("unexpected rich fields: %+v", gpus[0])
+	}
+	if got := gpuFieldsCache.get("gpu-box:2222"); len(got) != len(allGPUFieldNames)-1 {
+		t.Fatalf("expected the rejected field to be cached away, got %v", got)
+	}
+
+	// The rejected field is remembered, so the next poll probes once.
+	if _, err := queryGPUs("gpu-box", 2222); err != nil {
+		t.Fatalf("second queryGPUs returned error: %v", err)
+	}
+
+	if n := strings.Count(strings.Join(readLogLines(t, toolLog), "\n"), "mig.mode.current"); n != 1 {
+		t.Fatalf("expected one query with the rejected field, got %d", n)
+	}
+	lines := readLogLines(t, sshLog)
+	if len(lines) != 3 {
+		t.Fatalf("expected a retried first poll and a single-probe second poll, got %d ssh runs", len(lines))
+	}
+	for _, line := range lines {
+		for _, want := range []string{"ControlMaster=auto", "ControlPath=", "ControlPersist=", "-p 2222 gpu-box sh -s"} {
+			if !strings.Contains(line, want) {
+				t.Fatalf("expected %q in ssh invocation %q", want, line)
+			}
+		}
+	}
+}
+
+func TestSSHMultiplexerCloseAll(t *testing.T) {
+	argsLog, _ := writeFakeSSH(t)
+
+	for _, port := range []int{0, 2222} {
+		if _, err := runSSHCommand("gpu-box", port, "true"); err != nil {
+			t.Fatalf("runSSHCommand returned error: %v", err)
+		}
+	}
+	sshMux.closeAll()
+
+	logged, err := os.ReadFile(argsLog)
+	if err != nil {
+		t.Fatalf("read args log: %v", err)
+	}
+	for _, want := range []string{"-O exit gpu-box", "-O exit -p 2222 gpu-box"} {
+		if !strings.Contains(string(logged), want) {
+			t.Fatalf("expected master exit request %q, got %q", want, logged)
+		}
+	}
+	if len(sshMux.targets) != 0 {
+		t.Fatalf("expected targets to be cleared, got %v", sshMux.targets)
+	}
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// configSchemaVersion is the current on-disk schema of config.json. Bump it
+// together with a new entry in configMigrations.
+const configSchemaVersion = 1
+
+// appConfig is the persisted backend configuration.
+type appConfig struct {
+	Version         int                 `json:"version"`
+	ActiveProfileID string              `json:"activeProfileId"`
+	Profiles        []ConnectionProfile `json:"profiles"`
+
+	// SSHTransport selects "exec" (system ssh, the default) or "native".
+	SSHTransport    string                `json:"sshTransport"`
+	MetricsExporter MetricsExporterConfig `json:"metricsExporter"`
+	// AlertRules is nil until the user edits rules; defaults apply until then.
+	AlertRules []AlertRule    `json:"alertRules"`
+	Recorder   RecorderConfig `json:"recorder"`
+	// DisplayMode is the tray display mode; empty means defaultTrayMode.
+	DisplayMode string `json:"displayMode"`
+	// Notifications is nil until the user changes them; defaults apply
+	// until then.
+	Notifications *NotificationConfig `json:"notifications"`
+	Webhooks      []WebhookConfig     `json:"webhooks"`
+}
+
+// configMigrations[n] upgrades a raw document from schema version n to n+1.
+// Migrations operate on decoded JSON so old field shapes never need a Go type.
+var configMigrations = []func(doc map[string]interface{}) error{
+	migrateConfigV0ToV1,
+}
+
+// configStore owns config.json. Writes are atomic (temp file + rename) so a
+// crash mid-save never leaves a truncated file behind. An empty path keeps
+// the config in memory only.
+type configStore struct {
+	mu   sync.Mutex
+	path string
+	cfg  appConfig
+
+	// saveMu is held from marshalling through the rename, so concurrent
+	// saves reach the disk in the order they read the config.
+	saveMu sync.Mutex
+
+	// readOnly is set when the file on disk was written by a newer build;
+	// we never overwrite data we cannot represent.
+	readOnly bool
+}
+
+func newConfigStore(path string) *configStore {
+	return &configStore{
+		path: path,
+		cfg:  appConfig{Version: configSchemaVersion, Profiles: []ConnectionProfile{}},
+	}
+}
+
+func defaultConfigPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "NVSmiBar", "config.json"), nil
+}
+
+// load reads and migrates the config file. A missing file is not an error.
+func (s *configStore) load() error {
+	if s.path == "" {
+		return nil
+	}
+	raw, err := os.ReadFile(s.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	cfg, migrated, err := decodeConfig(raw)
+	if err != nil {
+		if _, ok := err.(*configVersionError); ok {
+			s.mu.Lock()
+			s.readOnly = true
+			s.mu.Unlock()
+		}
+		return err
+	}
+
+	s.mu.Lock()
+	s.cfg = cfg
+	s.mu.Unlock()
+
+	if migrated {
+		return s.save()
+	}
+	return nil
+}
+
+type configVersionError struct {
+	version int
+}
+
+func (e *configVersionError) Error() string {
+	return fmt.Sprintf("config schema version %d is newer than supported version %d", e.version, configSchemaVersion)
+}
+
+// decodeConfig migrates raw to the current schema and reports whether any
+// migration ran.
+func decodeConfig(raw []byte) (appConfig, bool, error) {
+	var doc map[string]interface{}
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return appConfig{}, false, fmt.Errorf("parse config: %w", err)
+	}
+
+	version := 0
+	if v, ok := doc["version"].(float64); ok {
+		version = int(v)
+	}
+	if version > configSchemaVersion {
+		return appConfig{}, false, &configVersionError{version: version}
+	}
+
+	migrated := false
+	for ; version < configSchemaVersion; version++ {
+		if err := configMigrations[version](doc); err != nil {
+			return appConfig{}, false, fmt.Errorf("migrate config v%d: %w", version, err)
+		}
+		doc["version"] = float64(version + 1)
+		migrated = true
+	}
+
+	normalized, err := json.Marshal(doc)
+	if err != nil {
+		return appConfig{}, false, err
+	}
+	var cfg appConfig
+	if err := json.Unmarshal(normalized, &cfg); err != nil {
+		return appConfig{}, false, fmt.Errorf("decode config: %w", err)
+	}
+	if cfg.Profiles == nil {
+		cfg.Profiles = []ConnectionProfile{}
+	}
+	return cfg, migrated, nil
+}
+
+// migrateConfigV0ToV1 converts the profile shape the frontend kept in
+// localStorage (nullable lastUsedAt, optional error fields, implicit port)
+// into the first Go-side schema.
+func migrateConfigV0ToV1(doc map[string]interface{}) error {
+	profiles, _ := doc["profiles"].([]interface{})
+	kept := make([]interface{}, 0, len(profiles))
+	for _, item := range profiles {
+		p, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if id, _ := p["id"].(string); id == "" {
+			continue
+		}
+		if p["lastUsedAt"] == nil {
+			p["lastUsedAt"] = float64(0)
+		}
+		if port, _ := p["port"].(float64); port <= 0 {
+			p["port"] = float64(22)
+		}
+		if source, _ := p["source"].(string); source == "" {
+			p["source"] = "manual"
+		}
+		if status, _ := p["lastTestStatus"].(string); status == "" {
+			p["lastTestStatus"] = "never"
+		}
+		if name, _ := p["name"].(string); name == "" {
+			p["name"] = p["target"]
+		}
+		kept = append(kept, p)
+	}
+	doc["profiles"] = kept
+	if _, ok := doc["activeProfileId"].(string); !ok {
+		doc["activeProfileId"] = ""
+	}
+	return nil
+}
+
+var errConfigReadOnly = errors.New("config was written by a newer version of NVSmiBar; refusing to overwrite")
+
+// save writes the config atomically.
+func (s *configStore) save() error {
+	s.saveMu.Lock()
+	defer s.saveMu.Unlock()
+	s.mu.Lock()
+	if s.readOnly {
+		s.mu.Unlock()
+		return errConfigReadOnly
+	}
+	cfg := s.cfg
+	path := s.path
+	data, err := json.MarshalIndent(cfg, "", "  ")
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	if path == "" {
+		return nil
+	}
+	return writeFileAtomic(path, append(data, '\n'), 0o600)
+}
+
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+	defer os.Remove(tmpName)
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmpName, perm); err != nil {
+		return err
+	}
+	return os.Rename(tmpName, path)
+}
+
+// update applies fn to the config under lock and persists the result. A
+// read-only store is left untouched, so memory never runs ahead of disk.
+func (s *configStore) update(fn func(cfg *appConfig)) error {
+	s.mu.Lock()
+	if s.readOnly {
+		s.mu.Unlock()
+		return errConfigReadOnly
+	}
+	fn(&s.cfg)
+	s.mu.Unlock()
+	return s.save()
+}
+
+// snapshot returns a copy of the current config.
+func (s *configStore) snapshot() appConfig {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cfg := s.cfg
+	cfg.Profiles = append([]ConnectionProfile{}, s.cfg.Profiles...)
+	return cfg
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestConfigStoreRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "NVSmiBar", "config.json")
+	store := newConfigStore(path)
+	err := store.update(func(cfg *appConfig) {
+		cfg.ActiveProfileID = "conn_1"
+		cfg.Profiles = append(cfg.Profiles, ConnectionProfile{ID: "conn_1", Name: "box", Target: "box", Port: 22})
+	})
+	if err != nil {
+		t.Fatalf("update returned error: %v", err)
+	}
+
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		t.Fatalf("read config dir: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "config.json" {
+		t.Fatalf("expected only config.json after atomic write, got %v", entries)
+	}
+
+	loaded := newConfigStore(path)
+	if err := loaded.load(); err != nil {
+		t.Fatalf("load returned error: %v", err)
+	}
+	cfg := loaded.snapshot()
+	if cfg.Version != configSchemaVersion || cfg.ActiveProfileID != "conn_1" || len(cfg.Profiles) != 1 {
+		t.Fatalf("unexpected config after reload: %+v", cfg)
+	}
+}
+
+func TestConfigStoreMigratesLegacyDocument(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	legacy := `{"profiles":[
+		{"id":"conn_a","name":"","target":"alice@box","port":0,"source":"","lastUsedAt":null,"lastTestStatus":""},
+		{"name":"missing id","target":"nowhere"}
+	]}`
+	if err := os.WriteFile(path, []byte(legacy), 0o600); err != nil {
+		t.Fatalf("write legacy config: %v", err)
+	}
+
+	store := newConfigStore(path)
+	if err := store.load(); err != nil {
+		t.Fatalf("load returned error: %v", err)
+	}
+	cfg := store.snapshot()
+	if len(cfg.Profiles) != 1 {
+		t.Fatalf("expected 1 migrated profile, got %+v", cfg.Profiles)
+	}
+	p := cfg.Profiles[0]
+	if p.Name != "alice@box" || p.Port != 22 || p.Source != "manual" || p.LastTestStatus != "never" || p.LastUsedAt != 0 {
+		t.Fatalf("unexpected migrated profile: %+v", p)
+	}
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read migrated config: %v", err)
+	}
+	if !strings.Contains(string(raw), `"version": 1`) {
+		t.Fatalf("expected migrated file to be rewritten with version, got %s", raw)
+	}
+}
+
+func TestConfigStoreRefusesNewerSchema(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	future := `{"version": 99, "profiles": []}`
+	if err := os.WriteFile(path, []byte(future), 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+
+	store := newConfigStore(path)
+	if err := store.load(); err == nil {
+		t.Fatal("expected error loading newer schema")
+	}
+	if err := store.update(func(cfg *appConfig) { cfg.ActiveProfileID = "x" }); err == nil {
+		t.Fatal("expected save to be refused")
+	}
+	if got := store.snapshot().ActiveProfileID; got != "" {
+		t.Fatalf("refused update still changed the config in memory: %q", got)
+	}
+	raw, _ := os.ReadFile(path)
+	if string(raw) != future {
+		t.Fatalf("newer config was overwritten: %s", raw)
+	}
+}
+
+func TestConfigStoreConcurrentUpdatesLandInOrder(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	store := newConfigStore(path)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			id := fmt.Sprintf("p%d", i)
+			if err := store.update(func(cfg *appConfig) {
+				cfg.Profiles = append(cfg.Profiles, ConnectionProfile{ID: id, Target: id})
+			}); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	reloaded := newConfigStore(path)
+	if err := reloaded.load(); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(reloaded.snapshot().Profiles); n != 20 {
+		t.Fatalf("expected the last save on disk with 20 profiles, got %d", n)
+	}
+}
+
+func TestProfileBindings(t *testing.T) {
+	a, _ := newTestApp(func(target string, port int) ([]GPU, error) {
+		return []GPU{}, nil
+	})
+	defer stopTestWorkers(a)
+
+	saved, err := a.SaveProfile(ConnectionProfile{Target: " box "})
+	if err != nil {
+		t.Fatalf("SaveProfile returned error: %v", err)
+	}
+	if saved.ID == "" || saved.Target != "box" || saved.Port != 22 {
+		t.Fatalf("unexpected saved profile: %+v", saved)
+	}
+
+	if err := a.SetActiveProfile(saved.ID); err != nil {
+		t.Fatalf("SetActiveProfile returned error: %v", err)
+	}
+	if a.GetActiveProfileID() != saved.ID {
+		t.Fatalf("expected active profile %q", saved.ID)
+	}
+	if snaps := a.GetConnectionSnapshots(); len(snaps) != 1 || snaps[0].ID != saved.ID {
+		t.Fatalf("expected active profile to be watched, got %+v", snaps)
+	}
+
+	n, err := a.ImportLegacyProfiles(`[{"id":"`+saved.ID+`","target":"dup"},{"id":"conn_legacy","target":"old","lastUsedAt":null}]`, "")
+	if err != nil || n != 1 {
+		t.Fatalf("ImportLegacyProfiles = %d, %v", n, err)
+	}
+	if len(a.ListProfiles()) != 2 {
+		t.Fatalf("expected 2 profiles, got %+v", a.ListProfiles())
+	}
+
+	// Switching profiles only changes which one is shown; both keep polling.
+	if err := a.SetActiveProfile("conn_legacy"); err != nil {
+		t.Fatal(err)
+	}
+	if snaps := a.GetConnectionSnapshots(); len(snaps) != 2 {
+		t.Fatalf("expected every saved profile to be watched, got %+v", snaps)
+	}
+
+	if err := a.DeleteProfile("conn_legacy"); err != nil {
+		t.Fatalf("DeleteProfile returned error: %v", err)
+	}
+	if snaps := a.GetConnectionSnapshots(); a.GetActiveProfileID() != "" || len(snaps) != 1 || snaps[0].ID != saved.ID {
+		t.Fatalf("deleting a profile should stop polling only it, got %+v", snaps)
+	}
+}
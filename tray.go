@@ -0,0 +1,109 @@
+package main
+
+import "image"
+
+// trayBackend is a platform status area integration (macOS menu bar, Linux
+// StatusNotifierItem). Methods may be called from any goroutine.
+type trayBackend interface {
+	// run installs the tray item; onClick fires on primary activation.
+	run(onClick func()) error
+	setTitle(title string)
+	// setImage shows a rendered tray image; text is the same content for
+	// trays that can only show text.
+	setImage(img *image.RGBA, text string)
+	// appearance reports the pixel density and whether the tray background
+	// is dark, so images can be rendered to match.
+	appearance() (scale int, dark bool)
+	// statusItemRightX is the screen X of the item's right edge, or -1 when
+	// the platform cannot tell.
+	statusItemRightX() int
+	close()
+}
+
+var tray trayBackend = newPlatformTray()
+
+// trayRun installs the platform tray item. Must be called from a goroutine
+// (not the main thread) after Wails has started.
+func trayRun(a *App) {
+	if err := tray.run(a.HandleTrayClick); err != nil {
+		println("tray:", err.Error())
+	}
+}
+
+// defaultTrayMode is the display mode used until the user picks one.
+const defaultTrayMode = "graphic"
+
+// trayModeLayout returns the layout for a display mode, falling back to the
+// default for unknown modes.
+func trayModeLayout(mode string) trayLayout {
+	if l, ok := trayLayouts[mode]; ok {
+		return l
+	}
+	return trayLayouts[defaultTrayMode]
+}
+
+// formatTrayTitle is the text shown for a connection status in mode.
+func formatTrayTitle(gpus []GPU, status string, mode string, history []float64) string {
+	switch status {
+	case "idle":
+		return "NVSmiBar"
+	case "connecting":
+		return "NV ···"
+	case "error":
+		return "NV ⚠"
+	}
+	return renderTrayText(trayModeLayout(mode), status, gpus, history)
+}
+
+// showTray draws gpus in mode for live and stale data, and a short status
+// title otherwise. history feeds the layout's sparkline, oldest first.
+func showTray(mode string, status string, gpus []GPU, history []float64) {
+	title := formatTrayTitle(gpus, status, mode, history)
+	if len(gpus) == 0 || (status != "live" && status != "stale") {
+		tray.setTitle(title)
+		return
+	}
+	scale, dark := tray.appearance()
+	theme := trayThemeLight
+	if dark {
+		theme = trayThemeDark
+	}
+	tray.setImage(renderTrayImage(trayModeLayout(mode), status, gpus, history, theme, scale), title)
+}
+
+// sparkValue is a history point's reading of a sparkline metric, as the
+// 0-100 level the sparkline draws.
+func sparkValue(p HistoryPoint, m trayMetric) float64 {
+	switch m {
+	case trayMetricTemp:
+		return p.Temp
+	case trayMetricMem, trayMetricMemTotal:
+		if p.MemTotal > 0 {
+			return p.MemUsed / p.MemTotal * 100
+		}
+	case trayMetricPower:
+		if p.PowerLimit > 0 {
+			return p.PowerDraw / p.PowerLimit * 100
+		}
+	default:
+		return p.Util
+	}
+	return -1
+}
+
+// getStatusItemRightX returns the right edge X coordinate (screen coords) of
+// the tray item, used to anchor the popup window below the icon.
+func getStatusItemRightX() int {
+	return tray.statusItemRightX()
+}
+
+// noopTray is used where no tray is available; the app stays usable through
+// its window and CLI.
+type noopTray struct{}
+
+func (noopTray) run(onClick func()) error              { return nil }
+func (noopTray) setTitle(title string)                 {}
+func (noopTray) setImage(img *image.RGBA, text string) {}
+func (noopTray) appearance() (int, bool)               { return 1, true }
+func (noopTray) statusItemRightX() int                 { return -1 }
+func (noopTray) close()                                {}
@@ -8,52 +8,81 @@ package main
 extern void nvSmiBarSetupTray(void);
 extern void nvSmiBarSetTitle(const char *title);
 extern double nvSmiBarGetButtonRightX(void);
-extern void nvSmiBarSetGPUStatus(int temp, int util, int memUsedMiB, int memTotalMiB, const char *status);
+extern void nvSmiBarSetImage(const void *png, int length, double scale);
+extern int nvSmiBarMenuBarIsDark(void);
 */
 import "C"
-import "unsafe"
+import (
+	"image"
+	"sync"
+	"unsafe"
+)
 
-var gApp *App
+var (
+	trayClickMu sync.Mutex
+	trayOnClick func()
+)
 
 // goStatusItemClicked is called from ObjC on the main thread when the status
 // item button is clicked. We dispatch to a goroutine so we don't block the main thread.
 //
 //export goStatusItemClicked
 func goStatusItemClicked() {
-	go func() {
-		if gApp != nil {
-			gApp.HandleTrayClick()
-		}
-	}()
+	trayClickMu.Lock()
+	onClick := trayOnClick
+	trayClickMu.Unlock()
+	if onClick != nil {
+		go onClick()
+	}
 }
 
-// trayRun sets up the native macOS menu-bar status item.
-// Must be called from a goroutine (not the main thread) after Wails has started.
-func trayRun(a *App) {
-	gApp = a
+// darwinTray is the native macOS menu-bar status item.
+type darwinTray struct{}
+
+func newPlatformTray() trayBackend {
+	return darwinTray{}
+}
+
+func (darwinTray) run(onClick func()) error {
+	trayClickMu.Lock()
+	trayOnClick = onClick
+	trayClickMu.Unlock()
 	C.nvSmiBarSetupTray()
+	return nil
 }
 
-// setTrayTitle updates the status item button title (shown in the menu bar).
-func setTrayTitle(title string) {
+// setTitle updates the status item button title (shown in the menu bar).
+func (darwinTray) setTitle(title string) {
 	cs := C.CString(title)
 	defer C.free(unsafe.Pointer(cs))
 	C.nvSmiBarSetTitle(cs)
 }
 
-// setTrayGPUStatus renders GPU metrics as a two-line NSImage in the menu bar.
-func setTrayGPUStatus(temp, util, memUsedMiB, memTotalMiB int, status string) {
-	cs := C.CString(status)
-	defer C.free(unsafe.Pointer(cs))
-	C.nvSmiBarSetGPUStatus(C.int(temp), C.int(util), C.int(memUsedMiB), C.int(memTotalMiB), cs)
+// darwinTrayScale is the pixel density images are rendered at; AppKit
+// downsamples on non-Retina displays.
+const darwinTrayScale = 2
+
+// setImage shows img as the status item image.
+func (darwinTray) setImage(img *image.RGBA, text string) {
+	data, err := encodeTrayPNG(img)
+	if err != nil || len(data) == 0 {
+		return
+	}
+	buf := C.CBytes(data)
+	defer C.free(buf)
+	C.nvSmiBarSetImage(buf, C.int(len(data)), C.double(darwinTrayScale))
 }
 
-// getStatusItemRightX returns the right edge X coordinate (screen coords) of
-// the status item button, used to anchor the popup window below the icon.
-func getStatusItemRightX() int {
+func (darwinTray) appearance() (int, bool) {
+	return darwinTrayScale, C.nvSmiBarMenuBarIsDark() != 0
+}
+
+func (darwinTray) statusItemRightX() int {
 	x := float64(C.nvSmiBarGetButtonRightX())
 	if x < 0 {
 		return -1
 	}
 	return int(x)
 }
+
+func (darwinTray) close() {}
@@ -0,0 +1,290 @@
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"os"
+	"sync"
+
+	"github.com/godbus/dbus/v5"
+)
+
+const (
+	sniPath        = dbus.ObjectPath("/StatusNotifierItem")
+	sniInterface   = "org.kde.StatusNotifierItem"
+	sniWatcherName = "org.kde.StatusNotifierWatcher"
+	sniWatcherPath = dbus.ObjectPath("/StatusNotifierWatcher")
+	dbusPropsIface = "org.freedesktop.DBus.Properties"
+)
+
+// sniBus is the part of a session bus connection the tray and notifier use,
+// so tests can run against a stand-in instead of a real bus.
+type sniBus interface {
+	Export(v interface{}, path dbus.ObjectPath, iface string) error
+	RequestName(name string, flags dbus.RequestNameFlags) (dbus.RequestNameReply, error)
+	Emit(path dbus.ObjectPath, name string, values ...interface{}) error
+	Call(dest string, path dbus.ObjectPath, method string, args ...interface{}) error
+	Close() error
+}
+
+type sessionBus struct {
+	*dbus.Conn
+}
+
+func (b sessionBus) Call(dest string, path dbus.ObjectPath, method string, args ...interface{}) error {
+	return b.Object(dest, path).Call(method, 0, args...).Err
+}
+
+func connectSessionBus() (sniBus, error) {
+	conn, err := dbus.ConnectSessionBus()
+	if err != nil {
+		return nil, err
+	}
+	return sessionBus{conn}, nil
+}
+
+// sniPixmap is one ARGB32 icon image in network byte order.
+type sniPixmap struct {
+	Width  int32
+	Height int32
+	Data   []byte
+}
+
+type sniToolTip struct {
+	IconName   string
+	IconPixmap []sniPixmap
+	Title      string
+	Text       string
+}
+
+// linuxTray publishes a StatusNotifierItem, shown by KDE Plasma and by GNOME
+// with the AppIndicator extension. The rendered tray image is the item's
+// icon; the Ayatana label extension and the tooltip carry the same values as
+// text for panels that shrink the icon.
+type linuxTray struct {
+	connect func() (sniBus, error)
+
+	mu      sync.Mutex
+	bus     sniBus
+	onClick func()
+	props   map[string]dbus.Variant
+	clickX  int
+}
+
+func newPlatformTray() trayBackend {
+	return newLinuxTray(connectSessionBus)
+}
+
+func newLinuxTray(connect func() (sniBus, error)) *linuxTray {
+	return &linuxTray{
+		connect: connect,
+		clickX:  -1,
+		props: map[string]dbus.Variant{
+			"Category":           dbus.MakeVariant("ApplicationStatus"),
+			"Id":                 dbus.MakeVariant("nvsmibar"),
+			"Title":              dbus.MakeVariant("NVSmiBar"),
+			"Status":             dbus.MakeVariant("Active"),
+			"IconName":           dbus.MakeVariant("utilities-system-monitor"),
+			"IconPixmap":         dbus.MakeVariant([]sniPixmap{}),
+			"ToolTip":            dbus.MakeVariant(sniToolTip{Title: "NVSmiBar", IconPixmap: []sniPixmap{}}),
+			"ItemIsMenu":         dbus.MakeVariant(false),
+			"Menu":               dbus.MakeVariant(dbus.ObjectPath("/NO_DBUSMENU")),
+			"XAyatanaLabel":      dbus.MakeVariant("NVSmiBar"),
+			"XAyatanaLabelGuide": dbus.MakeVariant(""),
+		},
+	}
+}
+
+func (t *linuxTray) run(onClick func()) error {
+	bus, err := t.connect()
+	if err != nil {
+		return fmt.Errorf("connect session bus: %w", err)
+	}
+	if err := bus.Export(sniItem{t}, sniPath, sniInterface); err != nil {
+		bus.Close()
+		return err
+	}
+	if err := bus.Export(sniProperties{t}, sniPath, dbusPropsIface); err != nil {
+		bus.Close()
+		return err
+	}
+	name := fmt.Sprintf("org.kde.StatusNotifierItem-%d-1", os.Getpid())
+	reply, err := bus.RequestName(name, dbus.NameFlagDoNotQueue)
+	if err != nil {
+		bus.Close()
+		return fmt.Errorf("request bus name %s: %w", name, err)
+	}
+	if reply != dbus.RequestNameReplyPrimaryOwner {
+		bus.Close()
+		return fmt.Errorf("request bus name %s: not the primary owner (reply %d)", name, reply)
+	}
+	if err := bus.Call(sniWatcherName, sniWatcherPath, sniWatcherName+".RegisterStatusNotifierItem", name); err != nil {
+		bus.Close()
+		return fmt.Errorf("no StatusNotifierWatcher on the session bus (is an AppIndicator extension enabled?): %w", err)
+	}
+
+	t.mu.Lock()
+	t.bus = bus
+	t.onClick = onClick
+	t.mu.Unlock()
+	return nil
+}
+
+func (t *linuxTray) setTitle(title string) {
+	t.setIcon(nil)
+	status := "Active"
+	if title == "NV ⚠" {
+		status = "NeedsAttention"
+	}
+	t.setLabel(title, status)
+}
+
+// setImage exports the rendered image as the item's IconPixmap. Panels that
+// scale icons to a square may make a wide image hard to read, so the text
+// form also goes to the label and tooltip.
+func (t *linuxTray) setImage(img *image.RGBA, text string) {
+	var pixmaps []sniPixmap
+	if img != nil {
+		pixmaps = []sniPixmap{rgbaToSNIPixmap(img)}
+	}
+	t.setIcon(pixmaps)
+	t.setLabel(text, "Active")
+}
+
+// setIcon replaces IconPixmap; an empty list falls back to IconName.
+func (t *linuxTray) setIcon(pixmaps []sniPixmap) {
+	if pixmaps == nil {
+		pixmaps = []sniPixmap{}
+	}
+	t.mu.Lock()
+	bus := t.bus
+	prev, _ := t.props["IconPixmap"].Value().([]sniPixmap)
+	changed := len(prev) > 0 || len(pixmaps) > 0
+	t.props["IconPixmap"] = dbus.MakeVariant(pixmaps)
+	t.mu.Unlock()
+	if bus != nil && changed {
+		_ = bus.Emit(sniPath, sniInterface+".NewIcon")
+	}
+}
+
+// rgbaToSNIPixmap converts img to SNI's ARGB32 in network byte order, with
+// straight rather than premultiplied alpha.
+func rgbaToSNIPixmap(img *image.RGBA) sniPixmap {
+	b := img.Bounds()
+	data := make([]byte, 0, b.Dx()*b.Dy()*4)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := color.NRGBAModel.Convert(img.RGBAAt(x, y)).(color.NRGBA)
+			data = append(data, c.A, c.R, c.G, c.B)
+		}
+	}
+	return sniPixmap{Width: int32(b.Dx()), Height: int32(b.Dy()), Data: data}
+}
+
+func (t *linuxTray) appearance() (int, bool) {
+	return 1, true
+}
+
+func (t *linuxTray) setLabel(label string, status string) {
+	t.mu.Lock()
+	bus := t.bus
+	statusChanged := t.props["Status"].Value() != status
+	t.props["XAyatanaLabel"] = dbus.MakeVariant(label)
+	t.props["ToolTip"] = dbus.MakeVariant(sniToolTip{Title: "NVSmiBar", Text: label, IconPixmap: []sniPixmap{}})
+	t.props["Status"] = dbus.MakeVariant(status)
+	t.mu.Unlock()
+	if bus == nil {
+		return
+	}
+	_ = bus.Emit(sniPath, sniInterface+".XAyatanaNewLabel", label, "")
+	_ = bus.Emit(sniPath, sniInterface+".NewToolTip")
+	if statusChanged {
+		_ = bus.Emit(sniPath, sniInterface+".NewStatus", status)
+	}
+}
+
+// statusItemRightX returns the X of the last click. SNI does not expose the
+// item's geometry, but Activate carries the pointer position.
+func (t *linuxTray) statusItemRightX() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.clickX
+}
+
+func (t *linuxTray) close() {
+	t.mu.Lock()
+	bus := t.bus
+	t.bus = nil
+	t.mu.Unlock()
+	if bus != nil {
+		bus.Close()
+	}
+}
+
+// sniItem implements the org.kde.StatusNotifierItem methods.
+type sniItem struct {
+	t *linuxTray
+}
+
+func (s sniItem) Activate(x, y int32) *dbus.Error {
+	s.t.mu.Lock()
+	s.t.clickX = int(x)
+	onClick := s.t.onClick
+	s.t.mu.Unlock()
+	if onClick != nil {
+		go onClick()
+	}
+	return nil
+}
+
+// SecondaryActivate (middle click) behaves like a normal click.
+func (s sniItem) SecondaryActivate(x, y int32) *dbus.Error {
+	return s.Activate(x, y)
+}
+
+// ContextMenu opens the popup too; there is no separate menu.
+func (s sniItem) ContextMenu(x, y int32) *dbus.Error {
+	return s.Activate(x, y)
+}
+
+func (s sniItem) Scroll(delta int32, orientation string) *dbus.Error {
+	return nil
+}
+
+// sniProperties implements org.freedesktop.DBus.Properties for the item.
+type sniProperties struct {
+	t *linuxTray
+}
+
+func (p sniProperties) Get(iface, name string) (dbus.Variant, *dbus.Error) {
+	if iface != sniInterface {
+		return dbus.Variant{}, dbus.MakeFailedError(fmt.Errorf("unknown interface %s", iface))
+	}
+	p.t.mu.Lock()
+	defer p.t.mu.Unlock()
+	v, ok := p.t.props[name]
+	if !ok {
+		return dbus.Variant{}, dbus.MakeFailedError(fmt.Errorf("unknown property %s", name))
+	}
+	return v, nil
+}
+
+func (p sniProperties) GetAll(iface string) (map[string]dbus.Variant, *dbus.Error) {
+	if iface != sniInterface {
+		return map[string]dbus.Variant{}, nil
+	}
+	p.t.mu.Lock()
+	defer p.t.mu.Unlock()
+	out := make(map[string]dbus.Variant, len(p.t.props))
+	for k, v := range p.t.props {
+		out[k] = v
+	}
+	return out, nil
+}
+
+func (p sniProperties) Set(iface, name string, value dbus.Variant) *dbus.Error {
+	return dbus.MakeFailedError(fmt.Errorf("property %s is read-only", name))
+}
@@ -0,0 +1,205 @@
+//go:build linux
+
+package main
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// fakeSessionBus stands in for the session bus and a StatusNotifierWatcher.
+type fakeSessionBus struct {
+	mu       sync.Mutex
+	exported map[string]interface{}
+	names    []string
+	calls    []string
+	signals  []string
+	noWatch  bool
+	taken    bool
+	closed   bool
+}
+
+func newFakeSessionBus() *fakeSessionBus {
+	return &fakeSessionBus{exported: map[string]interface{}{}}
+}
+
+func (b *fakeSessionBus) Export(v interface{}, path dbus.ObjectPath, iface string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.exported[string(path)+" "+iface] = v
+	return nil
+}
+
+func (b *fakeSessionBus) RequestName(name string, flags dbus.RequestNameFlags) (dbus.RequestNameReply, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.names = append(b.names, name)
+	if b.taken {
+		return dbus.RequestNameReplyExists, nil
+	}
+	return dbus.RequestNameReplyPrimaryOwner, nil
+}
+
+func (b *fakeSessionBus) Emit(path dbus.ObjectPath, name string, values ...interface{}) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.signals = append(b.signals, name)
+	return nil
+}
+
+func (b *fakeSessionBus) Call(dest string, path dbus.ObjectPath, method string, args ...interface{}) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.noWatch {
+		return errors.New("org.freedesktop.DBus.Error.ServiceUnknown")
+	}
+	b.calls = append(b.calls, method+" "+args[0].(string))
+	return nil
+}
+
+func (b *fakeSessionBus) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	return nil
+}
+
+func TestLinuxTrayRegistersAndActivates(t *testing.T) {
+	bus := newFakeSessionBus()
+	tr := newLinuxTray(func() (sniBus, error) { return bus, nil })
+	clicked := make(chan struct{}, 1)
+	if err := tr.run(func() { clicked <- struct{}{} }); err != nil {
+		t.Fatalf("run returned error: %v", err)
+	}
+	defer tr.close()
+
+	if len(bus.names) != 1 || !strings.HasPrefix(bus.names[0], "org.kde.StatusNotifierItem-") {
+		t.Fatalf("unexpected bus names: %v", bus.names)
+	}
+	if len(bus.calls) != 1 || bus.calls[0] != "org.kde.StatusNotifierWatcher.RegisterStatusNotifierItem "+bus.names[0] {
+		t.Fatalf("unexpected watcher calls: %v", bus.calls)
+	}
+
+	item, ok := bus.exported["/StatusNotifierItem org.kde.StatusNotifierItem"].(sniItem)
+	if !ok {
+		t.Fatalf("item not exported: %v", bus.exported)
+	}
+	if derr := item.Activate(1500, 10); derr != nil {
+		t.Fatalf("Activate returned error: %v", derr)
+	}
+	select {
+	case <-clicked:
+	case <-time.After(time.Second):
+		t.Fatal("click callback not invoked")
+	}
+	if x := tr.statusItemRightX(); x != 1500 {
+		t.Fatalf("expected click x 1500, got %d", x)
+	}
+}
+
+func TestLinuxTrayLabelAndProperties(t *testing.T) {
+	bus := newFakeSessionBus()
+	tr := newLinuxTray(func() (sniBus, error) { return bus, nil })
+	if err := tr.run(func() {}); err != nil {
+		t.Fatalf("run returned error: %v", err)
+	}
+	props := bus.exported["/StatusNotifierItem org.freedesktop.DBus.Properties"].(sniProperties)
+
+	tr.setImage(nil, "71° · 97% | 30.0/40G")
+	label, derr := props.Get(sniInterface, "XAyatanaLabel")
+	if derr != nil {
+		t.Fatalf("Get returned error: %v", derr)
+	}
+	if got := label.Value().(string); got != "71° · 97% | 30.0/40G" {
+		t.Fatalf("unexpected label %q", got)
+	}
+
+	tr.setTitle("NV ⚠")
+	all, _ := props.GetAll(sniInterface)
+	if all["Status"].Value() != "NeedsAttention" || all["XAyatanaLabel"].Value() != "NV ⚠" {
+		t.Fatalf("unexpected properties after error: %v", all)
+	}
+	if tip := all["ToolTip"].Value().(sniToolTip); tip.Text != "NV ⚠" {
+		t.Fatalf("unexpected tooltip %+v", tip)
+	}
+	want := []string{
+		sniInterface + ".XAyatanaNewLabel", sniInterface + ".NewToolTip",
+		sniInterface + ".XAyatanaNewLabel", sniInterface + ".NewToolTip", sniInterface + ".NewStatus",
+	}
+	if strings.Join(bus.signals, ",") != strings.Join(want, ",") {
+		t.Fatalf("unexpected signals %v", bus.signals)
+	}
+
+	tr.close()
+	if !bus.closed {
+		t.Fatal("expected bus to be closed")
+	}
+}
+
+func TestLinuxTrayExportsRenderedImage(t *testing.T) {
+	bus := newFakeSessionBus()
+	tr := newLinuxTray(func() (sniBus, error) { return bus, nil })
+	if err := tr.run(func() {}); err != nil {
+		t.Fatalf("run returned error: %v", err)
+	}
+	defer tr.close()
+	props := bus.exported["/StatusNotifierItem org.freedesktop.DBus.Properties"].(sniProperties)
+
+	img := image.NewRGBA(image.Rect(0, 0, 3, 2))
+	img.SetRGBA(1, 0, color.RGBA{R: 0x40, G: 0x20, B: 0x10, A: 0x80})
+	tr.setImage(img, "71°")
+	v, _ := props.Get(sniInterface, "IconPixmap")
+	pixmaps := v.Value().([]sniPixmap)
+	if len(pixmaps) != 1 || pixmaps[0].Width != 3 || pixmaps[0].Height != 2 || len(pixmaps[0].Data) != 3*2*4 {
+		t.Fatalf("unexpected pixmap %+v", pixmaps)
+	}
+	// ARGB, network byte order, alpha no longer premultiplied.
+	if got := pixmaps[0].Data[4:8]; got[0] != 0x80 || got[1] != 0x7f || got[2] != 0x3f || got[3] != 0x1f {
+		t.Fatalf("unexpected pixel % x", got)
+	}
+	if label, _ := props.Get(sniInterface, "XAyatanaLabel"); label.Value() != "71°" {
+		t.Fatalf("expected the label fallback, got %v", label.Value())
+	}
+	if bus.signals[0] != sniInterface+".NewIcon" {
+		t.Fatalf("expected NewIcon, got %v", bus.signals)
+	}
+
+	tr.setTitle("NV ⚠")
+	if v, _ := props.Get(sniInterface, "IconPixmap"); len(v.Value().([]sniPixmap)) != 0 {
+		t.Fatal("expected the status title to fall back to the icon name")
+	}
+}
+
+func TestLinuxTrayNameTaken(t *testing.T) {
+	bus := newFakeSessionBus()
+	bus.taken = true
+	tr := newLinuxTray(func() (sniBus, error) { return bus, nil })
+	err := tr.run(func() {})
+	if err == nil || strings.Contains(err.Error(), "<nil>") || !strings.Contains(err.Error(), "reply 3") {
+		t.Fatalf("expected the reply code in the error, got %v", err)
+	}
+	if !bus.closed {
+		t.Fatal("expected bus to be closed")
+	}
+}
+
+func TestLinuxTrayWithoutWatcher(t *testing.T) {
+	bus := newFakeSessionBus()
+	bus.noWatch = true
+	tr := newLinuxTray(func() (sniBus, error) { return bus, nil })
+	if err := tr.run(func() {}); err == nil || !strings.Contains(err.Error(), "StatusNotifierWatcher") {
+		t.Fatalf("expected watcher error, got %v", err)
+	}
+	if !bus.closed {
+		t.Fatal("expected bus to be closed after failed registration")
+	}
+	// Updates without a bus must be harmless.
+	tr.setTitle("GPU")
+}
@@ -0,0 +1,7 @@
+//go:build !darwin && !linux
+
+package main
+
+func newPlatformTray() trayBackend {
+	return noopTray{}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"image"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeTray records what the app last showed.
+type fakeTray struct {
+	mu    sync.Mutex
+	title string
+	text  string
+	img   *image.RGBA
+}
+
+func (f *fakeTray) run(onClick func()) error { return nil }
+
+func (f *fakeTray) setTitle(title string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.title, f.text, f.img = title, "", nil
+}
+
+func (f *fakeTray) setImage(img *image.RGBA, text string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.title, f.text, f.img = "", text, img
+}
+
+func (f *fakeTray) appearance() (int, bool) { return 1, true }
+func (f *fakeTray) statusItemRightX() int   { return -1 }
+func (f *fakeTray) close()                  {}
+
+func (f *fakeTray) shown() (string, string, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.title, f.text, f.img != nil
+}
+
+func useFakeTray(t *testing.T) *fakeTray {
+	f := &fakeTray{}
+	prev := tray
+	tray = f
+	t.Cleanup(func() { tray = prev })
+	return f
+}
+
+func TestFormatTrayTitle(t *testing.T) {
+	gpus := []GPU{
+		{Index: 0, Util: 97, MemUsed: 30720, MemTotal: 40960, Temp: 71, FanSpeed: -1, PowerDraw: 250, PowerLimit: 300},
+		{Index: 1, Util: 12, MemUsed: 2048, MemTotal: 40960, Temp: 45, FanSpeed: -1, PowerDraw: -1, PowerLimit: -1},
+	}
+	cases := []struct {
+		mode, status string
+		gpus         []GPU
+		want         string
+	}{
+		{"graphic", "idle", nil, "NVSmiBar"},
+		{"graphic", "connecting", nil, "NV ···"},
+		{"standard", "error", gpus, "NV ⚠"},
+		{"minimal", "live", nil, "NV ···"},
+		{"minimal", "live", gpus, "71°"},
+		{"compact", "live", gpus, "71° · 97%"},
+		{"standard", "live", gpus, "71° · 97% · 30.0G"},
+		{"standard", "stale", gpus, "71° · 97% · 30.0G !"},
+		{"spark", "live", gpus, "█▇▇ 71°"},
+		{"spark", "live", gpus[1:], "▁▁▁ 45°"},
+		{"multi", "live", gpus, "G0:71°·97% │ G1:45°·12%"},
+		{"graphic", "live", gpus, "71° · 97% | 30.0/40G"},
+		{"bogus", "live", gpus, "71° · 97% | 30.0/40G"},
+	}
+	for _, tc := range cases {
+		if got := formatTrayTitle(tc.gpus, tc.status, tc.mode, nil); got != tc.want {
+			t.Errorf("%s/%s: got %q, want %q", tc.mode, tc.status, got, tc.want)
+		}
+	}
+}
+
+func TestTrayFollowsActiveProfile(t *testing.T) {
+	f := useFakeTray(t)
+	a, _ := newTestApp(func(target string, port int) ([]GPU, error) {
+		return []GPU{{Index: 0, Util: 40, MemUsed: 1024, MemTotal: 8192, Temp: 55, FanSpeed: -1, PowerDraw: -1, PowerLimit: -1}}, nil
+	})
+	defer stopTestWorkers(a)
+
+	p, err := a.SaveProfile(ConnectionProfile{Name: "box", Target: "box", Port: 22})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.WatchConnection("other", "other", 22)
+	if err := a.SetActiveProfile(p.ID); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool {
+		_, text, img := f.shown()
+		return img && text == "55° · 40% | 1.0/8G"
+	})
+
+	// The spark mode draws the shown GPU's recent utilization from history.
+	if err := a.SetDisplayMode("spark"); err != nil {
+		t.Fatal(err)
+	}
+	if _, text, _ := f.shown(); !strings.HasPrefix(text, "▄") || !strings.HasSuffix(text, " ▄▂▁ 55°") {
+		t.Fatalf("expected a sparkline from history, got %q", text)
+	}
+
+	if err := a.SetDisplayMode("compact"); err != nil {
+		t.Fatal(err)
+	}
+	if _, text, _ := f.shown(); text != "55° · 40%" {
+		t.Fatalf("display mode change not redrawn, got %q", text)
+	}
+	if got := a.GetDisplayMode(); got != "compact" {
+		t.Fatalf("GetDisplayMode = %q", got)
+	}
+	if err := a.SetDisplayMode("huge"); err == nil {
+		t.Fatal("expected error for unknown display mode")
+	}
+
+	if err := a.SetActiveProfile(""); err != nil {
+		t.Fatal(err)
+	}
+	if title, _, _ := f.shown(); title != "NVSmiBar" {
+		t.Fatalf("expected idle title after disconnect, got %q", title)
+	}
+}
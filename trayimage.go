@@ -0,0 +1,449 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+)
+
+// trayMetric names one value a tray layout can show.
+type trayMetric string
+
+const (
+	trayMetricTemp     trayMetric = "temp"     // 71°
+	trayMetricUtil     trayMetric = "util"     // 97%
+	trayMetricMem      trayMetric = "mem"      // 29.3G used; level is percent used
+	trayMetricMemTotal trayMetric = "memTotal" // 29.3/40G
+	trayMetricPower    trayMetric = "power"    // 250W; level is percent of limit
+	trayMetricGPUIndex trayMetric = "gpuIndex" // G0, drawn muted
+)
+
+// trayThreshold picks the warning and critical colors for a metric's level.
+type trayThreshold struct {
+	warn float64
+	crit float64
+}
+
+var defaultTrayThresholds = map[trayMetric]trayThreshold{
+	trayMetricTemp:  {warn: 70, crit: 85},
+	trayMetricUtil:  {warn: 70, crit: 90},
+	trayMetricMem:   {warn: 75, crit: 90},
+	trayMetricPower: {warn: 80, crit: 95},
+}
+
+// trayItem is one metric in a row, drawn as text or as a level bar.
+type trayItem struct {
+	metric trayMetric
+	bar    bool
+}
+
+// trayRow is one line of the tray image. Muted rows ignore thresholds.
+type trayRow struct {
+	items []trayItem
+	muted bool
+}
+
+// trayLayout describes what the tray shows: which metrics in which rows,
+// for which GPUs, colored by which thresholds, with an optional sparkline of
+// recent history drawn to the left.
+type trayLayout struct {
+	rows []trayRow
+	// allGPUs repeats the first row for every GPU, prefixed with its index;
+	// otherwise only the first GPU is shown.
+	allGPUs     bool
+	sparkline   trayMetric
+	sparkPoints int
+	thresholds  map[trayMetric]trayThreshold
+}
+
+func textItems(metrics ...trayMetric) []trayItem {
+	items := make([]trayItem, len(metrics))
+	for i, m := range metrics {
+		items[i] = trayItem{metric: m}
+	}
+	return items
+}
+
+// trayLayouts are the menu bar display modes.
+var trayLayouts = map[string]trayLayout{
+	"minimal":  {rows: []trayRow{{items: textItems(trayMetricTemp)}}},
+	"compact":  {rows: []trayRow{{items: textItems(trayMetricTemp, trayMetricUtil)}}},
+	"standard": {rows: []trayRow{{items: textItems(trayMetricTemp, trayMetricUtil, trayMetricMem)}}},
+	"spark": {rows: []trayRow{{items: []trayItem{
+		{metric: trayMetricUtil, bar: true},
+		{metric: trayMetricMem, bar: true},
+		{metric: trayMetricPower, bar: true},
+		{metric: trayMetricTemp},
+	}}}, sparkline: trayMetricUtil, sparkPoints: 12},
+	"multi": {rows: []trayRow{{items: textItems(trayMetricTemp, trayMetricUtil)}}, allGPUs: true},
+	"graphic": {rows: []trayRow{
+		{items: textItems(trayMetricTemp, trayMetricUtil)},
+		{items: textItems(trayMetricMemTotal), muted: true},
+	}},
+}
+
+// trayTheme holds the colors for a light or dark menu bar.
+type trayTheme struct {
+	fg    color.NRGBA
+	muted color.NRGBA
+	track color.NRGBA
+}
+
+var (
+	trayThemeDark  = trayTheme{fg: color.NRGBA{255, 255, 255, 255}, muted: color.NRGBA{160, 160, 166, 255}, track: color.NRGBA{255, 255, 255, 56}}
+	trayThemeLight = trayTheme{fg: color.NRGBA{0, 0, 0, 217}, muted: color.NRGBA{0, 0, 0, 128}, track: color.NRGBA{0, 0, 0, 40}}
+	trayColorWarn  = color.NRGBA{245, 158, 10, 255}
+	trayColorCrit  = color.NRGBA{240, 69, 69, 255}
+)
+
+// trayHeight is the menu bar height in points.
+const trayHeight = 22
+
+// traySegment is a resolved piece of a row: text or a bar with its color.
+type traySegment struct {
+	text  string
+	bar   bool
+	level float64
+	color color.NRGBA
+}
+
+func gpuMetricText(g GPU, m trayMetric) (string, float64) {
+	memPct := -1.0
+	if g.MemTotal > 0 && g.MemUsed >= 0 {
+		memPct = float64(g.MemUsed) / float64(g.MemTotal) * 100
+	}
+	switch m {
+	case trayMetricTemp:
+		if g.Temp < 0 {
+			return "--°", -1
+		}
+		return fmt.Sprintf("%d°", g.Temp), float64(g.Temp)
+	case trayMetricUtil:
+		if g.Util < 0 {
+			return "--%", -1
+		}
+		return fmt.Sprintf("%d%%", g.Util), float64(g.Util)
+	case trayMetricMem:
+		return vramGB(g.MemUsed) + "G", memPct
+	case trayMetricMemTotal:
+		total := "--"
+		if g.MemTotal >= 0 {
+			total = fmt.Sprintf("%.0f", float64(g.MemTotal)/1024)
+		}
+		return vramGB(g.MemUsed) + "/" + total + "G", memPct
+	case trayMetricPower:
+		pct := -1.0
+		if g.PowerLimit > 0 && g.PowerDraw >= 0 {
+			pct = float64(g.PowerDraw) / float64(g.PowerLimit) * 100
+		}
+		if g.PowerDraw < 0 {
+			return "--W", pct
+		}
+		return fmt.Sprintf("%dW", g.PowerDraw), pct
+	case trayMetricGPUIndex:
+		return fmt.Sprintf("G%d", g.Index), -1
+	}
+	return "", -1
+}
+
+func vramGB(mib int) string {
+	if mib < 0 {
+		return "--"
+	}
+	return fmt.Sprintf("%.1f", float64(mib)/1024)
+}
+
+func (l trayLayout) threshold(m trayMetric) (trayThreshold, bool) {
+	thresholds := l.thresholds
+	if thresholds == nil {
+		thresholds = defaultTrayThresholds
+	}
+	t, ok := thresholds[m]
+	return t, ok
+}
+
+func (l trayLayout) levelColor(m trayMetric, level float64, muted bool, theme trayTheme) color.NRGBA {
+	if muted || m == trayMetricGPUIndex {
+		return theme.muted
+	}
+	if t, ok := l.threshold(m); ok && level >= 0 {
+		switch {
+		case level >= t.crit:
+			return trayColorCrit
+		case level >= t.warn:
+			return trayColorWarn
+		}
+	}
+	return theme.fg
+}
+
+// segments resolves the layout's rows against the GPUs. Consecutive text
+// items are separated by " · " (a tighter "·" when every GPU is shown); bars
+// are drawn side by side.
+func (l trayLayout) segments(gpus []GPU, theme trayTheme) [][]traySegment {
+	var rows [][]traySegment
+	for ri, row := range l.rows {
+		targets := gpus[:1]
+		if l.allGPUs && ri == 0 {
+			targets = gpus
+		}
+		var segs []traySegment
+		for gi, g := range targets {
+			items := row.items
+			if l.allGPUs && ri == 0 {
+				if gi > 0 {
+					segs = append(segs, traySegment{text: " │ ", color: theme.muted})
+				}
+				items = append([]trayItem{{metric: trayMetricGPUIndex}}, items...)
+			}
+			for ii, item := range items {
+				text, level := gpuMetricText(g, item.metric)
+				if ii > 0 {
+					prev := items[ii-1]
+					switch {
+					case prev.metric == trayMetricGPUIndex:
+						segs = append(segs, traySegment{text: ":", color: theme.muted})
+					case prev.bar && item.bar:
+					case prev.bar || item.bar:
+						segs = append(segs, traySegment{text: " ", color: theme.muted})
+					case l.allGPUs && ri == 0:
+						segs = append(segs, traySegment{text: "·", color: theme.muted})
+					default:
+						segs = append(segs, traySegment{text: " · ", color: theme.muted})
+					}
+				}
+				segs = append(segs, traySegment{
+					text:  text,
+					bar:   item.bar,
+					level: level,
+					color: l.levelColor(item.metric, level, row.muted, theme),
+				})
+			}
+		}
+		rows = append(rows, segs)
+	}
+	return rows
+}
+
+const sparkChars = "▁▂▃▄▅▆▇█"
+
+func sparkChar(level float64) string {
+	chars := []rune(sparkChars)
+	if level < 0 {
+		level = 0
+	}
+	idx := int(level / 100 * 8)
+	if idx > 7 {
+		idx = 7
+	}
+	return string(chars[idx])
+}
+
+// renderTrayText renders the layout as a single line of text, for trays
+// that only show titles. Rows are joined with " | ".
+func renderTrayText(l trayLayout, status string, gpus []GPU, history []float64) string {
+	if len(gpus) == 0 {
+		return "NV ···"
+	}
+	var b strings.Builder
+	if l.sparkline != "" && len(history) > 0 {
+		for _, v := range lastPoints(history, l.sparkPoints) {
+			b.WriteString(sparkChar(v))
+		}
+		b.WriteString(" ")
+	}
+	for ri, row := range l.segments(gpus, trayThemeDark) {
+		if ri > 0 {
+			b.WriteString(" | ")
+		}
+		for _, seg := range row {
+			if seg.bar {
+				b.WriteString(sparkChar(seg.level))
+			} else {
+				b.WriteString(seg.text)
+			}
+		}
+	}
+	if status == "stale" {
+		b.WriteString(" !")
+	}
+	return b.String()
+}
+
+func lastPoints(values []float64, n int) []float64 {
+	if n > 0 && len(values) > n {
+		return values[len(values)-n:]
+	}
+	return values
+}
+
+// renderTrayImage draws the layout for live or stale data. scale is the
+// backing pixel density (2 on Retina displays); the image is trayHeight
+// points tall. Stale data is drawn at half opacity.
+func renderTrayImage(l trayLayout, status string, gpus []GPU, history []float64, theme trayTheme, scale int) *image.RGBA {
+	if scale < 1 {
+		scale = 1
+	}
+	var rows [][]traySegment
+	if len(gpus) > 0 {
+		rows = l.segments(gpus, theme)
+	}
+
+	const pad, rowGap, sparkGap = 1, 2, 3
+	widths := make([]int, len(rows))
+	contentW := 0
+	for i, row := range rows {
+		widths[i] = segmentsWidth(row)
+		contentW = max(contentW, widths[i])
+	}
+	contentH := len(rows)*glyphHeight + max(len(rows)-1, 0)*rowGap
+
+	var spark []float64
+	sparkW := 0
+	if l.sparkline != "" && len(history) > 0 {
+		spark = lastPoints(history, l.sparkPoints)
+		sparkW = len(spark) + sparkGap
+	}
+
+	w := pad*2 + sparkW + contentW
+	img := image.NewRGBA(image.Rect(0, 0, w*scale, trayHeight*scale))
+	c := &trayCanvas{img: img, scale: scale, alpha: 1}
+	if status == "stale" {
+		c.alpha = 0.5
+	}
+	top := (trayHeight - contentH) / 2
+
+	if spark != nil {
+		clr := l.levelColor(l.sparkline, spark[len(spark)-1], false, theme)
+		for i, v := range spark {
+			h := int(v/100*float64(contentH) + 0.5)
+			h = min(max(h, 1), contentH)
+			c.fill(pad+i, top, 1, contentH, theme.track)
+			c.fill(pad+i, top+contentH-h, 1, h, clr)
+		}
+	}
+	for i, row := range rows {
+		x := pad + sparkW + (contentW-widths[i])/2
+		y := top + i*(glyphHeight+rowGap)
+		for _, seg := range row {
+			if seg.bar {
+				c.bar(x, y, seg.level, seg.color, theme.track)
+				x += barWidth + 1
+				continue
+			}
+			x = c.text(x, y, seg.text, seg.color)
+		}
+	}
+	return img
+}
+
+const barWidth = 3
+
+func segmentsWidth(row []traySegment) int {
+	w := 0
+	for _, seg := range row {
+		if seg.bar {
+			w += barWidth + 1
+		} else {
+			w += textWidth(seg.text)
+		}
+	}
+	return max(w-1, 0)
+}
+
+// trayCanvas draws in points onto a pixel image scaled by scale.
+type trayCanvas struct {
+	img   *image.RGBA
+	scale int
+	alpha float64
+}
+
+func (c *trayCanvas) fill(x, y, w, h int, clr color.NRGBA) {
+	clr.A = uint8(float64(clr.A) * c.alpha)
+	for py := y * c.scale; py < (y+h)*c.scale; py++ {
+		for px := x * c.scale; px < (x+w)*c.scale; px++ {
+			c.img.Set(px, py, clr)
+		}
+	}
+}
+
+func (c *trayCanvas) bar(x, y int, level float64, clr, track color.NRGBA) {
+	h := 1
+	if level > 0 {
+		h = min(max(int(level/100*glyphHeight+0.5), 1), glyphHeight)
+	}
+	c.fill(x, y, barWidth, glyphHeight, track)
+	c.fill(x, y+glyphHeight-h, barWidth, h, clr)
+}
+
+// text draws s at (x, y) and returns the x after the last glyph.
+func (c *trayCanvas) text(x, y int, s string, clr color.NRGBA) int {
+	for _, r := range s {
+		g, ok := trayFont[r]
+		if !ok {
+			g = trayFont['?']
+		}
+		for gy, line := range g {
+			for gx, px := range line {
+				if px == '#' {
+					c.fill(x+gx, y+gy, 1, 1, clr)
+				}
+			}
+		}
+		x += len(g[0]) + 1
+	}
+	return x
+}
+
+func textWidth(s string) int {
+	w := 0
+	for _, r := range s {
+		g, ok := trayFont[r]
+		if !ok {
+			g = trayFont['?']
+		}
+		w += len(g[0]) + 1
+	}
+	return w
+}
+
+// encodeTrayPNG encodes a rendered tray image.
+func encodeTrayPNG(img image.Image) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+const glyphHeight = 7
+
+// trayFont is a small proportional bitmap font covering what tray layouts
+// print. Every glyph is glyphHeight rows of equal width.
+var trayFont = map[rune][]string{
+	'0': {".###.", "#...#", "#...#", "#...#", "#...#", "#...#", ".###."},
+	'1': {"..#..", ".##..", "..#..", "..#..", "..#..", "..#..", ".###."},
+	'2': {".###.", "#...#", "....#", "...#.", "..#..", ".#...", "#####"},
+	'3': {"####.", "....#", "....#", ".###.", "....#", "....#", "####."},
+	'4': {"...#.", "..##.", ".#.#.", "#..#.", "#####", "...#.", "...#."},
+	'5': {"#####", "#....", "####.", "....#", "....#", "#...#", ".###."},
+	'6': {"..##.", ".#...", "#....", "####.", "#...#", "#...#", ".###."},
+	'7': {"#####", "....#", "...#.", "..#..", ".#...", ".#...", ".#..."},
+	'8': {".###.", "#...#", "#...#", ".###.", "#...#", "#...#", ".###."},
+	'9': {".###.", "#...#", "#...#", ".####", "....#", "...#.", ".##.."},
+	'%': {"##...", "##..#", "...#.", "..#..", ".#...", "#..##", "...##"},
+	'°': {".#.", "#.#", ".#.", "...", "...", "...", "..."},
+	'/': {"....#", "...#.", "...#.", "..#..", ".#...", ".#...", "#...."},
+	'.': {".", ".", ".", ".", ".", ".", "#"},
+	'·': {".", ".", ".", "#", ".", ".", "."},
+	'│': {"#", "#", "#", "#", "#", "#", "#"},
+	':': {".", ".", "#", ".", "#", ".", "."},
+	'-': {"....", "....", "....", "####", "....", "....", "...."},
+	' ': {".", ".", ".", ".", ".", ".", "."},
+	'G': {".###.", "#...#", "#....", "#.###", "#...#", "#...#", ".###."},
+	'W': {"#...#", "#...#", "#...#", "#.#.#", "#.#.#", "##.##", "#...#"},
+	'?': {".###.", "#...#", "....#", "...#.", "..#..", ".....", "..#.."},
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite golden files in testdata")
+
+var trayTestGPUs = []GPU{
+	{Index: 0, Util: 97, MemUsed: 30720, MemTotal: 40960, Temp: 71, FanSpeed: -1, PowerDraw: 250, PowerLimit: 300},
+	{Index: 1, Util: 12, MemUsed: 2048, MemTotal: 40960, Temp: 45, FanSpeed: -1, PowerDraw: 60, PowerLimit: 300},
+}
+
+var trayTestHistory = []float64{10, 20, 35, 50, 80, 95, 97}
+
+func TestRenderTrayText(t *testing.T) {
+	cases := []struct {
+		mode, status string
+		history      []float64
+		want         string
+	}{
+		{"minimal", "live", nil, "71°"},
+		{"compact", "live", nil, "71° · 97%"},
+		{"standard", "live", nil, "71° · 97% · 30.0G"},
+		{"spark", "live", nil, "█▇▇ 71°"},
+		{"spark", "live", trayTestHistory, "▁▂▃▅▇██ █▇▇ 71°"},
+		{"multi", "live", nil, "G0:71°·97% │ G1:45°·12%"},
+		{"graphic", "stale", nil, "71° · 97% | 30.0/40G !"},
+	}
+	for _, tc := range cases {
+		got := renderTrayText(trayLayouts[tc.mode], tc.status, trayTestGPUs, tc.history)
+		if got != tc.want {
+			t.Errorf("%s: got %q, want %q", tc.mode, got, tc.want)
+		}
+	}
+
+	sparkLayout := trayLayout{rows: trayLayouts["minimal"].rows, sparkline: trayMetricUtil, sparkPoints: 4}
+	if got := renderTrayText(sparkLayout, "live", trayTestGPUs, trayTestHistory); got != "▅▇██ 71°" {
+		t.Errorf("sparkline: got %q", got)
+	}
+	if got := renderTrayText(trayLayouts["compact"], "live", nil, nil); got != "NV ···" {
+		t.Errorf("no GPUs: got %q", got)
+	}
+}
+
+func TestRenderTrayImageGolden(t *testing.T) {
+	cases := []struct {
+		name    string
+		layout  trayLayout
+		status  string
+		history []float64
+		theme   trayTheme
+		scale   int
+	}{
+		{"graphic-dark", trayLayouts["graphic"], "live", nil, trayThemeDark, 1},
+		{"graphic-light-2x", trayLayouts["graphic"], "live", nil, trayThemeLight, 2},
+		{"graphic-stale", trayLayouts["graphic"], "stale", nil, trayThemeDark, 1},
+		{"standard", trayLayouts["standard"], "live", nil, trayThemeDark, 1},
+		{"spark", trayLayouts["spark"], "live", nil, trayThemeDark, 1},
+		{"spark-history", trayLayouts["spark"], "live", trayTestHistory, trayThemeDark, 1},
+		{"multi", trayLayouts["multi"], "live", nil, trayThemeLight, 1},
+		{"sparkline", trayLayout{rows: trayLayouts["compact"].rows, sparkline: trayMetricUtil, sparkPoints: 6}, "live", trayTestHistory, trayThemeDark, 1},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			img := renderTrayImage(tc.layout, tc.status, trayTestGPUs, tc.history, tc.theme, tc.scale)
+			if img.Bounds().Dy() != trayHeight*tc.scale {
+				t.Fatalf("height %d, want %d", img.Bounds().Dy(), trayHeight*tc.scale)
+			}
+			path := filepath.Join("testdata", "tray", tc.name+".png")
+			data, err := encodeTrayPNG(img)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *updateGolden {
+				if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(path, data, 0o644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			f, err := os.Open(path)
+			if err != nil {
+				t.Fatalf("missing golden image (run go test -update): %v", err)
+			}
+			defer f.Close()
+			want, err := png.Decode(f)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Compare what the tray receives: the PNG, decoded.
+			got, err := png.Decode(bytes.NewReader(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if x, y, ok := sameImage(got, want); !ok {
+				t.Fatalf("image differs from %s at (%d, %d)", path, x, y)
+			}
+		})
+	}
+}
+
+// sameImage compares two images pixel by pixel and reports the first
+// differing pixel.
+func sameImage(got, want image.Image) (int, int, bool) {
+	if got.Bounds() != want.Bounds() {
+		return -1, -1, false
+	}
+	b := got.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			r1, g1, b1, a1 := got.At(x, y).RGBA()
+			r2, g2, b2, a2 := want.At(x, y).RGBA()
+			if r1 != r2 || g1 != g2 || b1 != b2 || a1 != a2 {
+				return x, y, false
+			}
+		}
+	}
+	return 0, 0, true
+}
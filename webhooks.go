@@ -0,0 +1,376 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// Webhook events. An empty WebhookConfig.Events subscribes to all of them.
+const (
+	webhookEventStatus      = "status"
+	webhookEventAlert       = "alert"
+	webhookEventJobFinished = "jobFinished"
+	webhookEventTest        = "test"
+)
+
+// Webhook body formats.
+const (
+	webhookFormatGeneric = "generic"
+	webhookFormatSlack   = "slack"
+	webhookFormatDiscord = "discord"
+)
+
+// webhookBackoff is the wait before each retry; a delivery is attempted
+// len(webhookBackoff)+1 times. Only network errors, 429 and 5xx retry.
+var webhookBackoff = []time.Duration{2 * time.Second, 10 * time.Second, 30 * time.Second}
+
+// WebhookConfig is one outbound webhook.
+type WebhookConfig struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Enabled bool   `json:"enabled"`
+	URL     string `json:"url"`
+	// Format is "generic" (the WebhookPayload as JSON), "slack" or "discord".
+	Format string `json:"format"`
+	// Template overrides the body with a text/template executed against
+	// WebhookPayload; {{json .Field}} quotes a value as JSON.
+	Template string `json:"template"`
+	// Events filters which events are sent; empty sends all.
+	Events []string `json:"events"`
+	// ConnectionID scopes the webhook to one connection; empty matches all.
+	ConnectionID string `json:"connectionId"`
+}
+
+// WebhookPayload is the body of a generic webhook and the data available to
+// templates.
+type WebhookPayload struct {
+	Event        string      `json:"event"`
+	ConnectionID string      `json:"connectionId"`
+	Host         string      `json:"host"`
+	From         string      `json:"from,omitempty"`
+	To           string      `json:"to,omitempty"`
+	Alert        *AlertEvent `json:"alert,omitempty"`
+	GPUIndex     int         `json:"gpuIndex"`
+	GPUs         []GPU       `json:"gpus"`
+	Timestamp    int64       `json:"timestamp"`
+	Message      string      `json:"message"`
+}
+
+var webhookTemplates = map[string]string{
+	webhookFormatSlack:   `{"text": {{json .Message}}}`,
+	webhookFormatDiscord: `{"username": "NVSmiBar", "content": {{json .Message}}}`,
+}
+
+var webhookFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
+func validateWebhook(h WebhookConfig) error {
+	if h.ID == "" {
+		return fmt.Errorf("webhook id is required")
+	}
+	u, err := url.Parse(h.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("webhook %q: URL must be http(s)", h.ID)
+	}
+	switch h.Format {
+	case "", webhookFormatGeneric, webhookFormatSlack, webhookFormatDiscord:
+	default:
+		return fmt.Errorf("webhook %q: unknown format %q", h.ID, h.Format)
+	}
+	for _, ev := range h.Events {
+		switch ev {
+		case webhookEventStatus, webhookEventAlert, webhookEventJobFinished:
+		default:
+			return fmt.Errorf("webhook %q: unknown event %q", h.ID, ev)
+		}
+	}
+	if h.Template != "" {
+		if _, err := template.New(h.ID).Funcs(webhookFuncs).Parse(h.Template); err != nil {
+			return fmt.Errorf("webhook %q: %w", h.ID, err)
+		}
+	}
+	return nil
+}
+
+// webhookBody renders the request body for h.
+func webhookBody(h WebhookConfig, p WebhookPayload) ([]byte, error) {
+	text := h.Template
+	if text == "" {
+		text = webhookTemplates[h.Format]
+	}
+	if text == "" {
+		return json.Marshal(p)
+	}
+	tmpl, err := template.New(h.ID).Funcs(webhookFuncs).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, p); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (h WebhookConfig) wants(p WebhookPayload) bool {
+	if p.Event == webhookEventTest {
+		return true
+	}
+	if !h.Enabled || (h.ConnectionID != "" && h.ConnectionID != p.ConnectionID) {
+		return false
+	}
+	if len(h.Events) == 0 {
+		return true
+	}
+	for _, ev := range h.Events {
+		if ev == p.Event {
+			return true
+		}
+	}
+	return false
+}
+
+// webhookDispatcher turns connection state changes into webhook deliveries.
+// Deliveries run on their own goroutines so retries never stall polling.
+type webhookDispatcher struct {
+	client  *http.Client
+	backoff []time.Duration
+	sleep   func(time.Duration)
+
+	mu       sync.Mutex
+	hooks    []WebhookConfig
+	statuses map[string]string
+	lastGPUs map[string][]GPU
+	jobs     map[string]map[int]*jobState
+
+	// wg tracks in-flight deliveries so tests can wait for them.
+	wg sync.WaitGroup
+}
+
+func newWebhookDispatcher() *webhookDispatcher {
+	return &webhookDispatcher{
+		client:   &http.Client{Timeout: 10 * time.Second},
+		backoff:  webhookBackoff,
+		sleep:    time.Sleep,
+		statuses: map[string]string{},
+		lastGPUs: map[string][]GPU{},
+		jobs:     map[string]map[int]*jobState{},
+	}
+}
+
+func (d *webhookDispatcher) setHooks(hooks []WebhookConfig) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.hooks = hooks
+}
+
+// forget discards state for a connection that is no longer watched.
+func (d *webhookDispatcher) forget(connectionID string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.statuses, connectionID)
+	delete(d.lastGPUs, connectionID)
+	delete(d.jobs, connectionID)
+}
+
+// observe feeds one poll result in. Status changes between live, stale and
+// error are sent, as are jobs that finished (a GPU freeing up).
+func (d *webhookDispatcher) observe(connectionID string, meta ConnectionMeta, gpus []GPU, now time.Time) {
+	d.mu.Lock()
+	if gpus != nil {
+		d.lastGPUs[connectionID] = gpus
+	}
+	snapshot := d.lastGPUs[connectionID]
+	prev := d.statuses[connectionID]
+	d.statuses[connectionID] = meta.Status
+
+	var payloads []WebhookPayload
+	base := WebhookPayload{ConnectionID: connectionID, Host: meta.ActiveTarget, GPUIndex: -1, GPUs: snapshot, Timestamp: now.Unix()}
+	if prev != "" && prev != "connecting" && prev != meta.Status && meta.Status != "connecting" {
+		p := base
+		p.Event, p.From, p.To = webhookEventStatus, prev, meta.Status
+		p.Message = fmt.Sprintf("%s: %s → %s", meta.ActiveTarget, prev, meta.Status)
+		if meta.ErrorMessage != "" && meta.Status != "live" {
+			p.Message += " (" + meta.ErrorMessage + ")"
+		}
+		payloads = append(payloads, p)
+	}
+	if d.jobs[connectionID] == nil {
+		d.jobs[connectionID] = map[int]*jobState{}
+	}
+	done, durations := finishedJobs(d.jobs[connectionID], gpus, now)
+	for i, g := range done {
+		p := base
+		p.Event, p.GPUIndex = webhookEventJobFinished, g.Index
+		p.Message = fmt.Sprintf("Job finished on %s GPU %d after %s; GPU is free (%d%% util, %d MiB used)", meta.ActiveTarget, g.Index, formatNotifyDuration(durations[i]), g.Util, g.MemUsed)
+		payloads = append(payloads, p)
+	}
+	d.mu.Unlock()
+
+	for _, p := range payloads {
+		d.dispatch(p)
+	}
+}
+
+// alert sends a fired or resolved alert event.
+func (d *webhookDispatcher) alert(ev AlertEvent, now time.Time) {
+	d.mu.Lock()
+	snapshot := d.lastGPUs[ev.ConnectionID]
+	d.mu.Unlock()
+	d.dispatch(WebhookPayload{
+		Event:        webhookEventAlert,
+		ConnectionID: ev.ConnectionID,
+		Host:         ev.Target,
+		Alert:        &ev,
+		GPUIndex:     ev.GPUIndex,
+		GPUs:         snapshot,
+		Timestamp:    now.Unix(),
+		Message:      ev.Message,
+	})
+}
+
+func (d *webhookDispatcher) dispatch(p WebhookPayload) {
+	d.mu.Lock()
+	hooks := d.hooks
+	d.mu.Unlock()
+	for _, h := range hooks {
+		if !h.wants(p) {
+			continue
+		}
+		d.wg.Add(1)
+		go func(h WebhookConfig) {
+			defer d.wg.Done()
+			if err := d.deliver(h, p, len(d.backoff)); err != nil {
+				println("webhook:", err.Error())
+			}
+		}(h)
+	}
+}
+
+// deliver POSTs p to h, retrying up to retries times with backoff.
+func (d *webhookDispatcher) deliver(h WebhookConfig, p WebhookPayload, retries int) error {
+	body, err := webhookBody(h, p)
+	if err != nil {
+		return fmt.Errorf("webhook %s: %w", h.label(), err)
+	}
+	for attempt := 0; ; attempt++ {
+		retry, err := d.post(h.URL, body)
+		if err == nil {
+			return nil
+		}
+		if !retry || attempt >= retries {
+			return fmt.Errorf("webhook %s: %w", h.label(), err)
+		}
+		d.sleep(d.backoff[min(attempt, len(d.backoff)-1)])
+	}
+}
+
+// post sends one request and reports whether a failure is worth retrying.
+func (d *webhookDispatcher) post(url string, body []byte) (bool, error) {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return false, withoutURL(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "NVSmiBar/"+appVersion)
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return true, withoutURL(err)
+	}
+	defer resp.Body.Close()
+	snippet, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	err = fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(snippet)))
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500, err
+}
+
+// withoutURL drops the request URL from a *url.Error, since webhook URLs
+// usually carry their secret token and errors end up in logs and the UI.
+func withoutURL(err error) error {
+	var uerr *url.Error
+	if errors.As(err, &uerr) {
+		return fmt.Errorf("%s: %w", uerr.Op, uerr.Err)
+	}
+	return err
+}
+
+// label names h in errors by ID and name, never by URL.
+func (h WebhookConfig) label() string {
+	if h.Name == "" {
+		return fmt.Sprintf("%q", h.ID)
+	}
+	return fmt.Sprintf("%q (%s)", h.ID, h.Name)
+}
+
+// GetWebhooks returns the configured outbound webhooks.
+func (a *App) GetWebhooks() []WebhookConfig {
+	hooks := a.store.snapshot().Webhooks
+	if hooks == nil {
+		return []WebhookConfig{}
+	}
+	return hooks
+}
+
+// SetWebhooks validates, applies and persists the outbound webhooks.
+func (a *App) SetWebhooks(hooks []WebhookConfig) error {
+	seen := map[string]bool{}
+	for _, h := range hooks {
+		if err := validateWebhook(h); err != nil {
+			return err
+		}
+		if seen[h.ID] {
+			return fmt.Errorf("duplicate webhook id %q", h.ID)
+		}
+		seen[h.ID] = true
+	}
+	if hooks == nil {
+		hooks = []WebhookConfig{}
+	}
+	a.webhooks.setHooks(hooks)
+	return a.store.update(func(cfg *appConfig) {
+		cfg.Webhooks = hooks
+	})
+}
+
+// SendTestWebhook posts a test event to hook once, without retries, and
+// returns the delivery error if any.
+func (a *App) SendTestWebhook(hook WebhookConfig) error {
+	if hook.ID == "" {
+		hook.ID = "test"
+	}
+	if err := validateWebhook(hook); err != nil {
+		return err
+	}
+	var gpus []GPU
+	host := ""
+	for _, s := range a.GetConnectionSnapshots() {
+		if hook.ConnectionID == "" || hook.ConnectionID == s.ID {
+			gpus, host = s.GPUs, s.Meta.ActiveTarget
+			break
+		}
+	}
+	return a.webhooks.deliver(hook, WebhookPayload{
+		Event:        webhookEventTest,
+		ConnectionID: hook.ConnectionID,
+		Host:         host,
+		GPUIndex:     -1,
+		GPUs:         gpus,
+		Timestamp:    time.Now().Unix(),
+		Message:      "Test message from NVSmiBar",
+	}, 0)
+}
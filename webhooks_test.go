@@ -0,0 +1,175 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type webhookSink struct {
+	mu     sync.Mutex
+	bodies []string
+	fail   int // respond 503 to this many requests first
+}
+
+func (s *webhookSink) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if r.Header.Get("Content-Type") != "application/json" {
+		http.Error(w, "bad content type", http.StatusBadRequest)
+		return
+	}
+	if s.fail > 0 {
+		s.fail--
+		http.Error(w, "busy", http.StatusServiceUnavailable)
+		return
+	}
+	s.bodies = append(s.bodies, string(body))
+}
+
+func (s *webhookSink) received() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string{}, s.bodies...)
+}
+
+func newTestDispatcher() (*webhookDispatcher, *[]time.Duration) {
+	d := newWebhookDispatcher()
+	var slept []time.Duration
+	var mu sync.Mutex
+	d.sleep = func(dur time.Duration) {
+		mu.Lock()
+		defer mu.Unlock()
+		slept = append(slept, dur)
+	}
+	return d, &slept
+}
+
+func TestWebhookStatusTransitionsAndFormats(t *testing.T) {
+	sink := &webhookSink{}
+	srv := httptest.NewServer(sink)
+	defer srv.Close()
+
+	d, _ := newTestDispatcher()
+	d.setHooks([]WebhookConfig{
+		{ID: "slack", Enabled: true, URL: srv.URL, Format: webhookFormatSlack, Events: []string{webhookEventStatus}},
+		{ID: "generic", Enabled: true, URL: srv.URL, ConnectionID: "conn"},
+		{ID: "other", Enabled: true, URL: srv.URL, ConnectionID: "elsewhere"},
+		{ID: "off", Enabled: false, URL: srv.URL},
+	})
+
+	start := time.Unix(1700000000, 0)
+	gpus := []GPU{{Index: 0, Util: 97, MemUsed: 1024, MemTotal: 8192, Temp: 71}}
+	d.observe("conn", ConnectionMeta{Status: "connecting", ActiveTarget: "box"}, nil, start)
+	d.observe("conn", ConnectionMeta{Status: "live", ActiveTarget: "box"}, gpus, start.Add(time.Second))
+	d.observe("conn", ConnectionMeta{Status: "stale", ActiveTarget: "box", ErrorMessage: "Connection timed out"}, nil, start.Add(2*time.Second))
+	d.wg.Wait()
+
+	got := sink.received()
+	if len(got) != 2 {
+		t.Fatalf("expected one slack and one generic delivery, got %q", got)
+	}
+	var slack struct{ Text string }
+	var generic WebhookPayload
+	for _, body := range got {
+		if strings.Contains(body, `"text"`) {
+			json.Unmarshal([]byte(body), &slack)
+		} else if err := json.Unmarshal([]byte(body), &generic); err != nil {
+			t.Fatalf("generic body is not a payload: %v", err)
+		}
+	}
+	if slack.Text != "box: live → stale (Connection timed out)" {
+		t.Fatalf("unexpected slack text %q", slack.Text)
+	}
+	if generic.Event != webhookEventStatus || generic.From != "live" || generic.To != "stale" || len(generic.GPUs) != 1 || generic.GPUs[0].Temp != 71 {
+		t.Fatalf("unexpected generic payload %+v", generic)
+	}
+}
+
+func TestWebhookAlertAndTemplate(t *testing.T) {
+	sink := &webhookSink{}
+	srv := httptest.NewServer(sink)
+	defer srv.Close()
+
+	d, _ := newTestDispatcher()
+	d.setHooks([]WebhookConfig{
+		{ID: "discord", Enabled: true, URL: srv.URL, Format: webhookFormatDiscord, Events: []string{webhookEventAlert}},
+		{ID: "custom", Enabled: true, URL: srv.URL, Template: `{"rule": {{json .Alert.RuleID}}, "gpu": {{.GPUIndex}}}`, Events: []string{webhookEventAlert}},
+	})
+	d.alert(AlertEvent{RuleID: "gpu_hot", ConnectionID: "conn", Target: "box", GPUIndex: 1, State: "fired", Message: "GPU overheating on box GPU 1"}, time.Now())
+	d.wg.Wait()
+
+	got := strings.Join(sink.received(), "\n")
+	if !strings.Contains(got, `{"username": "NVSmiBar", "content": "GPU overheating on box GPU 1"}`) {
+		t.Fatalf("missing discord body in %q", got)
+	}
+	if !strings.Contains(got, `{"rule": "gpu_hot", "gpu": 1}`) {
+		t.Fatalf("missing templated body in %q", got)
+	}
+}
+
+func TestWebhookRetriesWithBackoff(t *testing.T) {
+	sink := &webhookSink{fail: 2}
+	srv := httptest.NewServer(sink)
+	defer srv.Close()
+
+	d, slept := newTestDispatcher()
+	hook := WebhookConfig{ID: "h", Enabled: true, URL: srv.URL}
+	if err := d.deliver(hook, WebhookPayload{Event: webhookEventTest}, 3); err != nil {
+		t.Fatalf("deliver returned error: %v", err)
+	}
+	if len(sink.received()) != 1 || len(*slept) != 2 || (*slept)[0] != webhookBackoff[0] || (*slept)[1] != webhookBackoff[1] {
+		t.Fatalf("expected two backed-off retries, slept %v", *slept)
+	}
+
+	// Client errors are not retried.
+	bad := httptest.NewServer(http.NotFoundHandler())
+	defer bad.Close()
+	*slept = nil
+	if err := d.deliver(WebhookConfig{ID: "h", URL: bad.URL}, WebhookPayload{}, 3); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Fatalf("expected 404 error, got %v", err)
+	}
+	if len(*slept) != 0 {
+		t.Fatalf("4xx should not retry, slept %v", *slept)
+	}
+}
+
+func TestSendTestWebhook(t *testing.T) {
+	sink := &webhookSink{}
+	srv := httptest.NewServer(sink)
+	defer srv.Close()
+
+	a, _ := newTestApp(nil)
+	if err := a.SendTestWebhook(WebhookConfig{URL: srv.URL, Format: webhookFormatSlack}); err != nil {
+		t.Fatalf("SendTestWebhook returned error: %v", err)
+	}
+	if got := sink.received(); len(got) != 1 || got[0] != `{"text": "Test message from NVSmiBar"}` {
+		t.Fatalf("unexpected test delivery %q", got)
+	}
+	if err := a.SendTestWebhook(WebhookConfig{URL: "ftp://example.com"}); err == nil {
+		t.Fatal("expected invalid URL error")
+	}
+
+	// Delivery errors name the hook, never the URL and its token.
+	down := httptest.NewServer(sink)
+	down.Close()
+	err := a.SendTestWebhook(WebhookConfig{ID: "ops", Name: "Ops channel", URL: down.URL + "/hooks/T0001/s3cr3t"})
+	if err == nil || strings.Contains(err.Error(), "s3cr3t") || !strings.Contains(err.Error(), "Ops channel") {
+		t.Fatalf("expected a redacted delivery error, got %v", err)
+	}
+	if err := a.SetWebhooks([]WebhookConfig{{ID: "a", URL: srv.URL, Format: "teams"}}); err == nil {
+		t.Fatal("expected unknown format error")
+	}
+	if err := a.SetWebhooks([]WebhookConfig{{ID: "a", URL: srv.URL, Events: []string{webhookEventJobFinished}}}); err != nil {
+		t.Fatal(err)
+	}
+	if hooks := a.GetWebhooks(); len(hooks) != 1 || hooks[0].ID != "a" {
+		t.Fatalf("webhooks not stored: %+v", hooks)
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const xpuDeviceMarker = "--nvsmibar-device--"
+
+// xpuSMICollector reads Intel data center GPUs with xpu-smi. Names and
+// memory sizes come from discovery, readings from stats; both are fetched per
+// device in one probe section.
+type xpuSMICollector struct{}
+
+func (xpuSMICollector) vendor() string { return vendorIntel }
+
+const xpuSMICommand = `for d in $(xpu-smi discovery -j | sed -n 's/.*"device_id": *\([0-9]*\).*/\1/p'); do` +
+	` echo ` + xpuDeviceMarker + `; xpu-smi discovery -d "$d" -j && xpu-smi stats -d "$d" -j || exit 1; done`
+
+func (xpuSMICollector) plan(host string) probePlan {
+	return probePlan{
+		sections: []probeSection{{"gpu", xpuSMICommand}},
+		parse: func(r probeResults) ([]GPU, error) {
+			out, err := r.output("gpu")
+			if err != nil {
+				return nil, err
+			}
+			return parseXPUSMI(out)
+		},
+	}
+}
+
+type xpuDiscovery struct {
+	DeviceID      int         `json:"device_id"`
+	DeviceName    string      `json:"device_name"`
+	UUID          string      `json:"uuid"`
+	PCIBDF        string      `json:"pci_bdf_address"`
+	DriverVersion string      `json:"driver_version"`
+	MemoryBytes   jsonReading `json:"memory_physical_size_byte"`
+	PCIeGen       jsonReading `json:"pcie_generation"`
+	PCIeWidth     jsonReading `json:"pcie_max_link_width"`
+}
+
+type xpuMetric struct {
+	Type  string      `json:"metrics_type"`
+	Value jsonReading `json:"value"`
+}
+
+type xpuStats struct {
+	DeviceID    int         `json:"device_id"`
+	DeviceLevel []xpuMetric `json:"device_level"`
+	TileLevel   []struct {
+		DataList []xpuMetric `json:"data_list"`
+	} `json:"tile_level"`
+}
+
+// metric returns a device-level reading. Multi-tile parts report some
+// readings per tile only; then the hottest or highest tile stands in.
+func (s xpuStats) metric(name string) jsonReading {
+	for _, m := range s.DeviceLevel {
+		if m.Type == name && m.Value.ok {
+			return m.Value
+		}
+	}
+	var best jsonReading
+	for _, tile := range s.TileLevel {
+		for _, m := range tile.DataList {
+			if m.Type == name && m.Value.ok && (!best.ok || m.Value.value > best.value) {
+				best = m.Value
+			}
+		}
+	}
+	return best
+}
+
+// parseXPUSMI parses the per-device discovery and stats documents printed by
+// xpuSMICollector, each device section starting with xpuDeviceMarker.
+func parseXPUSMI(raw string) ([]GPU, error) {
+	gpus := []GPU{}
+	sections := strings.Split(raw, xpuDeviceMarker)
+	for _, section := range sections[1:] {
+		dec := json.NewDecoder(strings.NewReader(section))
+		var disc xpuDiscovery
+		var stats xpuStats
+		if err := dec.Decode(&disc); err != nil {
+			return nil, fmt.Errorf("parse xpu-smi discovery: %w", err)
+		}
+		if err := dec.Decode(&stats); err != nil && err != io.EOF {
+			return nil, fmt.Errorf("parse xpu-smi stats: %w", err)
+		}
+
+		g := newGPU()
+		g.Vendor = vendorIntel
+		g.Index = disc.DeviceID
+		g.Name = strings.TrimSpace(disc.DeviceName)
+		g.UUID = disc.UUID
+		g.PCIBusID = disc.PCIBDF
+		g.DriverVersion = optionalString(disc.DriverVersion)
+		g.PCIeGenMax = disc.PCIeGen.int()
+		g.PCIeWidthMax = disc.PCIeWidth.int()
+
+		disc.MemoryBytes.unit = "B"
+		g.MemTotal = disc.MemoryBytes.mib()
+		g.Util = stats.metric("XPUM_STATS_GPU_UTILIZATION").int()
+		g.Temp = stats.metric("XPUM_STATS_GPU_CORE_TEMPERATURE").int()
+		g.MemUsed = stats.metric("XPUM_STATS_MEMORY_USED").int()
+		if g.Util < 0 || g.Temp < 0 || g.MemUsed < 0 || g.MemTotal < 0 {
+			return nil, fmt.Errorf("xpu-smi device %d: missing utilization, temperature or memory", disc.DeviceID)
+		}
+		g.PowerDraw = stats.metric("XPUM_STATS_POWER").int()
+		g.ClockSM = stats.metric("XPUM_STATS_GPU_FREQUENCY").int()
+		gpus = append(gpus, g)
+	}
+	return gpus, nil
+}
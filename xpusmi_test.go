@@ -0,0 +1,42 @@
+package main
+
+import "testing"
+
+func TestParseXPUSMI(t *testing.T) {
+	gpus, err := parseXPUSMI(string(readFixture(t, "xpu-smi", "max1550.txt")))
+	if err != nil {
+		t.Fatalf("parseXPUSMI returned error: %v", err)
+	}
+	if len(gpus) != 2 {
+		t.Fatalf("expected 2 gpus, got %d", len(gpus))
+	}
+	g := gpus[0]
+	if g.Vendor != vendorIntel || g.Name != "Intel(R) Data Center GPU Max 1550" || g.PCIBusID != "0000:29:00.0" || g.UUID == "" {
+		t.Fatalf("unexpected identity: %+v", g)
+	}
+	if g.Util != 63 || g.MemUsed != 40960 || g.MemTotal != 131072 || g.PowerDraw != 413 || g.ClockSM != 1600 {
+		t.Fatalf("unexpected readings: %+v", g)
+	}
+	// Core temperature is per tile on this part; the hottest tile wins.
+	if g.Temp != 58 {
+		t.Fatalf("expected hottest tile temperature 58, got %d", g.Temp)
+	}
+	if g.PCIeGenMax != 4 || g.PCIeWidthMax != 16 || g.FanSpeed != -1 {
+		t.Fatalf("unexpected optional readings: %+v", g)
+	}
+	if g := gpus[1]; g.Index != 1 || g.Temp != 31 || g.PowerDraw != -1 {
+		t.Fatalf("unexpected second gpu: %+v", g)
+	}
+}
+
+func TestParseXPUSMIErrors(t *testing.T) {
+	if gpus, err := parseXPUSMI(""); err != nil || len(gpus) != 0 {
+		t.Fatalf("expected no gpus for empty output, got %v %v", gpus, err)
+	}
+	if _, err := parseXPUSMI(xpuDeviceMarker + "\nError: Level Zero initialization failed\n"); err == nil {
+		t.Fatal("expected error for non-JSON section")
+	}
+	if _, err := parseXPUSMI(xpuDeviceMarker + `{"device_id": 0, "memory_physical_size_byte": "1024"}{"device_id": 0, "device_level": []}`); err == nil {
+		t.Fatal("expected error when readings are missing")
+	}
+}